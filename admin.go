@@ -0,0 +1,405 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+var admin_add_regex = regexp.MustCompile("\\Aadd-resource (\\S+)\\z")
+var admin_remove_regex = regexp.MustCompile("\\Aremove-resource (\\S+)( (--)?force)?\\z")
+var admin_rename_regex = regexp.MustCompile("\\Arename-resource (\\S+) (\\S+)\\z")
+var admin_retire_regex = regexp.MustCompile("\\Aretire-resource (\\S+)\\z")
+
+// How long the members of ADMIN_USERGROUP_ID are remembered for, so that
+// checking whether someone is an admin doesn't always call the Slack API
+var admin_group_cache_ttl = 5 * time.Minute
+
+var admin_group_cache struct {
+	sync.Mutex
+	usergroup  string
+	members    []string
+	fetched_at time.Time
+}
+
+/*
+Changes the resource catalog. Only available to users listed in
+ADMIN_USER_IDS.
+
+Run this locally with:
+
+	curl -XPOST \
+	     -H "Content-Type: application/json" \
+	     -d @example/admin \
+	     http://localhost:8080/slack/commands/reservations
+*/
+func handleCommandAdmin(slack_request SlackRequest, args CommandArgs) (SlackResponse, bool) {
+
+	command := slack_request.FormattedSubcommand()
+	response := SlackResponse{}
+
+	if !isAdmin(slack_request) {
+		log.Warningf("Refused admin command from %v: %q", slack_request.UserId, command)
+		response.Text = "Sorry, only admins can do that"
+		return response, true
+	}
+
+	subcommand := args["command"]
+
+	var fn func(tx *StoreTx) (string, []Notification, error)
+	var resource string
+
+	switch {
+
+	case admin_add_regex.MatchString(subcommand):
+		matches := admin_add_regex.FindStringSubmatch(subcommand)
+		resource = normalizeResourceName(matches[1])
+		fn = adminAddResource(resource)
+
+	case admin_remove_regex.MatchString(subcommand):
+		matches := admin_remove_regex.FindStringSubmatch(subcommand)
+		resource = normalizeResourceName(matches[1])
+		fn = adminRemoveResource(resource, matches[2] != "", slack_request)
+
+	case admin_rename_regex.MatchString(subcommand):
+		matches := admin_rename_regex.FindStringSubmatch(subcommand)
+		resource = normalizeResourceName(matches[1])
+		fn = adminRenameResource(resource, normalizeResourceName(matches[2]))
+
+	case admin_retire_regex.MatchString(subcommand):
+		matches := admin_retire_regex.FindStringSubmatch(subcommand)
+		resource = normalizeResourceName(matches[1])
+		fn = adminRetireResource(resource)
+
+	default:
+		response.Text = adminHelpText()
+		return response, true
+
+	}
+
+	// Change the catalog and anything reserved against it together, then
+	// start using the new catalog straight away
+	var catalog ResourceConfig
+	var notifications []Notification
+	err := store.Update(func(tx *StoreTx) error {
+		tx.seedCatalog()
+
+		text, n, err := fn(tx)
+		if err != nil {
+			return err
+		}
+		notifications = n
+
+		event := newHistoryEvent(HISTORY_ADMIN, resource, slack_request, Reservation{})
+		event.Details = command
+		tx.Record(event)
+
+		response.Text = text
+		catalog = tx.Catalog
+		return nil
+	})
+
+	if isAdminError(err) {
+		response.Text = err.Error()
+		return response, true
+	}
+	if err != nil {
+		log.Error(err)
+		return response, false
+	}
+
+	setResourceConfig(catalog)
+	log.Infof("%v ran admin command %q", slack_request.UserId, command)
+
+	sendNotificationsInBackground(notifications)
+
+	return response, true
+
+}
+
+// An admin command that can't be carried out, with the reason why. Returning
+// it from a transaction rolls the transaction back.
+type AdminError struct {
+	Message string
+}
+
+func (e *AdminError) Error() string {
+
+	return e.Message
+
+}
+
+func isAdminError(err error) bool {
+
+	_, ok := err.(*AdminError)
+	return ok
+
+}
+
+func adminAddResource(name string) func(tx *StoreTx) (string, []Notification, error) {
+
+	return func(tx *StoreTx) (string, []Notification, error) {
+
+		catalog, err := tx.Catalog.Add(Resource{Name: name})
+		if err != nil {
+			return "", nil, &AdminError{err.Error()}
+		}
+		tx.Catalog = catalog
+
+		return fmt.Sprintf("Added \"*%v*\"", name), nil, nil
+
+	}
+
+}
+
+// Refuses to remove a resource while it's reserved, unless `force` is set,
+// in which case its reservations are cancelled and their holders told
+func adminRemoveResource(
+	name string,
+	force bool,
+	slack_request SlackRequest) func(tx *StoreTx) (string, []Notification, error) {
+
+	return func(tx *StoreTx) (string, []Notification, error) {
+
+		held := liveReservations(tx.Reservations[name])
+		if len(held) > 0 && !force {
+			return "", nil, &AdminError{fmt.Sprintf(
+				"\"*%v*\" is reserved by %v. Type "+
+					"`/reservations admin remove-resource %v force` to remove "+
+					"it anyway, cancelling their reservations",
+				name,
+				holdersToString(held),
+				name)}
+		}
+
+		catalog, err := tx.Catalog.Remove(name)
+		if err != nil {
+			return "", nil, &AdminError{err.Error()}
+		}
+		tx.Catalog = catalog
+
+		delete(tx.Reservations, name)
+		delete(tx.Waitlists, name)
+
+		if len(held) == 0 {
+			return fmt.Sprintf("Removed \"*%v*\"", name), nil, nil
+		}
+
+		notifications := []Notification{}
+		for _, reservation := range held {
+			event := newHistoryEvent(HISTORY_FORCE_CANCEL, name, slack_request, reservation)
+			event.OldEndAt = reservation.EndAt
+			tx.Record(event)
+
+			notifications = append(notifications, Notification{
+				UserId: reservation.UserId,
+				Text: fmt.Sprintf(
+					"%v has removed *%v*, cancelling your reservation",
+					slack_request.User().Mention(),
+					name),
+			})
+		}
+
+		return fmt.Sprintf(
+			"Removed \"*%v*\", cancelling reservations by %v",
+			name,
+			holdersToString(held)), notifications, nil
+
+	}
+
+}
+
+// Renames a resource, carrying its reservations and waitlist along with it.
+// Its history is append-only, so stays under the old name.
+func adminRenameResource(name string, new_name string) func(tx *StoreTx) (string, []Notification, error) {
+
+	return func(tx *StoreTx) (string, []Notification, error) {
+
+		catalog, err := tx.Catalog.Rename(name, new_name)
+		if err != nil {
+			return "", nil, &AdminError{err.Error()}
+		}
+		tx.Catalog = catalog
+
+		if schedule, ok := tx.Reservations[name]; ok {
+			tx.Reservations[new_name] = schedule
+			delete(tx.Reservations, name)
+		}
+
+		if waitlist, ok := tx.Waitlists[name]; ok {
+			tx.Waitlists[new_name] = waitlist
+			delete(tx.Waitlists, name)
+		}
+
+		return fmt.Sprintf(
+			"Renamed \"*%v*\" to \"*%v*\". Its history up to now is still under "+
+				"\"*%v*\"",
+			name,
+			new_name,
+			name), nil, nil
+
+	}
+
+}
+
+// Stops a resource from being reserved. Existing reservations are left to
+// run out, but nobody waiting for it will get it.
+func adminRetireResource(name string) func(tx *StoreTx) (string, []Notification, error) {
+
+	return func(tx *StoreTx) (string, []Notification, error) {
+
+		catalog, err := tx.Catalog.Retire(name)
+		if err != nil {
+			return "", nil, &AdminError{err.Error()}
+		}
+		tx.Catalog = catalog
+
+		delete(tx.Waitlists, name)
+
+		return fmt.Sprintf(
+			"Retired \"*%v*\". It can't be reserved any more, but existing "+
+				"reservations will run until they expire",
+			name), nil, nil
+
+	}
+
+}
+
+// Returns the reservations in the schedule that are current or upcoming
+func liveReservations(schedule Schedule) Schedule {
+
+	live := Schedule{}
+
+	for _, reservation := range schedule {
+		if !reservation.IsExpired() {
+			live = append(live, reservation)
+		}
+	}
+
+	return live
+
+}
+
+func holdersToString(schedule Schedule) string {
+
+	holders := make([]string, len(schedule))
+	for i, reservation := range schedule {
+		holders[i] = reservation.Mention()
+	}
+
+	return strings.Join(holders, ", ")
+
+}
+
+func adminHelpText() string {
+
+	commands := []helpCommand{
+		{
+			Name:        "admin add-resource",
+			Description: "Add a resource that can be reserved",
+			Usage:       []string{"/reservations admin add-resource (resource)"},
+		},
+		{
+			Name:        "admin remove-resource",
+			Description: "Remove a resource. Add `force` to remove it even if it's reserved",
+			Usage:       []string{"/reservations admin remove-resource (resource) [force]"},
+		},
+		{
+			Name:        "admin rename-resource",
+			Description: "Rename a resource, keeping its reservations. Its history stays under the old name",
+			Usage:       []string{"/reservations admin rename-resource (resource) (new name)"},
+		},
+		{
+			Name:        "admin retire-resource",
+			Description: "Stop a resource from being reserved, letting existing reservations run out",
+			Usage:       []string{"/reservations admin retire-resource (resource)"},
+		},
+	}
+
+	lines := []string{}
+	for _, command := range commands {
+		lines = append(lines, command.ToString())
+	}
+
+	return strings.Join(lines, "\n\n")
+
+}
+
+// Whether the user is listed in ADMIN_USER_IDS or is a member of the
+// ADMIN_USERGROUP_ID user group
+func isAdmin(slack_request SlackRequest) bool {
+
+	for _, id := range adminUserIds() {
+		if id == slack_request.UserId {
+			return true
+		}
+	}
+
+	for _, id := range adminGroupMembers() {
+		if id == slack_request.UserId {
+			return true
+		}
+	}
+
+	return false
+
+}
+
+// Returns the members of the admin user group, fetching them from Slack if
+// they haven't been for a while. If Slack can't be reached the last known
+// members are used.
+func adminGroupMembers() []string {
+
+	usergroup := adminUsergroupId()
+	if usergroup == "" || slack_client == nil {
+		return nil
+	}
+
+	admin_group_cache.Lock()
+	defer admin_group_cache.Unlock()
+
+	if admin_group_cache.usergroup == usergroup &&
+		time.Since(admin_group_cache.fetched_at) < admin_group_cache_ttl {
+		return admin_group_cache.members
+	}
+
+	members, err := slack_client.UsergroupMembers(usergroup)
+	if err != nil {
+		log.Error(err)
+		if admin_group_cache.usergroup == usergroup {
+			return admin_group_cache.members
+		}
+		return nil
+	}
+
+	admin_group_cache.usergroup = usergroup
+	admin_group_cache.members = members
+	admin_group_cache.fetched_at = time.Now()
+
+	return members
+
+}
+
+func adminUserIds() []string {
+
+	ids := []string{}
+
+	for _, id := range strings.Split(os.Getenv("ADMIN_USER_IDS"), ",") {
+		id = strings.TrimSpace(id)
+		if id != "" {
+			ids = append(ids, id)
+		}
+	}
+
+	return ids
+
+}
+
+func adminUsergroupId() string {
+
+	return strings.TrimSpace(os.Getenv("ADMIN_USERGROUP_ID"))
+
+}
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestHandleCommandAdmin(t *testing.T) {
+
+	//
+	// Setup
+	//
+
+	defer useResources("production, staging")()
+
+	old_env := os.Getenv("ADMIN_USER_IDS")
+	defer os.Setenv("ADMIN_USER_IDS", old_env)
+	os.Setenv("ADMIN_USER_IDS", "Uroot, Uother")
+
+	defer useTempStore()()
+
+	api, cleanup_api := useFakeSlackApi()
+	defer cleanup_api()
+
+	//
+	// Test
+	//
+
+	expectMatch(t,
+		runCommand(t, handleCommandAdmin, "alice", "admin add-resource qa"),
+		"only admins can do that")
+
+	expectMatch(t,
+		runCommand(t, handleCommandAdmin, "root", "admin"),
+		"admin add-resource")
+
+	t.Run("Add", func(t *testing.T) {
+
+		expectMatch(t,
+			runCommand(t, handleCommandAdmin, "root", "admin add-resource QA"),
+			"Added \"\\*qa\\*\"")
+
+		expectMatch(t,
+			runCommand(t, handleCommandAdmin, "root", "admin add-resource qa"),
+			"\"\\*qa\\*\" already exists")
+
+		if actual := ListOfResourcesToString(); actual != "[production, staging, qa]" {
+			t.Error("expected", "[production, staging, qa]", "got", actual)
+		}
+
+		// The catalog is saved in the store
+		catalog, _ := NewResourceCatalog()
+		if _, ok := catalog.Find("qa"); !ok {
+			t.Error("expected qa in", catalog)
+		}
+
+	})
+
+	t.Run("Rename", func(t *testing.T) {
+
+		runCommand(t, handleCommandCreate, "alice", "reserve qa for 1 hour")
+		runCommand(t, handleCommandQueue, "bob", "queue qa for 1 hour")
+
+		expectMatch(t,
+			runCommand(t, handleCommandAdmin, "root", "admin rename-resource qa qa2"),
+			"Renamed \"\\*qa\\*\" to \"\\*qa2\\*\"")
+
+		reservation, _ := store.Get("qa2")
+		if reservation.User != "alice" {
+			t.Error("expected", "alice", "got", reservation.User)
+		}
+
+		expectMatch(t,
+			runCommand(t, handleCommandShow, "alice", "list"),
+			"qa2 \\(reserved by <@Ualice>.*\\n\\s+waitlist: 1. <@Ubob>")
+
+	})
+
+	t.Run("Remove", func(t *testing.T) {
+
+		expectMatch(t,
+			runCommand(t, handleCommandAdmin, "root", "admin remove-resource qa2"),
+			"\"\\*qa2\\*\" is reserved by <@Ualice>")
+
+		if !IsValidResource("qa2") {
+			t.Error("expected qa2 not to have been removed")
+		}
+
+		expectMatch(t,
+			runCommand(t, handleCommandAdmin, "root", "admin remove-resource qa2 --force"),
+			"Removed \"\\*qa2\\*\", cancelling reservations by <@Ualice>")
+
+		if IsValidResource("qa2") {
+			t.Error("expected qa2 to have been removed")
+		}
+
+		reservations, _ := store.List()
+		if _, ok := reservations["qa2"]; ok {
+			t.Error("expected reservations on qa2 to be removed, got", reservations["qa2"])
+		}
+
+		events, _ := store.History("qa2", time.Time{})
+		cancelled := []HistoryEvent{}
+		for _, event := range events {
+			if event.Action == HISTORY_FORCE_CANCEL {
+				cancelled = append(cancelled, event)
+			}
+		}
+		if len(cancelled) != 1 || cancelled[0].HolderId != "Ualice" || cancelled[0].UserId != "Uroot" {
+			t.Error("expected alice's reservation to be force-cancelled by root, got", cancelled)
+		}
+
+		told := false
+		for _, message := range api.waitForMessages(1) {
+			if message["channel"] == "Ualice" &&
+				message["text"] == "<@Uroot> has removed *qa2*, cancelling your reservation" {
+				told = true
+			}
+		}
+		if !told {
+			t.Error("expected alice to be told, got", api.waitForMessages(1))
+		}
+
+	})
+
+	t.Run("Retire", func(t *testing.T) {
+
+		runCommand(t, handleCommandCreate, "alice", "reserve staging for 1 hour")
+
+		expectMatch(t,
+			runCommand(t, handleCommandAdmin, "root", "admin retire-resource staging"),
+			"Retired \"\\*staging\\*\"")
+
+		expectMatch(t,
+			runCommand(t, handleCommandCreate, "bob", "reserve staging for 1 hour"),
+			"\"\\*staging\\*\" has been retired")
+
+		expectMatch(t,
+			runCommand(t, handleCommandUpdate, "alice", "extend staging by 1 hour"),
+			"\"\\*staging\\*\" has been retired")
+
+		expectMatch(t,
+			runCommand(t, handleCommandShow, "alice", "list"),
+			"⚠  staging \\(no longer available, reserved by <@Ualice>")
+
+		// Can still be let go of
+		expectMatch(t,
+			runCommand(t, handleCommandDestroy, "alice", "cancel staging"),
+			"has been cancelled")
+
+	})
+
+}
+
+func TestConfigureResourceCatalog(t *testing.T) {
+
+	defer useResources("production, staging")()
+
+	defer useTempStore()()
+
+	// Seeded from RESOURCES the first time
+	if err := configureResourceCatalog(); err != nil {
+		t.Fatal("expected no error, got", err)
+	}
+
+	catalog, _ := NewResourceCatalog()
+	if len(catalog.Resources) != 2 {
+		t.Error("expected", 2, "got", catalog.Resources)
+	}
+
+	// After which the store wins
+	store.Update(func(tx *StoreTx) error {
+		tx.Catalog, _ = tx.Catalog.Add(Resource{Name: "qa"})
+		return nil
+	})
+
+	if err := configureResourceCatalog(); err != nil {
+		t.Fatal("expected no error, got", err)
+	}
+
+	if actual := ListOfResourcesToString(); actual != "[production, staging, qa]" {
+		t.Error("expected", "[production, staging, qa]", "got", actual)
+	}
+
+}
+
+func TestConfigureResourceCatalogAppliesFileChanges(t *testing.T) {
+
+	//
+	// Setup
+	//
+
+	cleanup_resources, err := useResourcesFile(
+		`{"resources": [{"name": "production"}, {"name": "staging"}]}`)
+	defer cleanup_resources()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer useTempStore()()
+
+	if err := configureResourceCatalog(); err != nil {
+		t.Fatal("expected no error, got", err)
+	}
+
+	store.Update(func(tx *StoreTx) error {
+		tx.Catalog, _ = tx.Catalog.Add(Resource{Name: "admin-added"})
+		return nil
+	})
+
+	//
+	// Test
+	//
+
+	// Edited while the server was stopped, and read again at startup
+	body := `{"resources": [{"name": "production"}, {"name": "qa"}]}`
+	if err := ioutil.WriteFile(resourcesFile(), []byte(body), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := configureResources(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := configureResourceCatalog(); err != nil {
+		t.Fatal("expected no error, got", err)
+	}
+
+	expected := "[production, admin-added, qa]"
+	if actual := ListOfResourcesToString(); actual != expected {
+		t.Error("expected", expected, "got", actual)
+	}
+
+	// Nothing more to apply the next time round
+	if err := configureResourceCatalog(); err != nil {
+		t.Fatal("expected no error, got", err)
+	}
+
+	if actual := ListOfResourcesToString(); actual != expected {
+		t.Error("expected", expected, "got", actual)
+	}
+
+}
+
+func TestCatalogChangedByAnotherProcess(t *testing.T) {
+
+	defer useResources("production, staging")()
+
+	defer useTempStore()()
+
+	if err := configureResourceCatalog(); err != nil {
+		t.Fatal("expected no error, got", err)
+	}
+
+	// Saved without going through this process's store
+	catalog, _ := NewResourceCatalog()
+	catalog.ResourceConfig, _ = catalog.Add(Resource{Name: "qa"})
+	if err := catalog.WriteToFile(); err != nil {
+		t.Fatal(err)
+	}
+
+	expectMatch(t,
+		runCommand(t, handleCommandShow, "alice", "list"),
+		"qa")
+
+	if actual := ListOfResourcesToString(); actual != "[production, staging, qa]" {
+		t.Error("expected", "[production, staging, qa]", "got", actual)
+	}
+
+}
+
+func TestSyncCatalog(t *testing.T) {
+
+	catalog := ResourceConfig{Resources: []Resource{
+		{Name: "production"},
+		{Name: "staging", Retired: true},
+		{Name: "admin-added"},
+	}}
+
+	old := ResourceConfig{Resources: []Resource{
+		{Name: "production"},
+		{Name: "staging"},
+		{Name: "qa"},
+	}}
+
+	new := ResourceConfig{Resources: []Resource{
+		{Name: "production"},
+		{Name: "staging", Description: "Pre-production"},
+		{Name: "demo", MaxDuration: ConfigDuration(time.Hour)},
+	}}
+
+	actual, err := syncCatalog(catalog, old, new)
+	if err != nil {
+		t.Fatal("expected no error, got", err)
+	}
+
+	names := []string{}
+	for _, resource := range actual.Resources {
+		names = append(names, resource.Name)
+	}
+
+	expected := "[production staging admin-added demo]"
+	if got := fmt.Sprint(names); got != expected {
+		t.Error("expected", expected, "got", got)
+	}
+
+	staging, _ := actual.Find("staging")
+	if staging.Description != "Pre-production" || !staging.Retired {
+		t.Error("expected staging to be updated but still retired, got", staging)
+	}
+
+}
+
+func TestIsAdmin(t *testing.T) {
+
+	old_ids := os.Getenv("ADMIN_USER_IDS")
+	defer os.Setenv("ADMIN_USER_IDS", old_ids)
+	os.Setenv("ADMIN_USER_IDS", "Uroot")
+
+	old_usergroup := os.Getenv("ADMIN_USERGROUP_ID")
+	defer os.Setenv("ADMIN_USERGROUP_ID", old_usergroup)
+	os.Setenv("ADMIN_USERGROUP_ID", "S0001")
+
+	api, cleanup := useFakeSlackApi()
+	defer cleanup()
+	api.usergroups = map[string][]string{"S0001": {"Ualice"}}
+	defer func() { admin_group_cache.usergroup = "" }()
+
+	test_cases := map[string]bool{
+		"root":  true,
+		"alice": true,
+		"bob":   false,
+	}
+
+	for user, expected := range test_cases {
+		if actual := isAdmin(newTestSlackRequest(user, "")); actual != expected {
+			t.Error(user, ": expected", expected, "got", actual)
+		}
+	}
+
+	// Group members are cached for a while
+	api.usergroups["S0001"] = []string{"Ubob"}
+	if actual := isAdmin(newTestSlackRequest("bob", "")); actual != false {
+		t.Error("expected", false, "got", actual)
+	}
+
+	admin_group_cache.fetched_at = time.Time{}
+	if actual := isAdmin(newTestSlackRequest("bob", "")); actual != true {
+		t.Error("expected", true, "got", actual)
+	}
+
+}
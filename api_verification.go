@@ -0,0 +1,39 @@
+package main
+
+import (
+	"crypto/hmac"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Only lets through requests carrying `Authorization: Bearer <token>`, where
+// the token is STATS_API_TOKEN. Without a token configured the API is
+// disabled.
+func DecorateWithApiToken(inner http.Handler, name string) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		if statsApiToken() == "" {
+			http.NotFound(w, r)
+			return
+		}
+
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !hmac.Equal([]byte(token), []byte(statsApiToken())) {
+			log.Errorf("Invalid API token %v", maskToken(token))
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		inner.ServeHTTP(w, r)
+
+	})
+
+}
+
+func statsApiToken() string {
+
+	return os.Getenv("STATS_API_TOKEN")
+
+}
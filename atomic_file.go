@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// Number of previous versions of a file to keep around when overwriting it
+// with `writeFileAtomically()`
+var snapshot_count = 3
+
+// Replaces the contents of `path` with `body` such that a crash at any point
+// leaves either the old or the new contents in place, never a partial write.
+//
+// The new contents are written and fsync'd to a temporary file in the same
+// directory, which is then renamed over `path`. Before doing so, the current
+// contents are rotated into `path.1`, `path.2`, ... (up to `snapshot_count`)
+// so they can be recovered if needed.
+func writeFileAtomically(path string, body []byte, perm os.FileMode) error {
+
+	dir := filepath.Dir(path)
+
+	tmp, err := ioutil.TempFile(dir, filepath.Base(path)+".tmp")
+	if err != nil {
+		log.Errorf("Could not create temp file in %v", dir)
+		return err
+	}
+
+	// Clean up the temp file if we don't make it to the rename
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(body)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if err == nil {
+		err = tmp.Chmod(perm)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		log.Errorf("Could not write temp file %v", tmp.Name())
+		return err
+	}
+
+	err = rotateSnapshots(path)
+	if err != nil {
+		log.Errorf("Could not rotate snapshots of %v", path)
+		return err
+	}
+
+	err = os.Rename(tmp.Name(), path)
+	if err != nil {
+		log.Errorf("Could not rename %v to %v", tmp.Name(), path)
+		return err
+	}
+
+	// Make sure the rename itself is durable
+	return syncDir(dir)
+
+}
+
+// Shifts `path.N-1` to `path.N`, ..., `path` to `path.1`, dropping the oldest.
+// Files that don't contain valid JSON aren't worth keeping and are skipped so
+// they don't push out good snapshots.
+func rotateSnapshots(path string) error {
+
+	if snapshot_count < 1 {
+		return nil
+	}
+
+	body, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !json.Valid(body) {
+		log.Warningf("Not keeping a snapshot of %v since it's corrupt", path)
+		return nil
+	}
+
+	for i := snapshot_count - 1; i >= 1; i-- {
+		err = os.Rename(snapshotPath(path, i), snapshotPath(path, i+1))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	// Hard link rather than copy - `path` is about to be renamed over, so the
+	// link keeps the old contents alive as the newest snapshot
+	os.Remove(snapshotPath(path, 1))
+	return os.Link(path, snapshotPath(path, 1))
+
+}
+
+// Unmarshals the newest snapshot of `path` that can still be parsed into
+// `v`. The main file gets repaired on its next write. Returns false if no
+// snapshot is usable.
+func recoverFromSnapshot(path string, v interface{}, cause error) bool {
+
+	for i := 1; i <= snapshot_count; i++ {
+		snapshot := snapshotPath(path, i)
+
+		body, err := ioutil.ReadFile(snapshot)
+		if err != nil {
+			continue
+		}
+
+		err = json.Unmarshal(body, v)
+		if err != nil {
+			log.Warningf("Snapshot %v is also corrupt: %v", snapshot, err)
+			continue
+		}
+
+		log.Warningf(
+			"File %v is corrupt (%v). Recovered from snapshot %v",
+			path,
+			cause,
+			snapshot)
+
+		return true
+	}
+
+	return false
+
+}
+
+func snapshotPath(path string, i int) string {
+
+	return fmt.Sprintf("%v.%v", path, i)
+
+}
+
+func syncDir(dir string) error {
+
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+
+}
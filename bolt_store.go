@@ -0,0 +1,446 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var reservations_db = filepath.Join(reservations_dir, "reservations.db")
+
+var bolt_reservations_bucket = []byte("reservations")
+var bolt_waitlists_bucket = []byte("waitlists")
+var bolt_catalog_bucket = []byte("catalog")
+var bolt_history_bucket = []byte("history")
+
+// The catalog is stored as a single value in its bucket
+var bolt_catalog_key = "resources"
+
+// BoltStore keeps reservation schedules and waitlists in an embedded BoltDB
+// database, one bucket each with one key per resource, plus a bucket for the
+// resource catalog and one for the history, keyed by sequence number so it's
+// in the order events were recorded. Unlike `FileStore` the database is
+// opened once and held open for the life of the process.
+type BoltStore struct {
+	Path string
+	db   *bolt.DB
+}
+
+func (bs *BoltStore) Load() error {
+
+	if bs.db != nil {
+		return nil
+	}
+
+	log.Debugf("Opening reservations database %v", bs.Path)
+
+	// Create directory if it does not exist
+	err := os.MkdirAll(filepath.Dir(bs.Path), 0775)
+	if err != nil {
+		log.Errorf("Error creating directory %v", filepath.Dir(bs.Path))
+		return err
+	}
+
+	// BoltDB takes an exclusive lock on the file, so don't wait forever if
+	// another process is holding on to it
+	db, err := bolt.Open(bs.Path, 0644, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		log.Error("Could not open database")
+		return err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{
+			bolt_reservations_bucket,
+			bolt_waitlists_bucket,
+			bolt_catalog_bucket,
+			bolt_history_bucket,
+		} {
+			_, err := tx.CreateBucketIfNotExists(name)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Error("Could not create bucket")
+		db.Close()
+		return err
+	}
+
+	var catalog SavedCatalog
+	err = db.View(func(tx *bolt.Tx) error {
+		var err error
+		catalog, err = readBoltCatalog(tx)
+		return err
+	})
+	if err != nil {
+		log.Error("Could not read catalog")
+		db.Close()
+		return err
+	}
+
+	bs.db = db
+	useCatalog(catalog.ResourceConfig)
+	return nil
+
+}
+
+func (bs *BoltStore) Close() error {
+
+	if bs.db == nil {
+		return nil
+	}
+
+	err := bs.db.Close()
+	bs.db = nil
+	return err
+
+}
+
+func (bs *BoltStore) Get(resource string) (Reservation, error) {
+
+	var schedule Schedule
+
+	err := bs.db.View(func(tx *bolt.Tx) error {
+		body := tx.Bucket(bolt_reservations_bucket).Get([]byte(resource))
+		if body == nil {
+			return nil
+		}
+
+		return json.Unmarshal(body, &schedule)
+	})
+	if err != nil {
+		log.Error("Could not read reservation from database")
+	}
+
+	return schedule.Current(), err
+
+}
+
+func (bs *BoltStore) Upsert(resource string, reservation Reservation) error {
+
+	return bs.Update(func(tx *StoreTx) error {
+		return tx.Reservations.Upsert(resource, reservation)
+	})
+
+}
+
+func (bs *BoltStore) Delete(resource string, reservation Reservation) error {
+
+	return bs.Update(func(tx *StoreTx) error {
+		return tx.Reservations.Delete(resource, reservation)
+	})
+
+}
+
+func (bs *BoltStore) List() (Reservations, error) {
+
+	var reservations Reservations
+
+	err := bs.db.View(func(tx *bolt.Tx) error {
+		var err error
+		reservations, err = readBoltReservations(tx)
+		return err
+	})
+	if err != nil {
+		log.Error("Could not read reservations from database")
+	}
+
+	return reservations, err
+
+}
+
+// BoltDB only allows one read-write transaction at a time (and holds an
+// exclusive lock on the database file), so this is serialized both within
+// and across processes.
+func (bs *BoltStore) Update(fn func(tx *StoreTx) error) error {
+
+	var saved, updated ResourceConfig
+
+	err := bs.db.Update(func(btx *bolt.Tx) error {
+		reservations, err := readBoltReservations(btx)
+		if err != nil {
+			return err
+		}
+
+		waitlists, err := readBoltWaitlists(btx)
+		if err != nil {
+			return err
+		}
+
+		catalog, err := readBoltCatalog(btx)
+		if err != nil {
+			return err
+		}
+		saved = catalog.ResourceConfig
+
+		tx := &StoreTx{
+			Reservations:  reservations,
+			Waitlists:     waitlists,
+			Catalog:       catalog.ResourceConfig,
+			CatalogSource: catalog.Source,
+		}
+
+		err = fn(tx)
+		if err != nil {
+			return err
+		}
+
+		err = writeBoltReservations(btx, tx.Reservations)
+		if err != nil {
+			return err
+		}
+
+		err = writeBoltWaitlists(btx, tx.Waitlists)
+		if err != nil {
+			return err
+		}
+
+		err = writeBoltCatalog(btx, SavedCatalog{tx.Catalog, tx.CatalogSource})
+		if err != nil {
+			return err
+		}
+		updated = tx.Catalog
+
+		return appendBoltHistory(btx, tx.Events)
+	})
+
+	if err == ErrRollback {
+		useCatalog(saved)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	useCatalog(updated)
+	return nil
+
+}
+
+func (bs *BoltStore) History(resource string, since time.Time) ([]HistoryEvent, error) {
+
+	events := []HistoryEvent{}
+
+	err := bs.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bolt_history_bucket).ForEach(func(k, v []byte) error {
+			var event HistoryEvent
+			err := json.Unmarshal(v, &event)
+			if err != nil {
+				return err
+			}
+
+			events = append(events, event)
+			return nil
+		})
+	})
+	if err != nil {
+		log.Error("Could not read history from database")
+		return nil, err
+	}
+
+	return filterHistory(events, resource, since), nil
+
+}
+
+func readBoltReservations(tx *bolt.Tx) (Reservations, error) {
+
+	reservations := Reservations{}
+
+	values, err := readBoltBucket(tx, bolt_reservations_bucket)
+	if err != nil {
+		return reservations, err
+	}
+
+	for resource, body := range values {
+		var schedule Schedule
+
+		err := json.Unmarshal(body, &schedule)
+		if err != nil {
+			return reservations, err
+		}
+
+		reservations[resource] = schedule
+	}
+
+	return reservations, nil
+
+}
+
+func writeBoltReservations(tx *bolt.Tx, reservations Reservations) error {
+
+	values := map[string][]byte{}
+
+	for resource, schedule := range reservations {
+		body, err := json.Marshal(schedule)
+		if err != nil {
+			log.Error("Could not marshal JSON data")
+			return err
+		}
+
+		values[resource] = body
+	}
+
+	return replaceBoltBucket(tx, bolt_reservations_bucket, values)
+
+}
+
+func readBoltWaitlists(tx *bolt.Tx) (Waitlists, error) {
+
+	waitlists := Waitlists{}
+
+	values, err := readBoltBucket(tx, bolt_waitlists_bucket)
+	if err != nil {
+		return waitlists, err
+	}
+
+	for resource, body := range values {
+		var waitlist Waitlist
+
+		err := json.Unmarshal(body, &waitlist)
+		if err != nil {
+			return waitlists, err
+		}
+
+		waitlists[resource] = waitlist
+	}
+
+	return waitlists, nil
+
+}
+
+func writeBoltWaitlists(tx *bolt.Tx, waitlists Waitlists) error {
+
+	values := map[string][]byte{}
+
+	for resource, waitlist := range waitlists {
+		body, err := json.Marshal(waitlist)
+		if err != nil {
+			log.Error("Could not marshal JSON data")
+			return err
+		}
+
+		values[resource] = body
+	}
+
+	return replaceBoltBucket(tx, bolt_waitlists_bucket, values)
+
+}
+
+func readBoltCatalog(tx *bolt.Tx) (SavedCatalog, error) {
+
+	catalog := SavedCatalog{}
+
+	body := tx.Bucket(bolt_catalog_bucket).Get([]byte(bolt_catalog_key))
+	if body == nil {
+		return catalog, nil
+	}
+
+	err := json.Unmarshal(body, &catalog)
+	return catalog, err
+
+}
+
+func writeBoltCatalog(tx *bolt.Tx, catalog SavedCatalog) error {
+
+	values := map[string][]byte{}
+
+	if len(catalog.Resources) > 0 {
+		body, err := json.Marshal(catalog)
+		if err != nil {
+			log.Error("Could not marshal JSON data")
+			return err
+		}
+
+		values[bolt_catalog_key] = body
+	}
+
+	return replaceBoltBucket(tx, bolt_catalog_bucket, values)
+
+}
+
+func appendBoltHistory(tx *bolt.Tx, events []HistoryEvent) error {
+
+	bucket := tx.Bucket(bolt_history_bucket)
+
+	for _, event := range events {
+		body, err := json.Marshal(event)
+		if err != nil {
+			log.Error("Could not marshal JSON data")
+			return err
+		}
+
+		seq, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+
+		// Big endian so keys sort in the order they were added
+		key := make([]byte, 8)
+		binary.BigEndian.PutUint64(key, seq)
+
+		err = bucket.Put(key, body)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+
+}
+
+// Returns a copy of every key and value in the bucket
+func readBoltBucket(tx *bolt.Tx, name []byte) (map[string][]byte, error) {
+
+	values := map[string][]byte{}
+
+	err := tx.Bucket(name).ForEach(func(k, v []byte) error {
+		// Values are only valid for the life of the transaction
+		values[string(k)] = append([]byte{}, v...)
+		return nil
+	})
+
+	return values, err
+
+}
+
+// Replaces the contents of the bucket with `values`
+func replaceBoltBucket(tx *bolt.Tx, name []byte, values map[string][]byte) error {
+
+	bucket := tx.Bucket(name)
+
+	// Collect keys first since the bucket can't be modified while iterating
+	var stale [][]byte
+	err := bucket.ForEach(func(k, v []byte) error {
+		if _, ok := values[string(k)]; !ok {
+			stale = append(stale, append([]byte{}, k...))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, k := range stale {
+		err = bucket.Delete(k)
+		if err != nil {
+			return err
+		}
+	}
+
+	for k, v := range values {
+		err = bucket.Put([]byte(k), v)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var time_of_day_regex = regexp.MustCompile("\\A(\\d{1,2})(?::(\\d{2}))?(am|pm)?\\z")
+var iso_date_regex = regexp.MustCompile("\\A\\d{4}-\\d{2}-\\d{2}\\z")
+
+var weekdays = map[string]time.Weekday{
+	"sunday":    time.Sunday,
+	"sun":       time.Sunday,
+	"monday":    time.Monday,
+	"mon":       time.Monday,
+	"tuesday":   time.Tuesday,
+	"tue":       time.Tuesday,
+	"tues":      time.Tuesday,
+	"wednesday": time.Wednesday,
+	"wed":       time.Wednesday,
+	"thursday":  time.Thursday,
+	"thu":       time.Thursday,
+	"thurs":     time.Thursday,
+	"friday":    time.Friday,
+	"fri":       time.Friday,
+	"saturday":  time.Saturday,
+	"sat":       time.Saturday,
+}
+
+// Parses a point in time the way people tend to type it in to Slack, e.g.
+//
+//	2pm, 2:30pm, 14:00, at noon
+//	today 2pm, tomorrow at 9am
+//	friday 3pm, on fri at 3pm
+//	2017-08-15 14:00
+//
+// Times are interpreted in `now`'s location. A time of day without a day
+// means today, and a weekday means the next one (today included, if the time
+// hasn't passed yet). Times in the past are rejected.
+func parseWallClockTime(text string, now time.Time) (time.Time, error) {
+
+	words := clockTimeWords(text)
+
+	if len(words) == 0 {
+		return time.Time{}, errors.New("I need a time, like *2pm* or *tomorrow 9:30am*")
+	}
+
+	// Work out the day
+	year, month, day := now.Date()
+	date, day_given, err := parseDay(words[0], now)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if day_given {
+		year, month, day = date.Date()
+		_, is_weekday := weekdays[words[0]]
+		words = words[1:]
+
+		// Allow for "monday 9am" said on a Monday after 9am to mean next week
+		if is_weekday && date.Day() == now.Day() && len(words) > 0 {
+			hour, minute, err := parseTimeOfDay(strings.Join(words, ""))
+			if err == nil &&
+				!time.Date(year, month, day, hour, minute, 0, 0, now.Location()).After(now) {
+				year, month, day = now.AddDate(0, 0, 7).Date()
+			}
+		}
+	}
+
+	// Work out the time of day
+	if len(words) == 0 {
+		return time.Time{}, errors.New(
+			fmt.Sprintf("What time on *%v*? Try e.g. *%v 9am*", text, text))
+	}
+
+	hour, minute, err := parseTimeOfDay(strings.Join(words, ""))
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	t := time.Date(year, month, day, hour, minute, 0, 0, now.Location())
+
+	if !t.After(now) {
+		if day_given {
+			return time.Time{}, errors.New(
+				fmt.Sprintf("*%v* is in the past", text))
+		}
+
+		return time.Time{}, errors.New(
+			fmt.Sprintf("*%v* has already passed today. Did you mean *tomorrow %v*?",
+				text,
+				text))
+	}
+
+	return t, nil
+
+}
+
+// Parses when a reservation should end, e.g. "5pm", "tomorrow 9am" or
+// "friday". Works like `parseWallClockTime()`, except that a day on its own
+// means the end of that day.
+func parseEndTime(text string, now time.Time) (time.Time, error) {
+
+	words := clockTimeWords(text)
+
+	if len(words) == 1 {
+		date, ok, err := parseDay(words[0], now)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if ok {
+			year, month, day := date.Date()
+			end_at := time.Date(year, month, day+1, 0, 0, 0, 0, now.Location())
+			if !end_at.After(now) {
+				return time.Time{}, errors.New(
+					fmt.Sprintf("*%v* is in the past", text))
+			}
+			return end_at, nil
+		}
+	}
+
+	return parseWallClockTime(text, now)
+
+}
+
+// Works out which day `word` means: "today", "tomorrow", a weekday (the next
+// one, today included) or a date like 2017-08-15. Returns false if it isn't
+// a day at all.
+func parseDay(word string, now time.Time) (time.Time, bool, error) {
+
+	year, month, day := now.Date()
+
+	switch {
+
+	case word == "today":
+
+	case word == "tomorrow":
+		year, month, day = now.AddDate(0, 0, 1).Date()
+
+	case iso_date_regex.MatchString(word):
+		date, err := time.ParseInLocation("2006-01-02", word, now.Location())
+		if err != nil {
+			return time.Time{}, false, errors.New(
+				fmt.Sprintf("I don't understand the date *%v*", word))
+		}
+		year, month, day = date.Date()
+
+	default:
+		weekday, ok := weekdays[word]
+		if !ok {
+			return time.Time{}, false, nil
+		}
+
+		days_ahead := (int(weekday) - int(now.Weekday()) + 7) % 7
+		year, month, day = now.AddDate(0, 0, days_ahead).Date()
+
+	}
+
+	return time.Date(year, month, day, 0, 0, 0, 0, now.Location()), true, nil
+
+}
+
+// Splits the text in to lowercase words, leaving out "at" and "on"
+func clockTimeWords(text string) []string {
+
+	var words []string
+	for _, word := range strings.Fields(strings.ToLower(text)) {
+		if word != "at" && word != "on" {
+			words = append(words, word)
+		}
+	}
+
+	return words
+
+}
+
+// Parses "2pm", "2:30pm", "14:00", "noon" or "midnight" into an hour and
+// minute. Bare numbers like "2" are rejected since they're ambiguous.
+func parseTimeOfDay(text string) (int, int, error) {
+
+	switch text {
+	case "noon":
+		return 12, 0, nil
+	case "midnight":
+		return 0, 0, nil
+	}
+
+	invalid := errors.New(
+		fmt.Sprintf("I don't understand the time *%v*. Try e.g. *2pm* or *14:00*", text))
+
+	matches := time_of_day_regex.FindStringSubmatch(text)
+	if matches == nil || (matches[2] == "" && matches[3] == "") {
+		return 0, 0, invalid
+	}
+
+	hour, _ := strconv.Atoi(matches[1])
+	minute := 0
+	if matches[2] != "" {
+		minute, _ = strconv.Atoi(matches[2])
+	}
+
+	switch matches[3] {
+	case "am", "pm":
+		if hour < 1 || hour > 12 {
+			return 0, 0, invalid
+		}
+		if hour == 12 {
+			hour = 0
+		}
+		if matches[3] == "pm" {
+			hour += 12
+		}
+	default:
+		if hour > 23 {
+			return 0, 0, invalid
+		}
+	}
+
+	if minute > 59 {
+		return 0, 0, invalid
+	}
+
+	return hour, minute, nil
+
+}
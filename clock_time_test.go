@@ -0,0 +1,121 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseWallClockTime(t *testing.T) {
+
+	// Wednesday
+	now := time.Date(2017, 8, 16, 10, 30, 0, 0, time.UTC)
+
+	at := func(day int, hour int, minute int) time.Time {
+		return time.Date(2017, 8, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	test_cases := map[string]time.Time{
+		"2pm":              at(16, 14, 0),
+		"2 pm":             at(16, 14, 0),
+		"at 2:30pm":        at(16, 14, 30),
+		"14:00":            at(16, 14, 0),
+		"noon":             at(16, 12, 0),
+		"today 11am":       at(16, 11, 0),
+		"tomorrow 9am":     at(17, 9, 0),
+		"tomorrow at 9am":  at(17, 9, 0),
+		"friday 3pm":       at(18, 15, 0),
+		"on fri at 3pm":    at(18, 15, 0),
+		"monday 9am":       at(21, 9, 0),
+		"wednesday 11am":   at(16, 11, 0),
+		"wednesday 9am":    at(23, 9, 0),
+		"2017-08-20 08:15": at(20, 8, 15),
+	}
+
+	for text, expected := range test_cases {
+		actual, err := parseWallClockTime(text, now)
+
+		if expected.IsZero() {
+			if err == nil {
+				t.Error(text, ": expected an error, got", actual)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Error(text, ": expected no error, got", err)
+			continue
+		}
+
+		if !actual.Equal(expected) {
+			t.Error(text, ": expected", expected, "got", actual)
+		}
+	}
+
+}
+
+func TestParseWallClockTimeErrors(t *testing.T) {
+
+	now := time.Date(2017, 8, 16, 10, 30, 0, 0, time.UTC)
+
+	test_cases := []string{
+		"",
+		"2",
+		"13pm",
+		"25:00",
+		"9am",
+		"today 9am",
+		"tomorrow",
+		"someday 2pm",
+		"2017-08-01 9am",
+	}
+
+	for _, text := range test_cases {
+		actual, err := parseWallClockTime(text, now)
+
+		if err == nil {
+			t.Error(text, ": expected an error, got", actual)
+		}
+	}
+
+}
+
+func TestParseEndTime(t *testing.T) {
+
+	// Wednesday
+	now := time.Date(2017, 8, 16, 10, 30, 0, 0, time.UTC)
+
+	at := func(day int, hour int, minute int) time.Time {
+		return time.Date(2017, 8, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	test_cases := map[string]time.Time{
+		"5pm":              at(16, 17, 0),
+		"17:00":            at(16, 17, 0),
+		"tomorrow 9am":     at(17, 9, 0),
+		"today":            at(17, 0, 0),
+		"tomorrow":         at(18, 0, 0),
+		"friday":           at(19, 0, 0),
+		"on friday":        at(19, 0, 0),
+		"2017-08-20":       at(21, 0, 0),
+		"friday at 3pm":    at(18, 15, 0),
+		"2017-08-20 08:15": at(20, 8, 15),
+	}
+
+	for text, expected := range test_cases {
+		actual, err := parseEndTime(text, now)
+		if err != nil {
+			t.Error(text, ": expected no error, got", err)
+			continue
+		}
+		if !actual.Equal(expected) {
+			t.Error(text, ": expected", expected, "got", actual)
+		}
+	}
+
+	for _, text := range []string{"", "9am", "someday", "2017-08-01 9am", "2017-02-30", "2017-01-01", "2017-08-15"} {
+		if actual, err := parseEndTime(text, now); err == nil {
+			t.Error(text, ": expected an error, got", actual)
+		}
+	}
+
+}
@@ -0,0 +1,489 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// The kinds of value a command's arguments take
+const (
+	ARG_RESOURCE = "resource"
+	ARG_DURATION = "duration"
+	ARG_TIME     = "time"
+	ARG_USER     = "user"
+	ARG_TEXT     = "text"
+	ARG_NOTE     = "note"
+)
+
+// A subcommand of `/reservations`. Its usage in `/reservations help` is
+// worked out from its `Args`, followed by its `Examples`, where `%v` stands
+// for a resource. `Handler` is given the values `parseCommand()` found for
+// its arguments.
+type Command struct {
+	Name        string
+	Aliases     []string
+	Description string
+	Args        []CommandArg
+	Examples    []string
+	AdminOnly   bool
+	Handler     func(SlackRequest, CommandArgs) (SlackResponse, bool)
+}
+
+// An argument a command takes. Arguments without `Keywords` come straight
+// after the command's name, in order. The others are introduced by one of
+// their keywords, e.g. "for" in "reserve staging for 2 hours". `Or` is an
+// alternative that can be given instead, e.g. "until 5pm". `Multiple`
+// arguments take a comma separated list, e.g. "staging, staging-db". A note
+// runs to the end of the text, so it can contain other arguments' keywords.
+type CommandArg struct {
+	Name     string
+	Type     string
+	Keywords []string
+	Optional bool
+	Multiple bool
+	Or       *CommandArg
+}
+
+// The values given for a command's arguments, by name. Values are lowercase,
+// except for users since Slack IDs are case sensitive, and notes. Resources
+// are given by their full name, even if the user typed an alias or prefix.
+type CommandArgs map[string]string
+
+// Every subcommand, in the order they're listed in `/reservations help`. Add
+// new subcommands here.
+func registeredCommands() []Command {
+
+	resource := CommandArg{Name: "resource", Type: ARG_RESOURCE}
+	note := CommandArg{Name: "note", Type: ARG_NOTE, Keywords: []string{"--", "—"}, Optional: true}
+	holder := CommandArg{Name: "holder", Type: ARG_USER, Optional: true}
+
+	return []Command{
+		{
+			Name:        "help",
+			Description: "Show this message",
+			Handler:     handleCommandHelp,
+		},
+		{
+			Name:        "list",
+			Aliases:     []string{"ls"},
+			Description: "List reservations",
+			Handler:     handleCommandShow,
+		},
+		{
+			Name:        "reserve",
+			Description: "Create a new reservation, starting now or at a later time",
+			Args: []CommandArg{
+				{Name: "resource", Type: ARG_RESOURCE, Multiple: true},
+				{Name: "start time", Type: ARG_TIME, Optional: true},
+				{
+					Name:     "duration",
+					Type:     ARG_DURATION,
+					Keywords: []string{"for"},
+					Optional: true,
+					Or:       &CommandArg{Name: "end time", Type: ARG_TIME, Keywords: []string{"until"}},
+				},
+				note,
+			},
+			Examples: []string{
+				"reserve %v for 3 hours",
+				"reserve %v tomorrow 2pm for 3 hours",
+				"reserve %v until 5pm",
+				"reserve %v, %[1]v-db for 2 hours",
+				"reserve %v for 2 hours -- testing PR #4312",
+			},
+			Handler: handleCommandCreate,
+		},
+		{
+			Name:        "extend",
+			Description: "Extend an existing reservation",
+			Args: []CommandArg{
+				resource,
+				{
+					Name:     "duration",
+					Type:     ARG_DURATION,
+					Keywords: []string{"by"},
+					Or:       &CommandArg{Name: "end time", Type: ARG_TIME, Keywords: []string{"until"}},
+				},
+			},
+			Examples: []string{
+				"extend %v by 20 mins",
+				"extend %v until friday",
+			},
+			Handler: handleCommandUpdate,
+		},
+		{
+			Name:        "cancel",
+			Description: "Cancel your current (or else next) reservation, or leave the waitlist",
+			Args:        []CommandArg{resource},
+			Examples:    []string{"cancel %v"},
+			Handler:     handleCommandDestroy,
+		},
+		{
+			Name:        "transfer",
+			Description: "Hand your current reservation over to someone else, for the rest of its time",
+			Args: []CommandArg{
+				resource,
+				{Name: "user", Type: ARG_USER, Keywords: []string{"to"}},
+			},
+			Examples: []string{"transfer %v to @alice"},
+			Handler:  handleCommandTransfer,
+		},
+		{
+			Name:        "note",
+			Description: "Say why you've reserved a resource, or leave out the note to remove it",
+			Args:        []CommandArg{resource, note},
+			Examples:    []string{"note %v -- testing PR #4312"},
+			Handler:     handleCommandNote,
+		},
+		{
+			Name:        "queue",
+			Description: "Get in line for a resource someone else has reserved. You'll get it as soon as it's free",
+			Args: []CommandArg{
+				resource,
+				{Name: "duration", Type: ARG_DURATION, Keywords: []string{"for"}, Optional: true},
+			},
+			Examples: []string{"queue %v for 2 hours"},
+			Handler:  handleCommandQueue,
+		},
+		{
+			Name:        "history",
+			Description: "See who's had a resource and what they did with it, over the last week or since a given time",
+			Args: []CommandArg{
+				resource,
+				{Name: "time ago", Type: ARG_DURATION, Keywords: []string{"since"}, Optional: true},
+			},
+			Examples: []string{"history %v since 2d"},
+			Handler:  handleCommandHistory,
+		},
+		{
+			Name:        "stats",
+			Description: "See how busy resources have been, and who's used them most, over the last 30 days or a given time",
+			Args: []CommandArg{
+				{Name: "resource", Type: ARG_RESOURCE, Optional: true},
+				{Name: "time", Type: ARG_DURATION, Keywords: []string{"last", "past"}, Optional: true},
+			},
+			Examples: []string{"stats %v last 7 days"},
+			Handler:  handleCommandStats,
+		},
+		{
+			Name:        "admin",
+			Description: "Manage resources (admins only)",
+			Args:        []CommandArg{{Name: "command", Type: ARG_TEXT, Optional: true}},
+			AdminOnly:   true,
+			Handler:     handleCommandAdmin,
+		},
+		{
+			Name:        "force-cancel",
+			Description: "Cancel whoever's reservation is in effect on a resource (admins only)",
+			Args:        []CommandArg{resource, holder},
+			Examples:    []string{"force-cancel %v", "force-cancel %v @bob"},
+			AdminOnly:   true,
+			Handler:     handleCommandForceCancel,
+		},
+		{
+			Name:        "reassign",
+			Description: "Hand someone's current reservation over to someone else (admins only)",
+			Args: []CommandArg{
+				resource,
+				holder,
+				{Name: "user", Type: ARG_USER, Keywords: []string{"to"}},
+			},
+			Examples:  []string{"reassign %v to @alice", "reassign %v @bob to @alice"},
+			AdminOnly: true,
+			Handler:   handleCommandReassign,
+		},
+	}
+
+}
+
+func findCommand(name string) (Command, bool) {
+
+	for _, command := range registeredCommands() {
+		if command.Name == name {
+			return command, true
+		}
+		for _, alias := range command.Aliases {
+			if alias == name {
+				return command, true
+			}
+		}
+	}
+
+	return Command{}, false
+
+}
+
+/*
+Parses the text of a slash command, e.g. "reserve staging for 2 hours", into
+the command it's for and the values of its arguments. The error says what's
+wrong with the text in a way that can be shown to the user.
+
+The words after the command's name go to its positional arguments, up to the
+first keyword. Each keyword's argument then runs up to the next keyword.
+Resource names can contain spaces, so when a resource is followed by another
+positional argument the longest valid resource name wins. Aliases and
+prefixes of resource names are expanded to the full name.
+*/
+func parseCommand(text string) (Command, CommandArgs, error) {
+
+	words := strings.Fields(text)
+	if len(words) == 0 {
+		return Command{}, nil, errors.New(
+			"What would you like to do? Type `/reservations help` to see what I can do")
+	}
+
+	name := strings.ToLower(words[0])
+	command, ok := findCommand(name)
+	if !ok {
+		return Command{}, nil, errors.New(fmt.Sprintf(
+			"I don't know the command *%v*. Type `/reservations help` to see what I can do",
+			name))
+	}
+
+	// Work out which argument each word belongs to
+	keyword_args := map[string]CommandArg{}
+	positional_args := []CommandArg{}
+	for _, arg := range command.allArgs() {
+		if len(arg.Keywords) == 0 {
+			positional_args = append(positional_args, arg)
+		}
+		for _, keyword := range arg.Keywords {
+			keyword_args[keyword] = arg
+		}
+	}
+
+	positional := []string{}
+	given := map[string][]string{}
+	keywords := map[string]string{}
+	current := ""
+
+	for i, word := range words[1:] {
+		lower := strings.ToLower(word)
+
+		if arg, ok := keyword_args[lower]; ok {
+			if _, seen := given[arg.Name]; seen {
+				return command, nil, command.usageError(
+					fmt.Sprintf("You've given *%v* more than once", lower))
+			}
+			given[arg.Name] = []string{}
+			keywords[arg.Name] = lower
+			current = arg.Name
+
+			if arg.Type == ARG_NOTE {
+				given[arg.Name] = words[i+2:]
+				break
+			}
+			continue
+		}
+
+		if current == "" {
+			positional = append(positional, word)
+		} else {
+			given[current] = append(given[current], word)
+		}
+	}
+
+	args := CommandArgs{}
+
+	// Positional arguments
+	remaining := strings.Join(positional, " ")
+	for i, arg := range positional_args {
+		value := remaining
+		remaining = ""
+		if arg.Type == ARG_RESOURCE && i+1 < len(positional_args) {
+			// Only the last resource in a list can run in to the next argument
+			list := ""
+			if arg.Multiple {
+				if comma := strings.LastIndex(value, ","); comma >= 0 {
+					list, value = value[:comma+1], value[comma+1:]
+				}
+			}
+			value, remaining = splitResourceAndTime(value)
+			value = list + value
+		}
+
+		value = arg.value(value)
+		if value == "" {
+			if !arg.Optional {
+				return command, nil, command.usageError(
+					fmt.Sprintf("You're missing the *%v*", arg.Name))
+			}
+			continue
+		}
+
+		args[arg.Name] = value
+	}
+	if remaining != "" {
+		return command, nil, command.usageError(
+			fmt.Sprintf("I didn't expect *%v*", strings.ToLower(remaining)))
+	}
+
+	// Keyword arguments
+	for _, arg := range command.Args {
+		if len(arg.Keywords) == 0 {
+			continue
+		}
+
+		_, has_arg := given[arg.Name]
+		has_or := false
+		if arg.Or != nil {
+			_, has_or = given[arg.Or.Name]
+		}
+
+		switch {
+
+		case has_arg && has_or:
+			return command, nil, command.usageError(fmt.Sprintf(
+				"Give either *%v* or *%v*, not both",
+				keywords[arg.Name],
+				keywords[arg.Or.Name]))
+
+		case !has_arg && !has_or:
+			if !arg.Optional {
+				names := fmt.Sprintf("*%v*", arg.Name)
+				if arg.Or != nil {
+					names += fmt.Sprintf(" or *%v*", arg.Or.Name)
+				}
+				return command, nil, command.usageError(
+					fmt.Sprintf("You're missing the %v", names))
+			}
+			continue
+
+		case has_or:
+			arg = *arg.Or
+
+		}
+
+		value := strings.Join(given[arg.Name], " ")
+		if value == "" {
+			return command, nil, command.usageError(fmt.Sprintf(
+				"You're missing the *%v* after *%v*",
+				arg.Name,
+				keywords[arg.Name]))
+		}
+
+		args[arg.Name] = arg.value(value)
+	}
+
+	return command, args, nil
+
+}
+
+func (a CommandArg) value(text string) string {
+
+	switch a.Type {
+
+	case ARG_USER, ARG_NOTE:
+		return text
+
+	case ARG_RESOURCE:
+		if !a.Multiple {
+			return resolveResourceName(strings.ToLower(text))
+		}
+
+		names := []string{}
+		seen := map[string]bool{}
+		for _, name := range strings.Split(text, ",") {
+			name = resolveResourceName(normalizeResourceName(name))
+			if name != "" && !seen[name] {
+				names = append(names, name)
+				seen[name] = true
+			}
+		}
+		return strings.Join(names, ", ")
+
+	}
+
+	return strings.ToLower(text)
+
+}
+
+// Splits the value of a `Multiple` argument into its parts
+func (a CommandArgs) List(name string) []string {
+
+	if a[name] == "" {
+		return []string{}
+	}
+
+	return strings.Split(a[name], ", ")
+
+}
+
+// The command's arguments, including alternatives
+func (c Command) allArgs() []CommandArg {
+
+	args := []CommandArg{}
+	for _, arg := range c.Args {
+		args = append(args, arg)
+		if arg.Or != nil {
+			args = append(args, *arg.Or)
+		}
+	}
+
+	return args
+
+}
+
+// How the command is used, e.g.
+//
+//	/reservations reserve (resource) [start time] [for (duration) | until (end time)]
+func (c Command) Usage() string {
+
+	parts := []string{"/reservations", c.Name}
+	for _, arg := range c.Args {
+		text := arg.usage()
+		if arg.Or != nil {
+			text += " | " + arg.Or.usage()
+		}
+		if arg.Optional {
+			text = "[" + text + "]"
+		}
+		parts = append(parts, text)
+	}
+
+	return strings.Join(parts, " ")
+
+}
+
+func (a CommandArg) usage() string {
+
+	text := fmt.Sprintf("(%v)", a.Name)
+	if a.Multiple {
+		text = fmt.Sprintf("(%v[, %v...])", a.Name, a.Name)
+	}
+	if a.Optional && len(a.Keywords) == 0 {
+		text = a.Name
+	}
+	if len(a.Keywords) > 0 {
+		text = a.Keywords[0] + " " + text
+	}
+
+	return text
+
+}
+
+func (c Command) usageError(message string) error {
+
+	return errors.New(fmt.Sprintf("%v\n\nUsage: `%v`", message, c.Usage()))
+
+}
+
+// The command as described by `/reservations help`
+func (c Command) HelpCommand(example_resource string) helpCommand {
+
+	help := helpCommand{
+		Name:        c.Name,
+		Description: c.Description,
+		Usage:       []string{c.Usage()},
+	}
+	if len(c.Aliases) > 0 {
+		help.Alias = c.Aliases[0]
+	}
+	for _, example := range c.Examples {
+		help.Usage = append(help.Usage, "/reservations "+fmt.Sprintf(example, example_resource))
+	}
+
+	return help
+
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestParseCommand(t *testing.T) {
+
+	defer useResources("production, staging, big box")()
+
+	test_cases := map[string]struct {
+		Command string
+		Args    CommandArgs
+	}{
+		"help":                                {"help", CommandArgs{}},
+		"ls":                                  {"list", CommandArgs{}},
+		"LIST":                                {"list", CommandArgs{}},
+		"reserve staging":                     {"reserve", CommandArgs{"resource": "staging"}},
+		"reserve staging for 2 hours":         {"reserve", CommandArgs{"resource": "staging", "duration": "2 hours"}},
+		"reserve big box tomorrow 2pm for 1h": {"reserve", CommandArgs{"resource": "big box", "start time": "tomorrow 2pm", "duration": "1h"}},
+		"reserve Staging until Friday":        {"reserve", CommandArgs{"resource": "staging", "end time": "friday"}},
+		"reserve staging,big box , STAGING tomorrow 2pm": {"reserve", CommandArgs{"resource": "staging, big box", "start time": "tomorrow 2pm"}},
+		"extend staging by 30 mins":                      {"extend", CommandArgs{"resource": "staging", "duration": "30 mins"}},
+		"extend staging until 6pm":                       {"extend", CommandArgs{"resource": "staging", "end time": "6pm"}},
+		"cancel big box":                                 {"cancel", CommandArgs{"resource": "big box"}},
+		"queue staging":                                  {"queue", CommandArgs{"resource": "staging"}},
+		"history staging since 2d":                       {"history", CommandArgs{"resource": "staging", "time ago": "2d"}},
+		"stats":                                          {"stats", CommandArgs{}},
+		"stats past 7 days":                              {"stats", CommandArgs{"time": "7 days"}},
+		"admin rename-resource a b":                      {"admin", CommandArgs{"command": "rename-resource a b"}},
+		"reassign staging to <@UBOB|bob>":                {"reassign", CommandArgs{"resource": "staging", "user": "<@UBOB|bob>"}},
+		"reserve staging for 2 hours -- Testing PR #4312 for Bob": {"reserve", CommandArgs{"resource": "staging", "duration": "2 hours", "note": "Testing PR #4312 for Bob"}},
+		"note staging — fixing OPS-12":                            {"note", CommandArgs{"resource": "staging", "note": "fixing OPS-12"}},
+		"note staging":                                            {"note", CommandArgs{"resource": "staging"}},
+	}
+
+	for text, expected := range test_cases {
+		command, args, err := parseCommand(text)
+		if err != nil {
+			t.Error(text, ": expected no error, got", err)
+			continue
+		}
+
+		if command.Name != expected.Command {
+			t.Error(text, ": expected", expected.Command, "got", command.Name)
+		}
+
+		if len(args) != len(expected.Args) {
+			t.Error(text, ": expected", expected.Args, "got", args)
+			continue
+		}
+		for name, value := range expected.Args {
+			if args[name] != value {
+				t.Error(text, ": expected", expected.Args, "got", args)
+				break
+			}
+		}
+	}
+
+}
+
+func TestParseCommandErrors(t *testing.T) {
+
+	defer useResources("production, staging")()
+
+	test_cases := map[string]string{
+		"":                                 "What would you like to do",
+		"reserv staging":                   "I don't know the command \\*reserv\\*",
+		"reserve":                          "You're missing the \\*resource\\*\n\nUsage: `/reservations reserve \\(resource\\[, resource...\\]\\) \\[start time\\] \\[for \\(duration\\) \\| until \\(end time\\)\\] \\[-- \\(note\\)\\]`",
+		"extend staging":                   "You're missing the \\*duration\\* or \\*end time\\*",
+		"extend staging by":                "You're missing the \\*duration\\* after \\*by\\*",
+		"reserve staging for 1h until 5pm": "Give either \\*for\\* or \\*until\\*, not both",
+		"reserve staging for 1h for 2h":    "You've given \\*for\\* more than once",
+		"list everything":                  "I didn't expect \\*everything\\*\n\nUsage: `/reservations list`",
+		"reassign staging":                 "You're missing the \\*user\\*",
+	}
+
+	for text, pattern := range test_cases {
+		_, _, err := parseCommand(text)
+		if err == nil {
+			t.Error(text, ": expected an error, got none")
+			continue
+		}
+		if !regexp.MustCompile(pattern).MatchString(err.Error()) {
+			t.Errorf("%v: expected %q to match /%v/", text, err.Error(), pattern)
+		}
+	}
+
+}
+
+func TestMainHandler(t *testing.T) {
+
+	//
+	// Setup
+	//
+
+	defer useResources("production, staging")()
+
+	defer useTempStore()()
+
+	run := func(text string) string {
+		body := url.Values{"user_id": {"Ualice"}, "user_name": {"alice"}, "text": {text}}.Encode()
+		recorder := httptest.NewRecorder()
+		MainHandler(recorder, httptest.NewRequest(
+			"POST", "/slack/commands/reservations", strings.NewReader(body)))
+		return recorder.Body.String()
+	}
+
+	//
+	// Test
+	//
+
+	t.Run("Command", func(t *testing.T) {
+
+		if actual := run("reserve staging for 1 hour"); !strings.Contains(actual, "successfully reserved") {
+			t.Error("expected a reservation, got", actual)
+		}
+
+	})
+
+	t.Run("ParseError", func(t *testing.T) {
+
+		if actual := run("extend staging"); !strings.Contains(actual, "missing the *duration*") {
+			t.Error("expected a usage error, got", actual)
+		}
+
+	})
+
+	t.Run("Help", func(t *testing.T) {
+
+		actual := run("help")
+		for _, command := range registeredCommands() {
+			if strings.Contains(actual, command.Usage()) == command.AdminOnly {
+				t.Error("expected only non-admin commands in the help, got", actual)
+			}
+		}
+
+	})
+
+}
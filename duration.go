@@ -0,0 +1,120 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A unit that durations can be given in, and the ways it can be written
+type durationUnit struct {
+	Name     string
+	Aliases  []string
+	Duration time.Duration
+}
+
+var duration_units = []durationUnit{
+	{"minute", []string{"m", "min", "mins", "minute", "minutes"}, time.Minute},
+	{"hour", []string{"h", "hr", "hrs", "hour", "hours"}, time.Hour},
+	{"day", []string{"d", "day", "days"}, 24 * time.Hour},
+	{"week", []string{"w", "wk", "wks", "week", "weeks"}, 7 * 24 * time.Hour},
+}
+
+// One "<number> <unit>" part of a duration, e.g. "1.5 hours" or the "30m" in
+// "1h30m". "a" or "an" count as one.
+var duration_part_regex = regexp.MustCompile("\\A(\\d+(?:\\.\\d+)?|\\.\\d+|an?\\b) ?([a-z]+)")
+
+// Words that can go between the parts of a duration
+var duration_filler_regex = regexp.MustCompile("\\A(?:,|and\\b| )+")
+
+// Parses a duration the way people tend to type it in to Slack, e.g.
+//
+//	30 mins, 2 hours, 1 day, 2 weeks
+//	1.5 hours, 1h30m, 1 hour 30 minutes, 1 day and 2 hours
+//
+// Units can be abbreviated, singular or plural (see `duration_units`).
+func parseDurationText(text string) (time.Duration, error) {
+
+	remaining := strings.Join(strings.Fields(strings.ToLower(text)), " ")
+	invalid := errors.New(fmt.Sprintf(
+		"I don't understand the duration *%v*. Try e.g. *2 hours*, *1.5 days* or *1h30m*",
+		text))
+
+	if remaining == "" {
+		return 0, invalid
+	}
+
+	// Add up in floating point, so a huge duration can't wrap around
+	total := 0.0
+
+	for remaining != "" {
+		matches := duration_part_regex.FindStringSubmatch(remaining)
+		if matches == nil {
+			return 0, invalid
+		}
+
+		value := 1.0
+		if !strings.HasPrefix(matches[1], "a") {
+			value, _ = strconv.ParseFloat(matches[1], 64)
+		}
+
+		unit, ok := findDurationUnit(matches[2])
+		if !ok {
+			return 0, errors.New(fmt.Sprintf(
+				"I don't understand the duration *%v*, since I don't know the unit *%v*. "+
+					"Try %v",
+				text,
+				matches[2],
+				durationUnitsToString()))
+		}
+
+		total += value * float64(unit.Duration)
+
+		remaining = remaining[len(matches[0]):]
+		remaining = duration_filler_regex.ReplaceAllString(remaining, "")
+	}
+
+	if total >= math.MaxInt64 {
+		return 0, errors.New(fmt.Sprintf(
+			"*%v* is too long a duration", text))
+	}
+
+	duration := time.Duration(total).Round(time.Second)
+	if duration <= 0 {
+		return 0, errors.New(fmt.Sprintf(
+			"*%v* is too short a duration. Try e.g. *30 minutes*", text))
+	}
+
+	return duration, nil
+
+}
+
+func findDurationUnit(alias string) (durationUnit, bool) {
+
+	for _, unit := range duration_units {
+		for _, a := range unit.Aliases {
+			if a == alias {
+				return unit, true
+			}
+		}
+	}
+
+	return durationUnit{}, false
+
+}
+
+// Describes the units `parseDurationText()` understands, for the help text
+func durationUnitsToString() string {
+
+	names := []string{}
+	for _, unit := range duration_units {
+		names = append(names, fmt.Sprintf("\"%vs\"", unit.Name))
+	}
+
+	return strings.Join(names[:len(names)-1], ", ") + " and " + names[len(names)-1]
+
+}
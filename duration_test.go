@@ -0,0 +1,88 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseDurationText(t *testing.T) {
+
+	test_cases := map[string]time.Duration{
+		"30 mins":                 30 * time.Minute,
+		"1 minute":                time.Minute,
+		"2 hours":                 2 * time.Hour,
+		"2 HRS":                   2 * time.Hour,
+		"1 day":                   24 * time.Hour,
+		"2d":                      48 * time.Hour,
+		"1 week":                  7 * 24 * time.Hour,
+		"2 wks":                   14 * 24 * time.Hour,
+		"1.5 hours":               90 * time.Minute,
+		".5h":                     30 * time.Minute,
+		"an hour":                 time.Hour,
+		"a day":                   24 * time.Hour,
+		"1h30m":                   90 * time.Minute,
+		"1d12h":                   36 * time.Hour,
+		"1 hour 30 minutes":       90 * time.Minute,
+		"1 hour and 30 minutes":   90 * time.Minute,
+		"1 day, 2 hours":          26 * time.Hour,
+		"1  hour   30 mins":       90 * time.Minute,
+		"1 week 1 day 1 hour 1 m": (8*24+1)*time.Hour + time.Minute,
+	}
+
+	for text, expected := range test_cases {
+		actual, err := parseDurationText(text)
+		if err != nil {
+			t.Error(text, ": expected no error, got", err)
+			continue
+		}
+
+		if actual != expected {
+			t.Error(text, ": expected", expected, "got", actual)
+		}
+	}
+
+}
+
+func TestParseDurationTextErrors(t *testing.T) {
+
+	test_cases := []string{
+		"",
+		"2",
+		"hours",
+		"2 fortnights",
+		"2 hours ago",
+		"1h30",
+		"1..5 hours",
+		"-1 hour",
+		"0 mins",
+		"0.1 seconds",
+		"99999999999 weeks",
+	}
+
+	for _, text := range test_cases {
+		actual, err := parseDurationText(text)
+		if err == nil {
+			t.Error(text, ": expected an error, got", actual)
+		}
+	}
+
+}
+
+func TestDurationUnitsToString(t *testing.T) {
+
+	expected := `"minutes", "hours", "days" and "weeks"`
+	if actual := durationUnitsToString(); actual != expected {
+		t.Error("expected", expected, "got", actual)
+	}
+
+}
+
+func TestParseDurationTextUnknownUnit(t *testing.T) {
+
+	_, err := parseDurationText("2 hourz")
+	if err == nil || !strings.Contains(err.Error(), "I don't know the unit *hourz*") {
+		t.Error("expected an unknown unit error, got", err)
+	}
+
+}
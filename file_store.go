@@ -0,0 +1,236 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var reservations_dir = "/tmp"
+var reservations_file = filepath.Join(reservations_dir, "reservations.json")
+
+// Serializes access to the reservations file between goroutines in this
+// process. Access between processes is serialized with `flock()` on a
+// separate lock file (see `lockReservationsFile()`)
+var file_store_mutex sync.Mutex
+
+// FileStore keeps all reservations in a single JSON file at
+// `reservations_file`, and waitlists alongside it in `waitlists_file`. The
+// history is appended to `history_file`, one event per line. Every
+// operation re-reads the files so that changes made outside this process are
+// always picked up.
+type FileStore struct{}
+
+func (fs *FileStore) Load() error {
+
+	log.Debug("Ensuring file exists...")
+	err := ensureReservationsFileExists()
+	if err != nil {
+		return err
+	}
+
+	catalog, err := NewResourceCatalog()
+	if err != nil {
+		return err
+	}
+
+	useCatalog(catalog.ResourceConfig)
+	return nil
+
+}
+
+func (fs *FileStore) Get(resource string) (Reservation, error) {
+
+	reservations, err := fs.List()
+	if err != nil {
+		return Reservation{}, err
+	}
+
+	return reservations.FindByResource(resource), nil
+
+}
+
+func (fs *FileStore) Upsert(resource string, reservation Reservation) error {
+
+	return fs.Update(func(tx *StoreTx) error {
+		return tx.Reservations.Upsert(resource, reservation)
+	})
+
+}
+
+func (fs *FileStore) Delete(resource string, reservation Reservation) error {
+
+	return fs.Update(func(tx *StoreTx) error {
+		return tx.Reservations.Delete(resource, reservation)
+	})
+
+}
+
+func (fs *FileStore) List() (Reservations, error) {
+
+	file_store_mutex.Lock()
+	defer file_store_mutex.Unlock()
+
+	unlock, err := lockReservationsFile(syscall.LOCK_SH)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	return NewReservations()
+
+}
+
+func (fs *FileStore) Update(fn func(tx *StoreTx) error) error {
+
+	file_store_mutex.Lock()
+	defer file_store_mutex.Unlock()
+
+	unlock, err := lockReservationsFile(syscall.LOCK_EX)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	reservations, err := NewReservations()
+	if err != nil {
+		return err
+	}
+
+	waitlists, err := NewWaitlists()
+	if err != nil {
+		return err
+	}
+
+	catalog, err := NewResourceCatalog()
+	if err != nil {
+		return err
+	}
+
+	tx := &StoreTx{
+		Reservations:  reservations,
+		Waitlists:     waitlists,
+		Catalog:       catalog.ResourceConfig,
+		CatalogSource: catalog.Source,
+	}
+
+	err = fn(tx)
+	if err == ErrRollback {
+		useCatalog(catalog.ResourceConfig)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	err = tx.Reservations.WriteToFile()
+	if err != nil {
+		return err
+	}
+
+	err = tx.Waitlists.WriteToFile()
+	if err != nil {
+		return err
+	}
+
+	// The changes are saved by now, so failing here would only tell the user
+	// they weren't. History is best effort, and can miss events if it can't
+	// be written.
+	err = appendHistoryFile(tx.Events)
+	if err != nil {
+		log.Errorf("Could not record %v history events: %v", len(tx.Events), err)
+	}
+
+	// Don't create the catalog until there's something in it
+	if len(tx.Catalog.Resources) == 0 && len(catalog.Resources) == 0 {
+		return nil
+	}
+
+	err = SavedCatalog{tx.Catalog, tx.CatalogSource}.WriteToFile()
+	if err != nil {
+		return err
+	}
+
+	useCatalog(tx.Catalog)
+	return nil
+
+}
+
+func (fs *FileStore) History(resource string, since time.Time) ([]HistoryEvent, error) {
+
+	file_store_mutex.Lock()
+	defer file_store_mutex.Unlock()
+
+	unlock, err := lockReservationsFile(syscall.LOCK_SH)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	events, err := readHistoryFile()
+	if err != nil {
+		return nil, err
+	}
+
+	return filterHistory(events, resource, since), nil
+
+}
+
+// Takes an advisory lock (`syscall.LOCK_SH` or `syscall.LOCK_EX`) on the
+// reservations lock file, blocking until it's available. The returned
+// function releases the lock.
+func lockReservationsFile(how int) (func(), error) {
+
+	lock_file := reservations_file + ".lock"
+
+	f, err := os.OpenFile(lock_file, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		log.Errorf("Could not open lock file %v", lock_file)
+		return nil, err
+	}
+
+	err = syscall.Flock(int(f.Fd()), how)
+	if err != nil {
+		log.Errorf("Could not lock file %v", lock_file)
+		f.Close()
+		return nil, err
+	}
+
+	unlock := func() {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}
+
+	return unlock, nil
+
+}
+
+func ensureReservationsFileExists() error {
+
+	var err error
+
+	// Create directory if it does not exist
+	_, err = os.Stat(reservations_dir)
+	if err != nil && os.IsNotExist(err) {
+		err = os.MkdirAll(reservations_dir, 0775)
+
+		if err != nil {
+			log.Debugf("Error creating directory %v", reservations_dir)
+			return err
+		}
+	}
+
+	// Create file if it does not exist
+	_, err = os.Stat(reservations_file)
+	if err != nil && os.IsNotExist(err) {
+		err = writeFileAtomically(reservations_file, []byte("{}"), 0644)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+
+}
@@ -7,33 +7,11 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/url"
-	"os"
-	"path/filepath"
 	"regexp"
-	"strconv"
+	"strings"
 	"time"
 )
 
-var unit_standardization_mapping = map[string]string{
-	"min":     "minute",
-	"mins":    "minute",
-	"minute":  "minute",
-	"minutes": "minute",
-	"hr":      "hour",
-	"hrs":     "hour",
-	"hour":    "hour",
-	"hours":   "hour",
-}
-
-var reservations_dir = "/tmp"
-var reservations_file = filepath.Join(reservations_dir, "reservations.json")
-
-var subcmd_help_regex = regexp.MustCompile("\\Ahelp\\z")
-var subcmd_show_regex = regexp.MustCompile("\\A(list|ls)\\z")
-var subcmd_create_regex = regexp.MustCompile("\\Areserve (.*) for (\\d*) (mins?|minutes?|hrs?|hours?)\\z")
-var subcmd_update_regex = regexp.MustCompile("\\Aextend (.*) by (\\d*) (mins?|minutes?|hrs?|hours?)\\z")
-var subcmd_destroy_regex = regexp.MustCompile("\\Acancel (.*)\\z")
-
 func MainHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Parse incoming slack request data
@@ -43,53 +21,26 @@ func MainHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check validity of slack verification token
-	if !isValidSlackVerificationToken(slack_request) {
-		log.Errorf("Invalid Slack token %v", maskToken(slack_request.Token))
-		buildInvalidResponse(w)
-		return
-	}
-
-	// Create reservations file if it doesn't exist
-	log.Debug("Ensuring file exists...")
-	err = ensureReservationsFileExists()
+	// Make sure the reservations store is ready to be read from
+	err = store.Load()
 	if err != nil {
+		log.Error(err)
 		buildErrorResponse(w)
 		return
 	}
 
-	// Call appropriate command handler
-	command := slack_request.FormattedSubcommand()
-	var slack_response SlackResponse
-	var success bool
-
-	switch {
-
-	case subcmd_help_regex.MatchString(command):
-		log.Debug("Handling command: `help`")
-		slack_response, success = handleCommandHelp(slack_request)
-
-	case subcmd_show_regex.MatchString(command):
-		log.Debug("Handling command: `show`")
-		slack_response, success = handleCommandShow(slack_request)
-
-	case subcmd_create_regex.MatchString(command):
-		log.Debug("Handling command: `create`")
-		slack_response, success = handleCommandCreate(slack_request)
-
-	case subcmd_update_regex.MatchString(command):
-		log.Debug("Handling command: `update`")
-		slack_response, success = handleCommandUpdate(slack_request)
-
-	case subcmd_destroy_regex.MatchString(command):
-		log.Debug("Handling command: `destroy`")
-		slack_response, success = handleCommandDestroy(slack_request)
-
-	default:
-		buildErrorResponse(w)
+	// Work out which command it is and check its arguments, so that the user
+	// can be told exactly what's wrong
+	command, args, err := parseCommand(slack_request.Text)
+	if err != nil {
+		log.Debugf("Couldn't parse command %q: %v", slack_request.Text, err)
+		buildResponse(SlackResponse{Text: err.Error()}, w)
 		return
 	}
 
+	log.Debugf("Handling command: `%v`", command.Name)
+	slack_response, success := command.Handler(slack_request, args)
+
 	if !success {
 		buildErrorResponse(w)
 		return
@@ -99,12 +50,6 @@ func MainHandler(w http.ResponseWriter, r *http.Request) {
 
 }
 
-func isValidSlackVerificationToken(s SlackRequest) bool {
-
-	return os.Getenv("SLACK_VERIFICATION_TOKEN") == s.Token
-
-}
-
 func parseSlackRequest(r *http.Request) (SlackRequest, error) {
 
 	var err error
@@ -166,39 +111,48 @@ curl -XPOST \
      http://localhost:8080/slack/commands/reservations
 
 */
-func handleCommandHelp(slack_request SlackRequest) (SlackResponse, bool) {
+func handleCommandHelp(slack_request SlackRequest, args CommandArgs) (SlackResponse, bool) {
 
 	resources := ListOfResources()
-	example_resource := resources[0]
-
-	help_text := `
-
-I'm a basic reservations system for shared resources
-
-You can use me to reserve any of the following: ` + ListOfResourcesToString() + `
-
-*list* (or *ls*) - List reservations
-` + "`/reservations list`" + `
-
-*reserve* - Create a new reservation
-` + "`/reservations reserve (resource) for (duration)`" + `
-` + fmt.Sprintf("`/reservations reserve %v for 3 hours`", example_resource) + `
-
-*extend* - Extend an existing reservation
-` + "`/reservations extend (resource) by (duration)`" + `
-` + fmt.Sprintf("`/reservations extend %v by 20 mins`", example_resource) + `
-
-*cancel* - Cancel an existing reservation
-` + "`/reservations cancel (resource)`" + `
-` + fmt.Sprintf("`/reservations cancel %v`", example_resource) + `
 
+	intro := "I'm a basic reservations system for shared resources"
+	available := "You can use me to reserve any of the following: " +
+		ListOfResourcesToString()
+	if groups := currentResourceConfig().GroupNames(); len(groups) > 0 {
+		available += fmt.Sprintf(
+			"\nor whichever is free in a group, like `reserve any %v`: [%v]",
+			groups[0],
+			strings.Join(groups, ", "))
+	}
+	hint := fmt.Sprintf(
+		`_Psst...I understand %v - abbreviated, singular, plural, with decimals or combined, like "1.5 hours" or "1h30m"_`,
+		durationUnitsToString())
+
+	is_admin := isAdmin(slack_request)
+	commands := []helpCommand{}
+	for _, command := range registeredCommands() {
+		if command.AdminOnly && !is_admin {
+			continue
+		}
+		commands = append(commands, command.HelpCommand(resources[0]))
+	}
 
-_Psst...I understand "minutes" and "hours" - abbreviated, singular, or plural_
-
+	help_text := "\n\n" + intro + "\n\n" + available + "\n\n"
+	for _, command := range commands {
+		help_text += command.ToString() + "\n\n"
+	}
+	help_text += "\n" + hint + "\n\n\n"
 
-`
+	blocks := []Block{
+		NewSectionBlock(intro + "\n" + available),
+		NewDividerBlock(),
+	}
+	for _, command := range commands {
+		blocks = append(blocks, NewSectionBlock(command.ToString()))
+	}
+	blocks = append(blocks, NewContextBlock(hint))
 
-	return SlackResponse{Text: help_text}, true
+	return SlackResponse{Text: help_text, Blocks: blocks}, true
 
 }
 
@@ -211,36 +165,101 @@ curl -XPOST \
      http://localhost:8080/slack/commands/reservations
 
 */
-func handleCommandShow(slack_request SlackRequest) (SlackResponse, bool) {
+func handleCommandShow(slack_request SlackRequest, args CommandArgs) (SlackResponse, bool) {
 
 	response := SlackResponse{}
 
-	// Find all reservations
-	reservations, err := NewReservations()
+	// Find all reservations and waitlists. This runs as an update so that
+	// any resources that have freed up get handed to whoever is next in line
+	// before being listed.
+	var reservations Reservations
+	var waitlists Waitlists
+	var promotions []Promotion
+	err := store.Update(func(tx *StoreTx) error {
+		promotions = promoteWaitlists(tx)
+
+		reservations = tx.Reservations
+		waitlists = tx.Waitlists
+
+		if len(promotions) == 0 {
+			return ErrRollback
+		}
+		return nil
+	})
 	if err != nil {
 		log.Error(err)
 		return response, false
 	}
 
+	sendNotificationsInBackground(promotionNotifications(promotions))
+
 	response_text := "\n_*Reservations*_\n\n"
 
-	for _, resource := range ListOfResources() {
+	for _, listing := range currentResourceConfig().Listing() {
 
-		reservation := reservations[resource]
-		if (reservation != Reservation{}) && reservation.IsActive() {
-			response_text += fmt.Sprintf(
-				"→  %v (reserved by %v, expires in %v)\n",
-				resource,
-				reservation.User,
-				reservation.RemainingTimeToString())
-		} else {
+		if listing.Group != "" {
 			response_text += fmt.Sprintf(
-				"→  %v (free)\n",
-				resource)
+				"\n_%v_\n",
+				listing.Heading(reservations))
+		}
+
+		for _, config := range listing.Resources {
+
+			resource := config.Name
+			reservation := reservations.FindByResource(resource)
+			if config.Slots() > 1 {
+				active := reservations[resource].Active()
+				response_text += fmt.Sprintf(
+					"→  %v (%v/%v slots used)\n",
+					resource,
+					len(active),
+					config.Slots())
+				for _, holder := range active {
+					response_text += fmt.Sprintf(
+						"      reserved by %v, expires in %v%v\n",
+						holder.Mention(),
+						holder.RemainingTimeToString(),
+						noteText(holder))
+				}
+			} else if reservation.IsPresent() && reservation.IsActive() {
+				response_text += fmt.Sprintf(
+					"→  %v (reserved by %v, expires in %v)%v\n",
+					resource,
+					reservation.Mention(),
+					reservation.RemainingTimeToString(),
+					noteText(reservation))
+			} else {
+				response_text += fmt.Sprintf(
+					"→  %v (free)\n",
+					resource)
+			}
+
+			for _, upcoming := range reservations[resource].Upcoming() {
+				response_text += fmt.Sprintf(
+					"      booked by %v for %v%v\n",
+					upcoming.Mention(),
+					upcoming.PeriodToString(),
+					noteText(upcoming))
+			}
+
+			if waitlist := waitlists[resource]; len(waitlist) > 0 {
+				response_text += fmt.Sprintf(
+					"      waitlist: %v\n",
+					waitlistToString(waitlist))
+			}
 		}
 	}
 
+	// Resources removed from the configuration while reserved
+	for _, resource := range reservations.Orphaned() {
+		response_text += fmt.Sprintf(
+			"⚠  %v (no longer available, %v)\n",
+			resource,
+			orphanedReservationText(reservations[resource]))
+	}
+
 	response.Text = response_text
+	response.Blocks = listBlocks(reservations, waitlists, slack_request.User())
 	return response, true
 
 }
@@ -254,70 +273,159 @@ curl -XPOST \
      http://localhost:8080/slack/commands/reservations
 
 */
-func handleCommandCreate(slack_request SlackRequest) (SlackResponse, bool) {
+func handleCommandCreate(slack_request SlackRequest, args CommandArgs) (SlackResponse, bool) {
 
-	command := slack_request.FormattedSubcommand()
 	response := SlackResponse{}
 
 	// Extract data from command
-	matches := subcmd_create_regex.FindStringSubmatch(command)
-	resource := matches[1]
-	time_value := matches[2]
-	unit := matches[3]
-
-	// If an active reservation already exists against this resource, don't
-	// allow a new reservation
-	reservations, err := NewReservations()
-	if err != nil {
-		log.Error(err)
-		return response, false
+	resources := args.List("resource")
+	resource := args["resource"]
+	start_text := args["start time"]
+	until := args["end time"] != ""
+	duration_text := args["duration"]
+	if until {
+		duration_text = args["end time"]
 	}
+	note := args["note"]
+
+	// Check that the resources are valid and can be reserved from here.
+	// "any qa" can be any resource in the qa group that can be.
+	candidates := map[string][]Resource{}
+	for _, name := range resources {
+		if group, ok := anyGroupName(name); ok {
+			members, text := reservableGroupMembers(group, slack_request)
+			if text != "" {
+				response.Text = text
+				return response, true
+			}
+			candidates[name] = members
+			continue
+		}
 
-	reservation := reservations.FindByResource(resource)
-	if reservation.IsPresent() && reservation.IsActive() {
-		if slack_request.UserName == reservation.User {
-			response.Text = fmt.Sprintf(
-				"You've already reserved \"*%v*\" for the next *%v*",
-				resource,
-				reservation.RemainingTimeToString())
-		} else {
+		config, text := reservableResource(name, slack_request)
+		if text != "" {
+			response.Text = text
+			return response, true
+		}
+		candidates[name] = []Resource{config}
+	}
+
+	// Without a start time the reservation starts right away. Times are
+	// read in the user's own time zone.
+	location := userLocation(slack_request.UserId)
+	now := time.Now().In(location)
+	start_at := now
+	if start_text != "" {
+		var err error
+		start_at, err = parseWallClockTime(start_text, now)
+		if err != nil {
 			response.Text = fmt.Sprintf(
-				"%v has reserved \"*%v*\" for the next *%v*",
-				reservation.User,
+				"I couldn't work out when you'd like to reserve "+
+					"\"*%v*\" from. %v",
 				resource,
-				reservation.RemainingTimeToString())
+				err)
+			return response, true
 		}
-
-		return response, true
 	}
 
-	// Transform value and units into formats we can work with
-	time_value_int, err := strconv.Atoi(time_value)
-	if err != nil {
-		log.Error(err)
-		return response, false
+	// Transform the duration, or the time it should last until, into one we
+	// can work with. Without either, each resource's default is used. "any
+	// qa" only picks from the group members that can be reserved for that
+	// long.
+	durations := map[string]time.Duration{}
+	for _, name := range resources {
+		eligible := []Resource{}
+		refusals := []string{}
+		for _, config := range candidates[name] {
+			var duration time.Duration
+			if until {
+				end_at, err := parseEndTime(duration_text, start_at)
+				if err != nil {
+					response.Text = fmt.Sprintf(
+						"I couldn't work out when you'd like to reserve "+
+							"\"*%v*\" until. %v",
+						resource,
+						err)
+					return response, true
+				}
+				if !end_at.After(start_at) {
+					response.Text = fmt.Sprintf(
+						"\"*%v*\" can't be reserved until *%v*, as that's "+
+							"before the reservation would start",
+						resource,
+						duration_text)
+					return response, true
+				}
+				duration = end_at.Sub(start_at)
+			} else {
+				var err error
+				duration, err = requestedDuration(config, duration_text)
+				if err != nil {
+					response.Text = err.Error()
+					return response, true
+				}
+			}
+			if duration == 0 {
+				refusals = append(refusals, missingDurationText("reserve", resource))
+				continue
+			}
+			if err := config.CheckDuration(duration); err != nil {
+				refusals = append(refusals, err.Error())
+				continue
+			}
+			durations[config.Name] = duration
+			eligible = append(eligible, config)
+		}
+		if len(eligible) == 0 {
+			response.Text = refusals[0]
+			return response, true
+		}
+		candidates[name] = eligible
 	}
-	unit = unit_standardization_mapping[unit]
 
-	// Calculate a new endAt
-	hours := 0
-	minutes := 0
-	if unit == "hour" {
-		hours = time_value_int
+	if _, is_group := anyGroupName(resource); len(resources) > 1 || is_group {
+		return reserveAll(
+			slack_request, resources, candidates, start_at, start_text == "", durations, note, location)
 	}
-	if unit == "minute" {
-		minutes = time_value_int
+
+	duration := durations[resource]
+
+	// The queue button can only offer a duration
+	if until {
+		duration_text = formatConfigDuration(duration)
 	}
 
-	endAt := time.Now().Add(
-		time.Hour*time.Duration(hours) + time.Minute*time.Duration(minutes),
-	)
+	// Check for an existing reservation and create the new one in a single
+	// transaction so that only one of several simultaneous requests for the
+	// same resource can succeed
+	var reservation Reservation
+	var promotion Promotion
+	var promoted bool
+	err := store.Update(func(tx *StoreTx) error {
+
+		// If the resource has freed up and people are waiting for it, the
+		// first in line gets it rather than whoever asks next
+		promotion, promoted = promoteWaitlist(tx, resource)
+
+		pruneExpiredUnlessScheduled(tx)
+
+		var err error
+		reservation, err = reserveResource(
+			tx, slack_request, resource, start_at, duration, start_text == "", note)
+		if isConflictError(err) {
+			reservation = err.(*ConflictError).Conflict
+			response.Text = blockedText(err.(*ConflictError), slack_request, start_text == "")
+			if start_text == "" && reservation.IsActive() && !reservation.IsHeldBy(slack_request.User()) {
+				response.Text += fmt.Sprintf(
+					"\n\nType `/reservations %v` to get in line",
+					queueCommand(resource, duration_text))
+			}
+			return rollbackUnless(promoted)
+		}
 
-	// Create new reservation
-	reservation = Reservation{User: slack_request.UserName, EndAt: endAt}
+		return err
+	})
 
-	// Update
-	err = reservations.Upsert(resource, reservation)
 	if err != nil {
 		if isInvalidResourceError(err) {
 			response.Text = unknownResourceText(resource)
@@ -328,20 +436,147 @@ func handleCommandCreate(slack_request SlackRequest) (SlackResponse, bool) {
 		}
 	}
 
-	// Save to file
-	err = reservations.WriteToFile()
-	if err != nil {
-		log.Error(err)
-		return response, false
+	// Saved even if the resource turned out to be taken
+	if promoted {
+		sendNotificationsInBackground(promotionNotifications([]Promotion{promotion}))
+	}
+
+	// Reservation already exists
+	if response.Text != "" {
+		if reservation.IsActive() && !reservation.IsHeldBy(slack_request.User()) {
+			response = response.WithButtons(
+				queueButton(resource, duration_text))
+		}
+		return response, true
 	}
 
 	// Construct a response for the user
+	return reservedResponse(resource, reservation, location), true
+}
+
+// Tells the user they've got the resource, with buttons to let it go early or
+// keep it for longer
+func reservedResponse(resource string, reservation Reservation, location *time.Location) SlackResponse {
+
+	response := SlackResponse{}
+
+	if reservation.IsUpcoming() {
+		response.Text = fmt.Sprintf(
+			"You've successfully booked \"*%v*\" for *%v*",
+			resource,
+			reservation.PeriodToString())
+		return response.WithButtons(releaseButton(resource))
+	}
+
 	response.Text = fmt.Sprintf(
-		"You've successfully reserved \"*%v*\" for the next *%v*",
+		"You've successfully reserved \"*%v*\" for the next *%v* (until %v)",
 		resource,
-		reservation.RemainingTimeToString())
+		reservation.RemainingTimeToString(),
+		endTimeText(reservation.EndAt, location))
+	return response.WithButtons(extendButton(resource), releaseButton(resource))
+
+}
+
+// Reserves `resource` from `start_at` for `duration` as part of a
+// transaction, with `note` if it isn't empty. If someone already has it,
+// returns a `ConflictError` with the reservation in the way. Reservations
+// that start now are blocked by the current one, even if it's about to end.
+func reserveResource(
+	tx *StoreTx,
+	slack_request SlackRequest,
+	resource string,
+	start_at time.Time,
+	duration time.Duration,
+	starts_now bool,
+	note string) (Reservation, error) {
+
+	if starts_now {
+		if current := tx.Reservations.FindByUser(resource, slack_request.User()); current.IsActive() {
+			return Reservation{}, &ConflictError{Resource: resource, Conflict: current}
+		}
+		if tx.Reservations.IsFull(resource) {
+			current := tx.Reservations.FindByResource(resource)
+			return Reservation{}, &ConflictError{Resource: resource, Conflict: current}
+		}
+	}
+
+	reservation := Reservation{
+		User:    slack_request.UserName,
+		UserId:  slack_request.UserId,
+		TeamId:  slack_request.TeamId,
+		StartAt: start_at,
+		EndAt:   start_at.Add(duration),
+		Note:    note,
+	}
+
+	err := tx.Reservations.Upsert(resource, reservation)
+	if err != nil {
+		return Reservation{}, err
+	}
+
+	event := newHistoryEvent(HISTORY_RESERVE, resource, slack_request, reservation)
+	event.NewEndAt = reservation.EndAt
+	tx.Record(event)
+
+	return reservation, nil
+
+}
+
+// Explains why `reserveResource()` couldn't reserve a resource
+func blockedText(err *ConflictError, slack_request SlackRequest, starts_now bool) string {
+
+	reservation := err.Conflict
+	if !starts_now || !reservation.IsActive() {
+		return conflictText(err)
+	}
+
+	if reservation.IsHeldBy(slack_request.User()) {
+		return fmt.Sprintf(
+			"You've already reserved \"*%v*\" for the next *%v*%v",
+			err.Resource,
+			reservation.RemainingTimeToString(),
+			noteText(reservation))
+	}
+
+	if config, _ := FindResource(err.Resource); config.Slots() > 1 {
+		return fullText(config)
+	}
+
+	return fmt.Sprintf(
+		"%v has reserved \"*%v*\" for the next *%v*%v",
+		reservation.Mention(),
+		err.Resource,
+		reservation.RemainingTimeToString(),
+		noteText(reservation))
+
+}
+
+func fullText(resource Resource) string {
+
+	return fmt.Sprintf(
+		"All *%v* slots on \"*%v*\" are taken. Type `/reservations list` to see who has them",
+		resource.Slots(),
+		resource.Name)
+
+}
+
+// Checks that the resource exists and can be reserved from the channel the
+// request came from. Returns why not if it can't.
+func reservableResource(resource string, slack_request SlackRequest) (Resource, string) {
+
+	config, ok := FindResource(resource)
+	if !ok {
+		return config, unknownResourceText(resource)
+	}
+	if config.Retired {
+		return config, retiredResourceText(resource)
+	}
+	if !config.IsAllowedInChannel(slack_request.ChannelId, slack_request.ChannelName) {
+		return config, channelNotAllowedText(config)
+	}
+
+	return config, ""
 
-	return response, true
 }
 
 /*
@@ -353,16 +588,17 @@ curl -XPOST \
      http://localhost:8080/slack/commands/reservations
 
 */
-func handleCommandUpdate(slack_request SlackRequest) (SlackResponse, bool) {
+func handleCommandUpdate(slack_request SlackRequest, args CommandArgs) (SlackResponse, bool) {
 
-	command := slack_request.FormattedSubcommand()
 	response := SlackResponse{}
 
 	// Extract data from command
-	matches := subcmd_update_regex.FindStringSubmatch(command)
-	resource := matches[1]
-	time_value := matches[2]
-	unit := matches[3]
+	resource := args["resource"]
+	until := args["end time"] != ""
+	duration_text := args["duration"]
+	if until {
+		duration_text = args["end time"]
+	}
 
 	// Check that resource is valid
 	// Upsert() below checks for this, but we want to do it sooner so we
@@ -372,73 +608,103 @@ func handleCommandUpdate(slack_request SlackRequest) (SlackResponse, bool) {
 		return response, true
 	}
 
-	// Find all reservations
-	reservations, err := NewReservations()
-	if err != nil {
-		log.Error(err)
-		return response, false
+	// Transform the duration, or the time it should last until, into one we
+	// can work with. Times are read in the user's own time zone.
+	location := userLocation(slack_request.UserId)
+	var duration time.Duration
+	var end_at time.Time
+	var err error
+	if until {
+		end_at, err = parseEndTime(duration_text, time.Now().In(location))
+		if err != nil {
+			response.Text = fmt.Sprintf(
+				"I couldn't work out when you'd like to extend "+
+					"\"*%v*\" until. %v",
+				resource,
+				err)
+			return response, true
+		}
+	} else {
+		duration, err = parseDurationText(duration_text)
+		if err != nil {
+			response.Text = err.Error()
+			return response, true
+		}
 	}
 
-	// Ensure an active reservation exists for this reousrce and user.
-	reservation := reservations.FindByResource(resource)
-	if !reservation.IsPresent() ||
-		!reservation.IsActive() ||
-		slack_request.UserName != reservation.User {
-		response.Text = fmt.Sprintf(
-			"You don't have any reservation on \"*%v*\" to extend\n\n"+
-				"Type `/reservations list` to list current reservations",
-			resource)
+	// Find and extend the existing reservation in a single transaction
+	var reservation Reservation
+	err = store.Update(func(tx *StoreTx) error {
 
-		return response, true
-	}
+		// Ensure an active reservation exists for this reousrce and user.
+		var ok bool
+		reservation, ok = ownActiveReservation(tx, resource, slack_request)
+		if !ok {
+			response.Text = noReservationText(resource, "extend")
+			return ErrRollback
+		}
 
-	// Transform value and units into formats we can work with
-	time_value_int, err := strconv.Atoi(time_value)
-	if err != nil {
-		log.Error(err)
-		return response, false
-	}
-	unit = unit_standardization_mapping[unit]
+		// Update reservation, and remind them again before the new end time
+		event := newHistoryEvent(HISTORY_EXTEND, resource, slack_request, reservation)
+		event.OldEndAt = reservation.EndAt
+		if until {
+			if !end_at.After(reservation.EndAt) {
+				response.Text = fmt.Sprintf(
+					"Your reservation on \"*%v*\" already lasts until %v",
+					resource,
+					endTimeText(reservation.EndAt, location))
+				return ErrRollback
+			}
+			reservation.EndAt = end_at
+		} else {
+			reservation.EndAt = reservation.EndAt.Add(duration)
+		}
+		reservation.Reminded = false
 
-	// Calculate a new endAt
-	hours := 0
-	minutes := 0
-	if unit == "hour" {
-		hours = time_value_int
-	}
-	if unit == "minute" {
-		minutes = time_value_int
-	}
+		config, _ := FindResource(resource)
+		if config.Retired {
+			response.Text = retiredResourceText(resource)
+			return ErrRollback
+		}
+		if err := config.CheckDuration(reservation.Length()); err != nil {
+			response.Text = err.Error()
+			return ErrRollback
+		}
 
-	endAt := reservation.EndAt.Add(
-		time.Hour*time.Duration(hours) + time.Minute*time.Duration(minutes),
-	)
+		// No need to check explicitly for `isInvalidResourceError()` since
+		// that's already done manually above
+		err := tx.Reservations.Upsert(resource, reservation)
+		if isConflictError(err) {
+			response.Text = conflictText(err.(*ConflictError))
+			return ErrRollback
+		}
+		if err != nil {
+			return err
+		}
+
+		event.NewEndAt = reservation.EndAt
+		tx.Record(event)
 
-	// Update reservation
-	reservation.EndAt = endAt
+		return nil
+	})
 
-	// Update
-	// No need to check explicitly for `isInvalidResourceError()` since
-	// that's already done manually above
-	err = reservations.Upsert(resource, reservation)
 	if err != nil {
 		log.Error(err)
 		return response, false
 	}
 
-	// Save to file
-	err = reservations.WriteToFile()
-	if err != nil {
-		log.Error(err)
-		return response, false
+	// No reservation to extend, or can't be extended
+	if response.Text != "" {
+		return response, true
 	}
 
 	// Construct a response for the user
 	response.Text = fmt.Sprintf(
 		"You have extended your reservation on \"*%v*\". It now expires"+
-			" in *%v*",
+			" in *%v* (at %v)",
 		resource,
-		reservation.RemainingTimeToString())
+		reservation.RemainingTimeToString(),
+		endTimeText(reservation.EndAt, location))
 
 	return response, true
 
@@ -453,14 +719,12 @@ curl -XPOST \
      http://localhost:8080/slack/commands/reservations
 
 */
-func handleCommandDestroy(slack_request SlackRequest) (SlackResponse, bool) {
+func handleCommandDestroy(slack_request SlackRequest, args CommandArgs) (SlackResponse, bool) {
 
-	command := slack_request.FormattedSubcommand()
 	response := SlackResponse{}
 
 	// Extract data from command
-	matches := subcmd_destroy_regex.FindStringSubmatch(command)
-	resource := matches[1]
+	resource := args["resource"]
 
 	// Check that resource is valid
 	// Delete() below checks for this, but we want to do it sooner so we
@@ -470,81 +734,367 @@ func handleCommandDestroy(slack_request SlackRequest) (SlackResponse, bool) {
 		return response, true
 	}
 
-	// Find all reservations
-	reservations, err := NewReservations()
+	// Find and delete the existing reservation in a single transaction
+	var reservation Reservation
+	var promotion Promotion
+	var ok bool
+	err := store.Update(func(tx *StoreTx) error {
+
+		// Ensure a current or upcoming reservation exists for this resource
+		// and user
+		reservation = tx.Reservations.FindByUser(resource, slack_request.User())
+		if !reservation.IsPresent() {
+
+			// Users in line can cancel their spot in it
+			if tx.Waitlists.Remove(resource, slack_request.User()) {
+				response.Text = fmt.Sprintf(
+					"You've left the waitlist for \"*%v*\"",
+					resource)
+				return nil
+			}
+
+			response.Text = noReservationText(resource, "cancel")
+			return ErrRollback
+		}
+
+		// No need to check explicitly for `isInvalidResourceError()` since
+		// that's already done manually above
+		err := tx.Reservations.Delete(resource, reservation)
+		if err != nil {
+			return err
+		}
+
+		event := newHistoryEvent(HISTORY_CANCEL, resource, slack_request, reservation)
+		event.OldEndAt = reservation.EndAt
+		tx.Record(event)
+
+		// Hand the resource over to whoever is next in line
+		promotion, ok = promoteWaitlist(tx, resource)
+		return nil
+	})
+
 	if err != nil {
 		log.Error(err)
 		return response, false
 	}
 
-	// Ensure an active reservation exists for this reousrce and user.
-	reservation := reservations.FindByResource(resource)
-	if !reservation.IsPresent() ||
-		!reservation.IsActive() ||
-		slack_request.UserName != reservation.User {
+	// No reservation to cancel, or left the waitlist
+	if response.Text != "" {
+		return response, true
+	}
+
+	// Construct a response for the user
+	if reservation.IsUpcoming() {
 		response.Text = fmt.Sprintf(
-			"You don't have any reservation on \"*%v*\" to cancel\n\n"+
-				"Type `/reservations list` to list current reservations",
+			"Your booking of \"*%v*\" for *%v* has been cancelled",
+			resource,
+			reservation.PeriodToString())
+	} else {
+		response.Text = fmt.Sprintf(
+			"Your reservation on \"*%v*\" has been cancelled",
 			resource)
+	}
+
+	if ok {
+		response.Text += fmt.Sprintf(
+			". It's been handed over to %v, who was next in line",
+			promotion.Reservation.Mention())
+
+		sendNotificationsInBackground(promotionNotifications([]Promotion{promotion}))
+	}
 
+	return response, true
+
+}
+
+/*
+Run this locally with:
+
+curl -XPOST \
+     -H "Content-Type: application/json" \
+     -d @example/queue \
+     http://localhost:8080/slack/commands/reservations
+
+*/
+func handleCommandQueue(slack_request SlackRequest, args CommandArgs) (SlackResponse, bool) {
+
+	response := SlackResponse{}
+
+	// Extract data from command
+	resource := args["resource"]
+	duration_text := args["duration"]
+
+	// Check that the resource is valid and can be reserved from here
+	config, text := reservableResource(resource, slack_request)
+	if text != "" {
+		response.Text = text
 		return response, true
 	}
 
-	// Delete
-	// No need to check explicitly for `isInvalidResourceError()` since
-	// that's already done manually above
-	err = reservations.Delete(resource)
+	// Transform the duration into one we can work with
+	duration, err := requestedDuration(config, duration_text)
 	if err != nil {
-		log.Error(err)
-		return response, false
+		response.Text = err.Error()
+		return response, true
 	}
+	if duration == 0 {
+		response.Text = missingDurationText("queue", resource)
+		return response, true
+	}
+	if err := config.CheckDuration(duration); err != nil {
+		response.Text = err.Error()
+		return response, true
+	}
+
+	// Get in line, unless there's no line to get in to
+	var reservation Reservation
+	var position int
+	var promotion Promotion
+	var promoted bool
+	err = store.Update(func(tx *StoreTx) error {
+
+		promotion, promoted = promoteWaitlist(tx, resource)
+
+		reservation = tx.Reservations.FindByUser(resource, slack_request.User())
+		if reservation.IsActive() {
+			response.Text = fmt.Sprintf(
+				"You've already reserved \"*%v*\" for the next *%v*",
+				resource,
+				reservation.RemainingTimeToString())
+
+			return nil
+		}
+
+		// Free - no need to wait
+		if !tx.Reservations.IsFull(resource) {
+			reservation = Reservation{
+				User:    slack_request.UserName,
+				UserId:  slack_request.UserId,
+				TeamId:  slack_request.TeamId,
+				StartAt: time.Now(),
+				EndAt:   time.Now().Add(duration),
+			}
+
+			err := tx.Reservations.Upsert(resource, reservation)
+			if isConflictError(err) {
+				response.Text = conflictText(err.(*ConflictError))
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+
+			event := newHistoryEvent(HISTORY_RESERVE, resource, slack_request, reservation)
+			event.NewEndAt = reservation.EndAt
+			tx.Record(event)
+
+			response.Text = fmt.Sprintf(
+				"\"*%v*\" is free, so you've reserved it for the next *%v*",
+				resource,
+				reservation.RemainingTimeToString())
+
+			return nil
+		}
+
+		reservation = tx.Reservations[resource].Active().EndingFirst()
+		position = tx.Waitlists.Push(resource, WaitlistEntry{
+			User:     slack_request.UserName,
+			UserId:   slack_request.UserId,
+			TeamId:   slack_request.TeamId,
+			Duration: duration,
+			QueuedAt: time.Now(),
+		})
+
+		return nil
+	})
 
-	// Save to file
-	err = reservations.WriteToFile()
 	if err != nil {
 		log.Error(err)
 		return response, false
 	}
 
+	if promoted {
+		sendNotificationsInBackground(promotionNotifications([]Promotion{promotion}))
+	}
+
+	// Reserved straight away, or already reserved
+	if response.Text != "" {
+		return response, true
+	}
+
 	// Construct a response for the user
-	response.Text = fmt.Sprintf(
-		"Your reservation on \"*%v*\" has been cancelled",
-		resource)
+	if config.Slots() > 1 {
+		response.Text = fmt.Sprintf(
+			"You're *#%v* in line for \"*%v*\". All *%v* slots are taken, and the first frees up in *%v*",
+			position,
+			resource,
+			config.Slots(),
+			reservation.RemainingTimeToString())
+	} else {
+		response.Text = fmt.Sprintf(
+			"You're *#%v* in line for \"*%v*\". %v has it for the next *%v*",
+			position,
+			resource,
+			reservation.Mention(),
+			reservation.RemainingTimeToString())
+	}
+	response.Text += fmt.Sprintf(
+		"\n\nWhen it's your turn it'll be reserved for you for *%v*",
+		formatConfigDuration(duration))
 
 	return response, true
 
 }
 
-func ensureReservationsFileExists() error {
+// Like `parseDurationText()`, but falls back to the resource's default
+// duration if none was given. Returns zero if there's no default either.
+func requestedDuration(resource Resource, duration_text string) (time.Duration, error) {
 
-	var err error
+	if duration_text == "" {
+		return time.Duration(resource.DefaultDuration), nil
+	}
 
-	// Create directory if it does not exist
-	_, err = os.Stat(reservations_dir)
-	if err != nil && os.IsNotExist(err) {
-		err = os.MkdirAll(reservations_dir, 0775)
+	return parseDurationText(duration_text)
 
-		if err != nil {
-			log.Debugf("Error creating directory %v", reservations_dir)
-			return err
-		}
+}
+
+func queueCommand(resource string, duration_text string) string {
+
+	if duration_text == "" {
+		return fmt.Sprintf("queue %v", resource)
 	}
 
-	// Create file if it does not exist
-	_, err = os.Stat(reservations_file)
-	if err != nil && os.IsNotExist(err) {
-		err = ioutil.WriteFile(reservations_file, []byte("{}"), 0755)
-		if err != nil {
-			return err
+	return fmt.Sprintf("queue %v for %v", resource, duration_text)
+
+}
+
+// Splits e.g. "staging tomorrow 2pm" into the resource ("staging") and the
+// text after it ("tomorrow 2pm"). Resource names may contain spaces, so the
+// longest leading run of words that's a valid resource, alias or prefix (see
+// `ResourceConfig.Resolve()`), or "any" and a group, wins. If none is valid,
+// the first word is assumed to be a misspelled resource.
+func splitResourceAndTime(text string) (string, string) {
+
+	words := strings.Fields(text)
+	if len(words) == 0 {
+		return text, ""
+	}
+
+	config := currentResourceConfig()
+	for i := len(words); i > 0; i-- {
+		resource := strings.Join(words[:i], " ")
+		if _, ok := config.Resolve(strings.ToLower(resource)); ok {
+			return resource, strings.Join(words[i:], " ")
+		}
+		if group, ok := anyGroupName(strings.ToLower(resource)); ok && len(config.GroupMembers(group)) > 0 {
+			return resource, strings.Join(words[i:], " ")
 		}
 	}
 
-	return nil
+	// "any" is never a resource on its own, so keep the group with it
+	if strings.ToLower(words[0]) == "any" && len(words) > 1 {
+		return strings.Join(words[:2], " "), strings.Join(words[2:], " ")
+	}
+
+	return words[0], strings.Join(words[1:], " ")
+
+}
+
+// Returns the requesting user's reservation in effect on the resource, if
+// they have one. Only they can change it.
+func ownActiveReservation(tx *StoreTx, resource string, slack_request SlackRequest) (Reservation, bool) {
+
+	reservation := tx.Reservations.FindByUser(resource, slack_request.User())
+	if !reservation.IsPresent() || !reservation.IsActive() {
+		return Reservation{}, false
+	}
+
+	return reservation, true
+
+}
+
+// Used inside `store.Update()` when there's nothing to save, except possibly
+// some promotions off a waitlist which shouldn't be lost
+func rollbackUnless(changed bool) error {
+
+	if changed {
+		return nil
+	}
+
+	return ErrRollback
+
+}
+
+func conflictText(err *ConflictError) string {
+
+	return fmt.Sprintf(
+		"Sorry, that would overlap with %v's reservation of \"*%v*\" for *%v*",
+		err.Conflict.Mention(),
+		err.Resource,
+		err.Conflict.PeriodToString())
+
+}
+
+// Describes who's still holding an orphaned resource, e.g. "reserved by
+// <@U123>, expires in 2 hours"
+func orphanedReservationText(schedule Schedule) string {
+
+	reservation := schedule.Current()
+	if !reservation.IsPresent() {
+		return "with upcoming bookings"
+	}
+
+	return fmt.Sprintf(
+		"reserved by %v, expires in %v",
+		reservation.Mention(),
+		reservation.RemainingTimeToString())
+
+}
+
+func noReservationText(resource string, action string) string {
+
+	return fmt.Sprintf(
+		"You don't have any reservation on \"*%v*\" to %v\n\n"+
+			"Type `/reservations list` to list current reservations",
+		resource,
+		action)
+
+}
+
+func missingDurationText(subcommand string, resource string) string {
+
+	return fmt.Sprintf(
+		"How long for? Try e.g. `/reservations %v %v for 2 hours`",
+		subcommand,
+		resource)
+
+}
+
+func retiredResourceText(resource string) string {
+
+	return fmt.Sprintf("\"*%v*\" has been retired and can't be reserved", resource)
+
+}
+
+func channelNotAllowedText(resource Resource) string {
+
+	return fmt.Sprintf(
+		"\"*%v*\" can only be reserved from %v",
+		resource.Name,
+		resource.AllowedChannelsToString())
 
 }
 
 func unknownResourceText(resource string) string {
 
+	suggestions := currentResourceConfig().Suggest(resource)
+	if len(suggestions) > 0 {
+		return fmt.Sprintf(
+			"I don't know what \"*%v*\" is. Did you mean %v?",
+			resource,
+			resourceChoicesToString(suggestions))
+	}
+
 	return fmt.Sprintf(
 		"I don't know what \"*%v*\" is. Did you misspell it?\n"+
 			"Valid resources: %v",
@@ -571,11 +1121,16 @@ func buildInvalidResponse(w http.ResponseWriter) {
 
 func buildErrorResponse(w http.ResponseWriter) {
 
-	response := SlackResponse{
+	buildResponse(errorResponse(), w)
+
+}
+
+func errorResponse() SlackResponse {
+
+	return SlackResponse{
 		Text: "Sorry, I couldn't understand your request.\nType " +
 			"`/reservations help` for more info",
 	}
-	buildResponse(response, w)
 
 }
 
@@ -584,6 +1139,12 @@ func buildResponse(slack_response SlackResponse, w http.ResponseWriter) {
 	// Hard-code response_type as ephemeral for all responses
 	slack_response.ResponseType = "ephemeral"
 
+	// Slack rejects the whole message if there are too many blocks, so fall
+	// back to the plain text instead
+	if len(slack_response.Blocks) > max_slack_blocks {
+		slack_response.Blocks = nil
+	}
+
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
 	w.WriteHeader(http.StatusOK)
 
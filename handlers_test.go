@@ -0,0 +1,490 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHandlersConcurrently(t *testing.T) {
+
+	//
+	// Setup
+	//
+
+	defer useResources("production, staging")()
+
+	dir, cleanup := useTempStoreDir()
+	defer cleanup()
+
+	bolt_store := &BoltStore{Path: filepath.Join(dir, "reservations.db")}
+	defer bolt_store.Close()
+
+	old_store := store
+	defer func() { store = old_store }()
+
+	stores := map[string]ReservationStore{
+		"FileStore": &FileStore{},
+		"BoltStore": bolt_store,
+	}
+
+	for name, s := range stores {
+
+		store = s
+		if err := store.Load(); err != nil {
+			t.Fatal("Error while calling Load():", err)
+		}
+
+		t.Run(name+"/Create", func(t *testing.T) {
+
+			responses := hammerHandler(50, func(i int) (SlackResponse, bool) {
+				return handleRequest(handleCommandCreate,
+					newTestSlackRequest(
+						fmt.Sprintf("user-%v", i), "reserve staging for 1 hour"))
+			})
+
+			winners := countMatching(responses, "successfully reserved")
+			if winners != 1 {
+				t.Error("expected", 1, "successful reservation, got", winners)
+			}
+
+			losers := countMatching(responses, "has reserved")
+			if losers != len(responses)-1 {
+				t.Error(
+					"expected", len(responses)-1, "rejected reservations,",
+					"got", losers)
+			}
+
+		})
+
+		t.Run(name+"/CreateAndDestroy", func(t *testing.T) {
+
+			// Interleaved reserves and cancels by the same user should all
+			// get a response and leave the store readable
+			responses := hammerHandler(50, func(i int) (SlackResponse, bool) {
+				if i%2 == 0 {
+					return handleRequest(handleCommandCreate,
+						newTestSlackRequest("bob", "reserve production for 1 hour"))
+				}
+
+				return handleRequest(handleCommandDestroy,
+					newTestSlackRequest("bob", "cancel production"))
+			})
+
+			for _, r := range responses {
+				if r.Text == "" {
+					t.Error("expected a response, got none")
+				}
+			}
+
+			reservations, err := store.List()
+			if err != nil {
+				t.Error("Expected no error, got", err)
+			}
+			if r := reservations.FindByResource("production"); r.IsPresent() && r.User != "bob" {
+				t.Error("expected", "bob", "got", r.User)
+			}
+
+		})
+
+		t.Run(name+"/Update", func(t *testing.T) {
+
+			reservation, err := store.Get("staging")
+			if err != nil {
+				t.Fatal("Expected no error, got", err)
+			}
+
+			holder := newTestSlackRequest(reservation.User, "extend staging by 1 min")
+
+			responses := hammerHandler(30, func(i int) (SlackResponse, bool) {
+				return handleRequest(handleCommandUpdate, holder)
+			})
+
+			if n := countMatching(responses, "extended"); n != len(responses) {
+				t.Error("expected", len(responses), "extensions, got", n)
+			}
+
+			// Every extension must have been applied, none lost to a race
+			actual, err := store.Get("staging")
+			if err != nil {
+				t.Fatal("Expected no error, got", err)
+			}
+
+			expected := reservation.EndAt.Add(30 * time.Minute)
+			if !actual.EndAt.Equal(expected) {
+				t.Error("expected", expected, "got", actual.EndAt)
+			}
+
+		})
+
+	}
+
+}
+
+// Calls `fn` `n` times concurrently and returns all the responses
+func hammerHandler(n int, fn func(i int) (SlackResponse, bool)) []SlackResponse {
+
+	var wg sync.WaitGroup
+	responses := make([]SlackResponse, n)
+
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			responses[i], _ = fn(i)
+		}(i)
+	}
+
+	wg.Wait()
+	return responses
+
+}
+
+func countMatching(responses []SlackResponse, pattern string) int {
+
+	count := 0
+	for _, r := range responses {
+		if regexp.MustCompile(pattern).MatchString(r.Text) {
+			count++
+		}
+	}
+
+	return count
+
+}
+
+func newTestSlackRequest(user_name string, text string) SlackRequest {
+
+	return SlackRequest{
+		Token:       "foo",
+		TeamId:      "T0001",
+		ChannelId:   "C0001",
+		ChannelName: "general",
+		UserId:      "U" + user_name,
+		UserName:    user_name,
+		Command:     "/reservations",
+		Text:        text,
+	}
+
+}
+
+func TestHandleCommandCreateInFuture(t *testing.T) {
+
+	//
+	// Setup
+	//
+
+	defer useResources("production, staging")()
+
+	defer useTempStore()()
+
+	expectMatch(t,
+		runCommand(t, handleCommandCreate, "alice", "reserve staging tomorrow 2pm for 3 hours"),
+		"successfully booked \"\\*staging\\*\" for \\*\\w+ \\w+ \\d+ 2:00pm - 5:00pm\\*")
+
+	// Booking in the future doesn't reserve it now
+	expectMatch(t,
+		runCommand(t, handleCommandCreate, "bob", "reserve staging for 1 hour"),
+		"successfully reserved")
+
+	expectMatch(t,
+		runCommand(t, handleCommandCreate, "carol", "reserve staging tomorrow at 4pm for 1 hour"),
+		"overlap with <@Ualice>'s reservation of \"\\*staging\\*\" for \\*.* 2:00pm - 5:00pm\\*")
+
+	expectMatch(t,
+		runCommand(t, handleCommandCreate, "carol", "reserve staging tomorrow 5pm for 1 hour"),
+		"successfully booked")
+
+	expectMatch(t,
+		runCommand(t, handleCommandCreate, "carol", "reserve staging someday for 1 hour"),
+		"I couldn't work out when")
+
+	expectMatch(t,
+		runCommand(t, handleCommandShow, "carol", "list"),
+		"booked by <@Ualice> for .* 2:00pm - 5:00pm\n.*booked by <@Ucarol> for .* 5:00pm - 6:00pm")
+
+	// Can't extend in to someone else's booking
+	expectMatch(t,
+		runCommand(t, handleCommandUpdate, "bob", "extend staging by 48 hours"),
+		"overlap with <@Ualice>'s reservation")
+
+	// Cancelling the current reservation leaves future bookings alone
+	expectMatch(t,
+		runCommand(t, handleCommandDestroy, "bob", "cancel staging"),
+		"Your reservation on \"\\*staging\\*\" has been cancelled")
+
+	expectMatch(t,
+		runCommand(t, handleCommandDestroy, "alice", "cancel staging"),
+		"Your booking of \"\\*staging\\*\" for .* has been cancelled")
+
+	expectMatch(t,
+		runCommand(t, handleCommandShow, "carol", "list"),
+		"staging \\(free\\)\n\\s+booked by <@Ucarol>")
+
+}
+
+func TestHandleCommandCreateWithPolicies(t *testing.T) {
+
+	//
+	// Setup
+	//
+
+	cleanup_resources, err := useResourcesFile(`{
+		"resources": [
+			{
+				"name": "staging",
+				"max_duration": "4h",
+				"default_duration": "2h",
+				"allowed_channels": ["general"]
+			},
+			{"name": "production", "allowed_channels": ["#deploys"]},
+			{"name": "qa"},
+			{"name": "demo", "max_duration": "4h"}
+		]
+	}`)
+	defer cleanup_resources()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer useTempStore()()
+
+	//
+	// Test
+	//
+
+	expectMatch(t,
+		runCommand(t, handleCommandCreate, "alice", "reserve staging for 5 hours"),
+		"can only be reserved for up to \\*4 hours\\* at a time")
+
+	// Falls back to the default duration
+	expectMatch(t,
+		runCommand(t, handleCommandCreate, "alice", "reserve staging"),
+		"successfully reserved \"\\*staging\\*\" for the next \\*2 hours, 0 minutes\\*")
+
+	// Can't be extended past the maximum either
+	expectMatch(t,
+		runCommand(t, handleCommandUpdate, "alice", "extend staging by 3 hours"),
+		"can only be reserved for up to \\*4 hours\\*")
+
+	expectMatch(t,
+		runCommand(t, handleCommandQueue, "bob", "queue staging"),
+		"reserved for you for \\*2 hours\\*")
+
+	expectMatch(t,
+		runCommand(t, handleCommandCreate, "alice", "reserve production for 1 hour"),
+		"can only be reserved from #deploys")
+
+	expectMatch(t,
+		runCommand(t, handleCommandCreate, "alice", "reserve qa"),
+		"How long for\\? Try e.g. `/reservations reserve qa for 2 hours`")
+
+	// Reservations saved before start times were recorded count as
+	// starting now
+	err = store.Update(func(tx *StoreTx) error {
+		return tx.Reservations.Upsert("demo", Reservation{
+			User:   "alice",
+			UserId: "Ualice",
+			EndAt:  time.Now().Add(time.Hour),
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectMatch(t,
+		runCommand(t, handleCommandUpdate, "alice", "extend demo by 2 hours"),
+		"extended")
+
+}
+
+func TestHandleCommandCreateWithDurations(t *testing.T) {
+
+	//
+	// Setup
+	//
+
+	defer useResources("production, staging, qa")()
+
+	defer useTempStore()()
+
+	//
+	// Test
+	//
+
+	expectMatch(t,
+		runCommand(t, handleCommandCreate, "alice", "reserve staging for 1 day"),
+		"for the next \\*1 day, 0 hours\\*")
+
+	expectMatch(t,
+		runCommand(t, handleCommandUpdate, "alice", "extend staging by 1h30m"),
+		"now expires in \\*1 day, 1 hour\\*")
+
+	expectMatch(t,
+		runCommand(t, handleCommandCreate, "alice", "reserve production for 1 hour 30 minutes"),
+		"for the next \\*1 hour, 30 minutes\\*")
+
+	expectMatch(t,
+		runCommand(t, handleCommandQueue, "bob", "queue production for 1.5 hours"),
+		"reserved for you for \\*1 hour, 30 minutes\\*")
+
+	expectMatch(t,
+		runCommand(t, handleCommandCreate, "alice", "reserve qa for 2 fortnights"),
+		"I don't understand the duration \\*2 fortnights\\*")
+
+	expectMatch(t,
+		runCommand(t, handleCommandUpdate, "alice", "extend staging by a bit"),
+		"I don't understand the duration \\*a bit\\*")
+
+}
+
+func TestHandleCommandCreateUntil(t *testing.T) {
+
+	//
+	// Setup
+	//
+
+	defer useResources("production, staging, qa")()
+
+	defer useTempStore()()
+
+	// Times are read in the user's own time zone, whatever the server's is
+	api, cleanup_api := useFakeSlackApi()
+	defer cleanup_api()
+	api.users = []SlackUser{{Id: "Ualice", Name: "alice", Tz: "Pacific/Kiritimati"}}
+	defer func() { user_time_zone_cache.zones = map[string]cachedTimeZone{} }()
+
+	location, _ := time.LoadLocation("Pacific/Kiritimati")
+	year, month, day := time.Now().In(location).Date()
+
+	expectEndAt := func(resource string, expected time.Time) {
+		reservation, err := store.Get(resource)
+		if err != nil {
+			t.Fatal("expected no error, got", err)
+		}
+		if !reservation.EndAt.Equal(expected) {
+			t.Error("expected", expected, "got", reservation.EndAt.In(location))
+		}
+	}
+
+	//
+	// Test
+	//
+
+	expectMatch(t,
+		runCommand(t, handleCommandCreate, "alice", "reserve staging until tomorrow 9am"),
+		"successfully reserved \"\\*staging\\*\" for the next \\*.*\\* \\(until <!date\\^\\d+\\^")
+	expectEndAt("staging", time.Date(year, month, day+1, 9, 0, 0, 0, location))
+
+	expectMatch(t,
+		runCommand(t, handleCommandUpdate, "alice", "extend staging until tomorrow 6pm"),
+		"now expires in \\*.*\\* \\(at <!date\\^\\d+\\^")
+	expectEndAt("staging", time.Date(year, month, day+1, 18, 0, 0, 0, location))
+
+	expectMatch(t,
+		runCommand(t, handleCommandUpdate, "alice", "extend staging until tomorrow 8am"),
+		"already lasts until")
+	expectEndAt("staging", time.Date(year, month, day+1, 18, 0, 0, 0, location))
+
+	// A day on its own means the end of that day
+	runCommand(t, handleCommandCreate, "alice", "reserve production until tomorrow")
+	expectEndAt("production", time.Date(year, month, day+2, 0, 0, 0, 0, location))
+
+	// The queue button asks for as long as they wanted it
+	response, _ := handleRequest(handleCommandCreate, newTestSlackRequest("bob", "reserve staging until 2099-01-01"))
+	if len(response.Blocks) != 2 || len(response.Blocks[1].Elements) != 1 {
+		t.Fatal("expected a queue button, got", response.Blocks)
+	}
+	button, ok := response.Blocks[1].Elements[0].(ButtonElement)
+	if !ok || !regexp.MustCompile("\\Aqueue staging for \\d+ hours").MatchString(button.Value) {
+		t.Error("expected a queue button, got", response.Blocks[1].Elements[0])
+	}
+
+	expectMatch(t,
+		runCommand(t, handleCommandCreate, "alice", "reserve qa until someday"),
+		"I couldn't work out when you'd like to reserve \"\\*qa\\*\" until")
+
+	expectMatch(t,
+		runCommand(t, handleCommandUpdate, "alice", "extend production until 2017-01-01 9am"),
+		"I couldn't work out when you'd like to extend \"\\*production\\*\" until")
+
+}
+
+func TestHandleCommandCreateWithCapacity(t *testing.T) {
+
+	//
+	// Setup
+	//
+
+	cleanup_resources, err := useResourcesFile(`{
+		"resources": [
+			{"name": "staging"},
+			{"name": "load-test", "capacity": 2}
+		]
+	}`)
+	defer cleanup_resources()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer useTempStore()()
+
+	//
+	// Test
+	//
+
+	expectMatch(t,
+		runCommand(t, handleCommandCreate, "alice", "reserve load-test for 1 hour"),
+		"successfully reserved \"\\*load-test\\*\"")
+
+	expectMatch(t,
+		runCommand(t, handleCommandCreate, "alice", "reserve load-test for 1 hour"),
+		"You've already reserved \"\\*load-test\\*\"")
+
+	expectMatch(t,
+		runCommand(t, handleCommandCreate, "bob", "reserve load-test for 2 hours"),
+		"successfully reserved \"\\*load-test\\*\"")
+
+	expectMatch(t,
+		runCommand(t, handleCommandCreate, "carol", "reserve load-test for 1 hour"),
+		"All \\*2\\* slots on \"\\*load-test\\*\" are taken")
+
+	expectMatch(t,
+		runCommand(t, handleCommandQueue, "carol", "queue load-test for 1 hour"),
+		"You're \\*#1\\* in line for \"\\*load-test\\*\". All \\*2\\* slots are taken, "+
+			"and the first frees up in \\*1 hour")
+
+	actual := runCommand(t, handleCommandShow, "dave", "list")
+	expectMatch(t, actual, "→  staging \\(free\\)\n")
+	expectMatch(t, actual, "→  load-test \\(2/2 slots used\\)\n"+
+		"      reserved by <@Ualice>, expires in .*\n"+
+		"      reserved by <@Ubob>, expires in .*\n"+
+		"      waitlist: 1. <@Ucarol>")
+
+	// Extending and cancelling only touch the user's own slot
+	expectMatch(t,
+		runCommand(t, handleCommandUpdate, "bob", "extend load-test by 1 hour"),
+		"You have extended your reservation on \"\\*load-test\\*\". It now expires in \\*3 hours")
+
+	expectMatch(t,
+		runCommand(t, handleCommandUpdate, "dave", "extend load-test by 1 hour"),
+		"You don't have any reservation on \"\\*load-test\\*\" to extend")
+
+	expectMatch(t,
+		runCommand(t, handleCommandDestroy, "alice", "cancel load-test"),
+		"Your reservation on \"\\*load-test\\*\" has been cancelled. "+
+			"It's been handed over to <@Ucarol>, who was next in line")
+
+	reservations, _ := store.List()
+	holders := []string{}
+	for _, reservation := range reservations["load-test"].Active() {
+		holders = append(holders, reservation.User)
+	}
+	if len(holders) != 2 || holders[0] != "bob" || holders[1] != "carol" {
+		t.Error("expected", []string{"bob", "carol"}, "got", holders)
+	}
+
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A subcommand as described by `/reservations help`
+type helpCommand struct {
+	Name        string
+	Alias       string
+	Description string
+	Usage       []string
+}
+
+func (c helpCommand) ToString() string {
+
+	name := fmt.Sprintf("*%v*", c.Name)
+	if c.Alias != "" {
+		name += fmt.Sprintf(" (or *%v*)", c.Alias)
+	}
+
+	lines := []string{fmt.Sprintf("%v - %v", name, c.Description)}
+	for _, usage := range c.Usage {
+		lines = append(lines, "`"+usage+"`")
+	}
+
+	return strings.Join(lines, "\n")
+
+}
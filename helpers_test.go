@@ -1,6 +1,7 @@
 package main
 
 import (
+	"regexp"
 	"testing"
 )
 
@@ -19,3 +20,63 @@ func TestMaskToken(t *testing.T) {
 	}
 
 }
+
+// Points `store` at a fresh file store in a temp directory. The returned
+// function restores the previous one.
+func useTempStore() func() {
+
+	_, cleanup := useTempStoreDir()
+
+	old_store := store
+	store = &FileStore{}
+	store.Load()
+
+	return func() {
+		store = old_store
+		cleanup()
+	}
+
+}
+
+// Calls the handler with the request's arguments, as `MainHandler` would
+func handleRequest(
+	fn func(SlackRequest, CommandArgs) (SlackResponse, bool),
+	slack_request SlackRequest) (SlackResponse, bool) {
+
+	_, args, err := parseCommand(slack_request.Text)
+	if err != nil {
+		return SlackResponse{Text: err.Error()}, true
+	}
+
+	return fn(slack_request, args)
+
+}
+
+// Runs a command as `user`, failing the test if it doesn't succeed, and
+// returns the response text
+func runCommand(
+	t *testing.T,
+	fn func(SlackRequest, CommandArgs) (SlackResponse, bool),
+	user string,
+	text string) string {
+
+	t.Helper()
+
+	response, ok := handleRequest(fn, newTestSlackRequest(user, text))
+	if !ok {
+		t.Fatalf("%v: %q failed", user, text)
+	}
+
+	return response.Text
+
+}
+
+func expectMatch(t *testing.T, actual string, pattern string) {
+
+	t.Helper()
+
+	if !regexp.MustCompile(pattern).MatchString(actual) {
+		t.Errorf("expected %q to match /%v/", actual, pattern)
+	}
+
+}
@@ -0,0 +1,385 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	HISTORY_RESERVE      = "reserve"
+	HISTORY_EXTEND       = "extend"
+	HISTORY_CANCEL       = "cancel"
+	HISTORY_EXPIRE       = "expire"
+	HISTORY_PROMOTE      = "promote"
+	HISTORY_FORCE_CANCEL = "force-cancel"
+	HISTORY_REASSIGN     = "reassign"
+	HISTORY_TRANSFER     = "transfer"
+	HISTORY_ADMIN        = "admin"
+)
+
+var history_file = filepath.Join(reservations_dir, "history.jsonl")
+
+// How far back `history` looks if no time is given
+var default_history_window = 7 * 24 * time.Hour
+
+// Most events shown by `history`. Older ones are left out.
+var max_history_events = 50
+
+// Something that happened to a resource. Events are only ever appended to the
+// history, never changed or removed.
+//
+// `User` is whoever made it happen, and is empty for things that happen on
+// their own, like a reservation expiring. `Holder` is whose reservation it
+// was, and `NewHolder` who it was reassigned or transferred to. `OldEndAt`
+// and `NewEndAt` are when the reservation ended before and after the event.
+type HistoryEvent struct {
+	At          time.Time `json:"at"`
+	Action      string    `json:"action"`
+	Resource    string    `json:"resource"`
+	User        string    `json:"user,omitempty"`
+	UserId      string    `json:"user_id,omitempty"`
+	TeamId      string    `json:"team_id,omitempty"`
+	ChannelId   string    `json:"channel_id,omitempty"`
+	ChannelName string    `json:"channel_name,omitempty"`
+	Holder      string    `json:"holder,omitempty"`
+	HolderId    string    `json:"holder_id,omitempty"`
+	NewHolder   string    `json:"new_holder,omitempty"`
+	NewHolderId string    `json:"new_holder_id,omitempty"`
+	StartAt     time.Time `json:"start_at"`
+	OldEndAt    time.Time `json:"old_end_at"`
+	NewEndAt    time.Time `json:"new_end_at"`
+	Details     string    `json:"details,omitempty"`
+}
+
+// Starts an event for something the requesting user did to `reservation`
+func newHistoryEvent(
+	action string,
+	resource string,
+	slack_request SlackRequest,
+	reservation Reservation) HistoryEvent {
+
+	return HistoryEvent{
+		At:          time.Now(),
+		Action:      action,
+		Resource:    resource,
+		User:        slack_request.UserName,
+		UserId:      slack_request.UserId,
+		TeamId:      slack_request.TeamId,
+		ChannelId:   slack_request.ChannelId,
+		ChannelName: slack_request.ChannelName,
+		Holder:      reservation.User,
+		HolderId:    reservation.UserId,
+		StartAt:     reservation.StartAt,
+	}
+
+}
+
+// Adds an event to the history once the transaction is saved
+func (tx *StoreTx) Record(event HistoryEvent) {
+
+	tx.Events = append(tx.Events, event)
+
+}
+
+// Drops reservations that have already ended, recording that they expired
+func (tx *StoreTx) PruneExpired() {
+
+	for resource, schedule := range tx.Reservations {
+		for _, reservation := range schedule {
+			if !reservation.IsExpired() {
+				continue
+			}
+
+			tx.Record(HistoryEvent{
+				At:       reservation.EndAt,
+				Action:   HISTORY_EXPIRE,
+				Resource: resource,
+				Holder:   reservation.User,
+				HolderId: reservation.UserId,
+				StartAt:  reservation.StartAt,
+				OldEndAt: reservation.EndAt,
+			})
+		}
+	}
+
+	tx.Reservations.Prune()
+
+}
+
+// Describes the event in a line of `history`
+func (e HistoryEvent) ToString() string {
+
+	user := UserIdentity{Id: e.UserId, Name: e.User}.Mention()
+	holder := UserIdentity{Id: e.HolderId, Name: e.Holder}.Mention()
+	new_holder := UserIdentity{Id: e.NewHolderId, Name: e.NewHolder}.Mention()
+
+	var text string
+
+	switch e.Action {
+
+	case HISTORY_RESERVE:
+		if e.StartAt.After(e.At) {
+			text = fmt.Sprintf(
+				"%v booked it from %v until %v",
+				user,
+				historyTime(e.StartAt),
+				historyTime(e.NewEndAt))
+		} else {
+			text = fmt.Sprintf("%v reserved it until %v", user, historyTime(e.NewEndAt))
+		}
+
+	case HISTORY_EXTEND:
+		text = fmt.Sprintf(
+			"%v extended it from %v until %v",
+			user,
+			historyTime(e.OldEndAt),
+			historyTime(e.NewEndAt))
+
+	case HISTORY_CANCEL:
+		text = fmt.Sprintf(
+			"%v cancelled their reservation until %v",
+			user,
+			historyTime(e.OldEndAt))
+
+	case HISTORY_EXPIRE:
+		text = fmt.Sprintf("%v's reservation expired", holder)
+
+	case HISTORY_PROMOTE:
+		text = fmt.Sprintf(
+			"%v got it from the waitlist until %v",
+			holder,
+			historyTime(e.NewEndAt))
+
+	case HISTORY_FORCE_CANCEL:
+		text = fmt.Sprintf(
+			"%v force-cancelled %v's reservation until %v",
+			user,
+			holder,
+			historyTime(e.OldEndAt))
+
+	case HISTORY_REASSIGN:
+		text = fmt.Sprintf(
+			"%v reassigned it from %v to %v until %v",
+			user,
+			holder,
+			new_holder,
+			historyTime(e.NewEndAt))
+
+	case HISTORY_TRANSFER:
+		text = fmt.Sprintf(
+			"%v handed it over to %v until %v",
+			holder,
+			new_holder,
+			historyTime(e.NewEndAt))
+
+	case HISTORY_ADMIN:
+		text = fmt.Sprintf("%v ran `%v`", user, e.Details)
+
+	default:
+		text = fmt.Sprintf("%v: %v", e.Action, user)
+
+	}
+
+	if e.ChannelId != "" {
+		text += fmt.Sprintf(" in <#%v>", e.ChannelId)
+	}
+
+	return historyTime(e.At) + " - " + text
+
+}
+
+func historyTime(t time.Time) string {
+
+	return slackDate(t, "{date_short_pretty} {time}", reservation_time_layout)
+
+}
+
+/*
+Run this locally with:
+
+	curl -XPOST \
+	     -H "Content-Type: application/json" \
+	     -d @example/history \
+	     http://localhost:8080/slack/commands/reservations
+*/
+func handleCommandHistory(slack_request SlackRequest, args CommandArgs) (SlackResponse, bool) {
+
+	response := SlackResponse{}
+
+	// Extract data from command
+	resource := args["resource"]
+
+	window := default_history_window
+	if args["time ago"] != "" {
+		var err error
+		window, err = parseDurationText(args["time ago"])
+		if err != nil {
+			response.Text = err.Error()
+			return response, true
+		}
+	}
+
+	events, err := store.History(resource, time.Now().Add(-window))
+	if err != nil {
+		log.Error(err)
+		return response, false
+	}
+
+	// Resources that have since been removed still have a history
+	if len(events) == 0 && !IsValidResource(resource) {
+		response.Text = unknownResourceText(resource)
+		return response, true
+	}
+
+	if len(events) == 0 {
+		response.Text = fmt.Sprintf(
+			"Nothing has happened to \"*%v*\" in the last *%v*",
+			resource,
+			historyWindowToString(window))
+		return response, true
+	}
+
+	lines := []string{fmt.Sprintf(
+		"History of \"*%v*\" over the last *%v*",
+		resource,
+		historyWindowToString(window))}
+
+	if len(events) > max_history_events {
+		lines = append(lines, fmt.Sprintf(
+			"_Showing the latest %v of %v events_",
+			max_history_events,
+			len(events)))
+		events = events[len(events)-max_history_events:]
+	}
+
+	for _, event := range events {
+		lines = append(lines, event.ToString())
+	}
+
+	response.Text = strings.Join(lines, "\n")
+
+	return response, true
+
+}
+
+func historyWindowToString(window time.Duration) string {
+
+	day := 24 * time.Hour
+	if window >= day && window%day == 0 {
+		var r Reservation
+		return r.formatDuration(float64(window/day), "day")
+	}
+
+	return formatConfigDuration(window)
+
+}
+
+// Returns events on the resource (or every resource, if it's empty) at or
+// after `since`, oldest first
+func filterHistory(events []HistoryEvent, resource string, since time.Time) []HistoryEvent {
+
+	filtered := []HistoryEvent{}
+
+	for _, event := range events {
+		if (resource == "" || event.Resource == resource) && !event.At.Before(since) {
+			filtered = append(filtered, event)
+		}
+	}
+
+	// Expiries are recorded when they're noticed, with the time they
+	// actually happened, so may be out of order
+	sort.SliceStable(filtered, func(i, j int) bool {
+		return filtered[i].At.Before(filtered[j].At)
+	})
+
+	return filtered
+
+}
+
+// Reads the history of every resource in one go, by resource, oldest first
+func historyByResource(since time.Time) (map[string][]HistoryEvent, error) {
+
+	events, err := store.History("", since)
+	if err != nil {
+		return nil, err
+	}
+
+	by_resource := map[string][]HistoryEvent{}
+	for _, event := range events {
+		by_resource[event.Resource] = append(by_resource[event.Resource], event)
+	}
+
+	return by_resource, nil
+
+}
+
+// Appends the events to `history_file`, one JSON document per line
+func appendHistoryFile(events []HistoryEvent) error {
+
+	if len(events) == 0 {
+		return nil
+	}
+
+	f, err := os.OpenFile(history_file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		log.Errorf("Could not open history file %v", history_file)
+		return err
+	}
+	defer f.Close()
+
+	var body []byte
+	for _, event := range events {
+		line, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		body = append(append(body, line...), '\n')
+	}
+
+	_, err = f.Write(body)
+	if err == nil {
+		err = f.Sync()
+	}
+	if err != nil {
+		log.Errorf("Could not write to history file %v", history_file)
+	}
+
+	return err
+
+}
+
+// Reads every event from `history_file`. Lines that can't be parsed (e.g.
+// left half written by a crash) are skipped.
+func readHistoryFile() ([]HistoryEvent, error) {
+
+	events := []HistoryEvent{}
+
+	f, err := os.Open(history_file)
+	if os.IsNotExist(err) {
+		return events, nil
+	}
+	if err != nil {
+		log.Errorf("Could not open history file %v", history_file)
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var event HistoryEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			log.Warningf("Skipping unreadable line in %v: %v", history_file, err)
+			continue
+		}
+		events = append(events, event)
+	}
+
+	return events, scanner.Err()
+
+}
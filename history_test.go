@@ -0,0 +1,184 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStoreHistory(t *testing.T) {
+
+	//
+	// Setup
+	//
+
+	defer useResources("production, staging")()
+
+	dir, cleanup := useTempStoreDir()
+	defer cleanup()
+
+	bolt_store := &BoltStore{Path: filepath.Join(dir, "reservations.db")}
+	defer bolt_store.Close()
+
+	stores := map[string]ReservationStore{
+		"FileStore": &FileStore{},
+		"BoltStore": bolt_store,
+	}
+
+	now := time.Now()
+
+	for name, s := range stores {
+
+		t.Run(name, func(t *testing.T) {
+
+			s.Load()
+
+			s.Update(func(tx *StoreTx) error {
+				tx.Record(HistoryEvent{At: now, Action: HISTORY_RESERVE, Resource: "staging", User: "alice"})
+				tx.Record(HistoryEvent{At: now.Add(-48 * time.Hour), Action: HISTORY_EXPIRE, Resource: "staging", Holder: "bob"})
+				tx.Record(HistoryEvent{At: now, Action: HISTORY_RESERVE, Resource: "production", User: "carol"})
+				return nil
+			})
+
+			// Events from rolled back transactions are discarded
+			s.Update(func(tx *StoreTx) error {
+				tx.Record(HistoryEvent{At: now, Action: HISTORY_CANCEL, Resource: "staging", User: "alice"})
+				return ErrRollback
+			})
+
+			events, err := s.History("staging", now.Add(-72*time.Hour))
+			if err != nil {
+				t.Fatal("expected no error, got", err)
+			}
+
+			// Oldest first
+			if len(events) != 2 || events[0].Holder != "bob" || events[1].User != "alice" {
+				t.Error("expected bob's expiry then alice's reservation, got", events)
+			}
+
+			events, _ = s.History("staging", now.Add(-time.Hour))
+			if len(events) != 1 || events[0].User != "alice" {
+				t.Error("expected alice's reservation, got", events)
+			}
+
+			events, _ = s.History("qa", now.Add(-72*time.Hour))
+			if len(events) != 0 {
+				t.Error("expected no events, got", events)
+			}
+
+			// Every resource
+			events, _ = s.History("", now.Add(-time.Hour))
+			if len(events) != 2 || events[0].Resource == events[1].Resource {
+				t.Error("expected events on staging and production, got", events)
+			}
+
+		})
+
+	}
+
+}
+
+func TestPruneExpired(t *testing.T) {
+
+	defer useResources("production, staging")()
+
+	now := time.Now()
+	expired := Reservation{User: "alice", UserId: "UALICE", StartAt: now.Add(-2 * time.Hour), EndAt: now.Add(-time.Hour)}
+	current := Reservation{User: "bob", UserId: "UBOB", StartAt: now, EndAt: now.Add(time.Hour)}
+
+	tx := &StoreTx{Reservations: Reservations{"staging": Schedule{expired, current}}}
+	tx.PruneExpired()
+
+	if len(tx.Reservations["staging"]) != 1 {
+		t.Error("expected", 1, "got", len(tx.Reservations["staging"]))
+	}
+
+	if len(tx.Events) != 1 {
+		t.Fatal("expected", 1, "got", len(tx.Events))
+	}
+
+	event := tx.Events[0]
+	if event.Action != HISTORY_EXPIRE || event.HolderId != "UALICE" || !event.At.Equal(expired.EndAt) {
+		t.Error("expected alice's reservation to have expired, got", event)
+	}
+
+}
+
+func TestHandleCommandHistory(t *testing.T) {
+
+	//
+	// Setup
+	//
+
+	defer useResources("production, staging")()
+
+	defer useTempStore()()
+
+	runCommand(t, handleCommandCreate, "alice", "reserve staging for 1 hour")
+	runCommand(t, handleCommandUpdate, "alice", "extend staging by 30 mins")
+	runCommand(t, handleCommandQueue, "bob", "queue staging for 1 hour")
+	runCommand(t, handleCommandDestroy, "alice", "cancel staging")
+
+	// An event from before the window
+	store.Update(func(tx *StoreTx) error {
+		tx.Record(HistoryEvent{
+			At:       time.Now().Add(-3 * 24 * time.Hour),
+			Action:   HISTORY_EXPIRE,
+			Resource: "staging",
+			Holder:   "carol",
+			HolderId: "UCAROL",
+		})
+		return nil
+	})
+
+	//
+	// Test
+	//
+
+	t.Run("Default", func(t *testing.T) {
+
+		actual := runCommand(t, handleCommandHistory, "dave", "history staging")
+		lines := strings.Split(actual, "\n")
+
+		if len(lines) != 6 {
+			t.Fatal("expected", 6, "lines, got", actual)
+		}
+
+		expectMatch(t, lines[0], "History of \"\\*staging\\*\" over the last \\*7 days\\*")
+		expectMatch(t, lines[1], "<@UCAROL>'s reservation expired")
+		expectMatch(t, lines[2], "<@Ualice> reserved it until .* in <#C0001>")
+		expectMatch(t, lines[3], "<@Ualice> extended it from .* until ")
+		expectMatch(t, lines[4], "<@Ualice> cancelled their reservation until ")
+		expectMatch(t, lines[5], "<@Ubob> got it from the waitlist until ")
+
+	})
+
+	t.Run("Since", func(t *testing.T) {
+
+		actual := runCommand(t, handleCommandHistory, "dave", "history staging since 2d")
+		expectMatch(t, actual, "over the last \\*2 days\\*")
+
+		if strings.Contains(actual, "UCAROL") {
+			t.Error("expected carol's reservation to be left out, got", actual)
+		}
+
+	})
+
+	t.Run("Nothing", func(t *testing.T) {
+
+		expectMatch(t,
+			runCommand(t, handleCommandHistory, "dave", "history production since 12 hours"),
+			"Nothing has happened to \"\\*production\\*\" in the last \\*12 hours\\*")
+
+	})
+
+	t.Run("InvalidResource", func(t *testing.T) {
+
+		expectMatch(t,
+			runCommand(t, handleCommandHistory, "dave", "history foo"),
+			"foo")
+
+	})
+
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	ACTION_ID_EXTEND  = "extend"
+	ACTION_ID_RELEASE = "release"
+	ACTION_ID_QUEUE   = "queue"
+)
+
+// How long the "Extend" button extends a reservation by
+const extend_button_text = "30 mins"
+
+// Each button carries the subcommand it stands for as its value, which has
+// to be the command its action expects before it's run
+var interaction_actions = map[string]string{
+	ACTION_ID_EXTEND:  "extend",
+	ACTION_ID_RELEASE: "cancel",
+	ACTION_ID_QUEUE:   "queue",
+}
+
+var response_url_client = &http.Client{Timeout: 10 * time.Second}
+
+// The parts of an interaction payload we use. See
+// https://api.slack.com/reference/interaction-payloads/block-actions
+type SlackInteraction struct {
+	Type  string `json:"type"`
+	Token string `json:"token"`
+	User  struct {
+		Id       string `json:"id"`
+		Username string `json:"username"`
+		TeamId   string `json:"team_id"`
+	} `json:"user"`
+	Team struct {
+		Id     string `json:"id"`
+		Domain string `json:"domain"`
+	} `json:"team"`
+	Channel struct {
+		Id   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"channel"`
+	ResponseUrl string        `json:"response_url"`
+	TriggerId   string        `json:"trigger_id"`
+	Actions     []SlackAction `json:"actions"`
+}
+
+type SlackAction struct {
+	ActionId string `json:"action_id"`
+	BlockId  string `json:"block_id"`
+	Value    string `json:"value"`
+}
+
+/*
+Handles button clicks. Slack only waits a few seconds for a reply, and
+ignores anything in it, so results are sent to the interaction's
+`response_url` instead.
+
+Run this locally with:
+
+	curl -XPOST \
+	     --data-urlencode payload@example/interaction \
+	     http://localhost:8080/slack/interactions
+*/
+func InteractionsHandler(w http.ResponseWriter, r *http.Request) {
+
+	interaction, err := parseSlackInteraction(r)
+	if err != nil {
+		log.Error(err)
+		buildInvalidResponse(w)
+		return
+	}
+
+	// Make sure the reservations store is ready to be read from
+	err = store.Load()
+	if err != nil {
+		log.Error(err)
+		buildErrorResponse(w)
+		return
+	}
+
+	for _, action := range interaction.Actions {
+		response, success := handleInteractionAction(interaction, action)
+		if !success {
+			response = errorResponse()
+		}
+
+		// Replace the message the button was on, so it can't be clicked again
+		response.ReplaceOriginal = true
+
+		go func(response SlackResponse) {
+			err := postToResponseUrl(interaction.ResponseUrl, response)
+			if err != nil {
+				log.Error(err)
+			}
+		}(response)
+	}
+
+	w.WriteHeader(http.StatusOK)
+
+}
+
+func parseSlackInteraction(r *http.Request) (SlackInteraction, error) {
+
+	var interaction SlackInteraction
+
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, 1048576 /*1MB*/))
+	if err != nil {
+		return interaction, err
+	}
+	r.Body.Close()
+
+	log.Debugf("Received slack interaction: \"%v\"", string(body))
+
+	qp, err := url.ParseQuery(string(body))
+	if err != nil {
+		return interaction, err
+	}
+
+	err = json.Unmarshal([]byte(qp.Get("payload")), &interaction)
+	if err != nil {
+		return interaction, err
+	}
+
+	if interaction.Type != "block_actions" {
+		return interaction, errors.New(
+			fmt.Sprintf("Unsupported interaction type %q", interaction.Type))
+	}
+
+	return interaction, nil
+
+}
+
+// Runs the command behind a button as if the user had typed it
+func handleInteractionAction(
+	interaction SlackInteraction, action SlackAction) (SlackResponse, bool) {
+
+	command_name, ok := interaction_actions[action.ActionId]
+	command, args, err := parseCommand(action.Value)
+	if !ok || err != nil || command.Name != command_name {
+		log.Errorf("Invalid action %q with value %q", action.ActionId, action.Value)
+		return SlackResponse{}, false
+	}
+
+	log.Debugf("Handling action: `%v`", action.ActionId)
+
+	slack_request := SlackRequest{
+		TeamId:      interactionTeamId(interaction),
+		TeamDomain:  interaction.Team.Domain,
+		ChannelId:   interaction.Channel.Id,
+		ChannelName: interaction.Channel.Name,
+		UserId:      interaction.User.Id,
+		UserName:    interaction.User.Username,
+		Text:        action.Value,
+		ResponseUrl: interaction.ResponseUrl,
+		TriggerId:   interaction.TriggerId,
+	}
+
+	return command.Handler(slack_request, args)
+
+}
+
+// Users in Enterprise Grid organizations may belong to a different team
+// than the workspace they clicked in, so prefer their own
+func interactionTeamId(interaction SlackInteraction) string {
+
+	if interaction.User.TeamId != "" {
+		return interaction.User.TeamId
+	}
+
+	return interaction.Team.Id
+
+}
+
+func postToResponseUrl(response_url string, response SlackResponse) error {
+
+	// Responses are only ever shown to the user who clicked
+	response.ResponseType = "ephemeral"
+
+	body, err := json.Marshal(response)
+	if err != nil {
+		return err
+	}
+
+	result, err := response_url_client.Post(
+		response_url, "application/json; charset=utf-8", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer result.Body.Close()
+
+	if result.StatusCode != http.StatusOK {
+		return errors.New(
+			fmt.Sprintf("response_url returned HTTP %v", result.StatusCode))
+	}
+
+	return nil
+
+}
+
+func extendButton(resource string) ButtonElement {
+
+	return NewButton(
+		"Extend "+extend_button_text,
+		ACTION_ID_EXTEND,
+		fmt.Sprintf("extend %v by %v", resource, extend_button_text))
+
+}
+
+func releaseButton(resource string) ButtonElement {
+
+	button := NewButton(
+		"Release",
+		ACTION_ID_RELEASE,
+		fmt.Sprintf("cancel %v", resource))
+	button.Style = "danger"
+
+	return button
+
+}
+
+func queueButton(resource string, duration_text string) ButtonElement {
+
+	return NewButton(
+		"Reserve when free",
+		ACTION_ID_QUEUE,
+		queueCommand(resource, duration_text))
+
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInteractionsHandler(t *testing.T) {
+
+	//
+	// Setup
+	//
+
+	defer useResources("production, staging")()
+
+	defer useTempStore()()
+
+	// Collects whatever is sent to the response_url
+	responses := make(chan SlackResponse, 1)
+	response_server := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var response SlackResponse
+			json.NewDecoder(r.Body).Decode(&response)
+			responses <- response
+		}))
+	defer response_server.Close()
+
+	click := func(user string, action_id string, value string) (int, SlackResponse) {
+		payload, _ := json.Marshal(map[string]interface{}{
+			"type":         "block_actions",
+			"user":         map[string]string{"id": "U" + user, "username": user},
+			"response_url": response_server.URL,
+			"actions": []map[string]string{
+				{"action_id": action_id, "value": value},
+			},
+		})
+		body := url.Values{"payload": {string(payload)}}.Encode()
+
+		recorder := httptest.NewRecorder()
+		InteractionsHandler(recorder, httptest.NewRequest(
+			"POST", "/slack/interactions", strings.NewReader(body)))
+
+		if recorder.Code != http.StatusOK {
+			return recorder.Code, SlackResponse{}
+		}
+
+		select {
+		case response := <-responses:
+			return recorder.Code, response
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for response_url to be called")
+			return 0, SlackResponse{}
+		}
+	}
+
+	store.Upsert("staging", Reservation{
+		User: "alice", StartAt: time.Now(), EndAt: time.Now().Add(time.Hour)})
+
+	//
+	// Test
+	//
+
+	t.Run("Extend", func(t *testing.T) {
+
+		_, response := click("alice", ACTION_ID_EXTEND, "extend staging by 30 mins")
+
+		if !strings.Contains(response.Text, "You have extended your reservation") {
+			t.Error("expected an extension, got", response.Text)
+		}
+		if !response.ReplaceOriginal {
+			t.Error("expected", true, "got", response.ReplaceOriginal)
+		}
+
+		reservation, _ := store.Get("staging")
+		if reservation.EndAt.Before(time.Now().Add(89 * time.Minute)) {
+			t.Error("expected reservation to be extended, got", reservation.EndAt)
+		}
+
+	})
+
+	t.Run("Queue", func(t *testing.T) {
+
+		_, response := click("bob", ACTION_ID_QUEUE, "queue staging for 1 hour")
+
+		if !strings.Contains(response.Text, "You're *#1* in line") {
+			t.Error("expected to be queued, got", response.Text)
+		}
+
+	})
+
+	t.Run("Release", func(t *testing.T) {
+
+		_, response := click("alice", ACTION_ID_RELEASE, "cancel staging")
+
+		if !strings.Contains(response.Text, "handed over to <@Ubob>") {
+			t.Error("expected a handover, got", response.Text)
+		}
+
+	})
+
+	t.Run("MismatchedValue", func(t *testing.T) {
+
+		_, response := click("bob", ACTION_ID_RELEASE, "reserve staging for 1 hour")
+
+		if response.Text != errorResponse().Text {
+			t.Error("expected", errorResponse().Text, "got", response.Text)
+		}
+
+	})
+
+	t.Run("InvalidPayload", func(t *testing.T) {
+
+		recorder := httptest.NewRecorder()
+		InteractionsHandler(recorder, httptest.NewRequest(
+			"POST", "/slack/interactions", strings.NewReader("payload=nope")))
+
+		if !strings.Contains(recorder.Body.String(), "invalid request") {
+			t.Error("expected an invalid response, got", recorder.Body.String())
+		}
+
+	})
+
+}
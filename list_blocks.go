@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	status_emoji_free     = ":large_green_circle:"
+	status_emoji_reserved = ":red_circle:"
+	status_emoji_orphaned = ":warning:"
+)
+
+// How long to queue for when "Reserve when free" is clicked from the list,
+// for resources without a default duration
+const default_queue_duration_text = "1 hour"
+
+// Lays out the `list` response as one section per resource, showing who
+// holds it and until when, followed by anything booked or queued after them.
+// Grouped resources come after a heading for their group.
+// `user` gets buttons to extend or release their own reservations, and to
+// queue for everyone else's.
+func listBlocks(
+	reservations Reservations, waitlists Waitlists, user UserIdentity) []Block {
+
+	blocks := []Block{NewHeaderBlock("Reservations")}
+
+	for _, listing := range currentResourceConfig().Listing() {
+		if listing.Group != "" {
+			blocks = append(blocks,
+				NewDividerBlock(),
+				NewSectionBlock(fmt.Sprintf("*%v*", listing.Heading(reservations))))
+		}
+
+		blocks = append(blocks, resourceBlocks(listing.Resources, reservations, waitlists, user)...)
+	}
+
+	for _, resource := range reservations.Orphaned() {
+		blocks = append(blocks, NewSectionBlock(fmt.Sprintf(
+			"%v *%v*\nNo longer available, %v",
+			status_emoji_orphaned,
+			resource,
+			orphanedReservationText(reservations[resource]))))
+	}
+
+	blocks = append(blocks,
+		NewDividerBlock(),
+		NewContextBlock(fmt.Sprintf(
+			"As of %v  |  Type `/reservations help` for more",
+			slackDate(time.Now(), "{date_short_pretty} {time}", "Jan 2 3:04pm"))))
+
+	return blocks
+
+}
+
+// A section for each resource, with its buttons
+func resourceBlocks(
+	resources []Resource,
+	reservations Reservations,
+	waitlists Waitlists,
+	user UserIdentity) []Block {
+
+	blocks := []Block{}
+
+	for _, config := range resources {
+		resource := config.Name
+		lines := []string{}
+
+		reservation := reservations.FindByResource(resource)
+		if config.Slots() > 1 {
+			active := reservations[resource].Active()
+			emoji := status_emoji_free
+			if len(active) >= config.Slots() {
+				emoji = status_emoji_reserved
+			}
+
+			lines = append(lines,
+				fmt.Sprintf("%v %v", emoji, resourceTitle(config)),
+				fmt.Sprintf("%v/%v slots used", len(active), config.Slots()))
+			for _, holder := range active {
+				lines = append(lines, fmt.Sprintf(
+					"Reserved by %v until %v (%v left)%v",
+					holder.Mention(),
+					slackDate(holder.EndAt, "{time}", "3:04pm"),
+					holder.RemainingTimeToString(),
+					noteText(holder)))
+			}
+
+			// Buttons are for the user's own slot, or to queue for one if
+			// they're all taken
+			if own := reservations.FindByUser(resource, user); own.IsActive() {
+				reservation = own
+			} else if len(active) < config.Slots() {
+				reservation = Reservation{}
+			}
+		} else if reservation.IsPresent() && reservation.IsActive() {
+			lines = append(lines,
+				fmt.Sprintf("%v %v", status_emoji_reserved, resourceTitle(config)),
+				fmt.Sprintf(
+					"Reserved by %v until %v (%v left)",
+					reservation.Mention(),
+					slackDate(reservation.EndAt, "{time}", "3:04pm"),
+					reservation.RemainingTimeToString()))
+			if reservation.Note != "" {
+				lines = append(lines, ":memo: "+linkNote(reservation.Note))
+			}
+		} else {
+			lines = append(lines,
+				fmt.Sprintf("%v %v", status_emoji_free, resourceTitle(config)),
+				"Free")
+		}
+
+		if about := resourceAbout(config); about != "" {
+			lines = append(lines, about)
+		}
+
+		for _, upcoming := range reservations[resource].Upcoming() {
+			lines = append(lines, fmt.Sprintf(
+				":calendar: Booked by %v for %v%v",
+				upcoming.Mention(),
+				upcoming.PeriodToString(),
+				noteText(upcoming)))
+		}
+
+		if waitlist := waitlists[resource]; len(waitlist) > 0 {
+			lines = append(lines, fmt.Sprintf(
+				":hourglass_flowing_sand: Waitlist: %v",
+				waitlistToString(waitlist)))
+		}
+
+		section := NewSectionBlock(strings.Join(lines, "\n"))
+
+		switch {
+		case !reservation.IsActive():
+			blocks = append(blocks, section)
+
+		case reservation.IsHeldBy(user):
+			blocks = append(blocks,
+				section,
+				NewActionsBlock(extendButton(resource), releaseButton(resource)))
+
+		default:
+			duration_text := default_queue_duration_text
+			if config.DefaultDuration > 0 {
+				duration_text = ""
+			}
+			section.Accessory = queueButton(resource, duration_text)
+			blocks = append(blocks, section)
+		}
+	}
+
+	return blocks
+
+}
+
+// The resource's name, linked to its URL if it has one
+func resourceTitle(resource Resource) string {
+
+	if resource.Url == "" {
+		return fmt.Sprintf("*%v*", resource.Name)
+	}
+
+	return fmt.Sprintf("*<%v|%v>*", resource.Url, resource.Name)
+
+}
+
+// Renders e.g. "_Pre-production environment (owned by platform)_", or an
+// empty string if the resource has no description or owner
+func resourceAbout(resource Resource) string {
+
+	var about string
+
+	switch {
+	case resource.Description != "" && resource.OwnerTeam != "":
+		about = fmt.Sprintf("%v (owned by %v)", resource.Description, resource.OwnerTeam)
+	case resource.Description != "":
+		about = resource.Description
+	case resource.OwnerTeam != "":
+		about = fmt.Sprintf("Owned by %v", resource.OwnerTeam)
+	default:
+		return ""
+	}
+
+	return "_" + about + "_"
+
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestListBlocks(t *testing.T) {
+
+	defer useResources("production, staging")()
+
+	now := time.Now()
+
+	reservations := Reservations{
+		"staging": Schedule{
+			{User: "alice", UserId: "UALICE", StartAt: now, EndAt: now.Add(time.Hour), Note: "testing"},
+			{User: "bob", StartAt: now.Add(2 * time.Hour), EndAt: now.Add(3 * time.Hour)},
+		},
+	}
+	waitlists := Waitlists{
+		"staging": Waitlist{{User: "carol", Duration: time.Hour}},
+	}
+
+	blocks := listBlocks(reservations, waitlists, UserIdentity{Id: "UDAVE"})
+
+	// Header, one section per resource, divider and footer
+	if len(blocks) != 5 {
+		t.Fatal("expected", 5, "got", len(blocks))
+	}
+
+	if blocks[0].Type != "header" {
+		t.Error("expected", "header", "got", blocks[0].Type)
+	}
+
+	production := blocks[1].Text.Text
+	if !strings.HasPrefix(production, ":large_green_circle: *production*\nFree") {
+		t.Error("expected production to be free, got", production)
+	}
+
+	staging := blocks[2].Text.Text
+	for _, expected := range []string{
+		":red_circle: *staging*",
+		"Reserved by <@UALICE> until <!date^",
+		":memo: testing",
+		"Booked by bob for",
+		"Waitlist: 1. carol",
+	} {
+		if !strings.Contains(staging, expected) {
+			t.Errorf("expected %q to contain %q", staging, expected)
+		}
+	}
+
+	if blocks[4].Type != "context" {
+		t.Error("expected", "context", "got", blocks[4].Type)
+	}
+
+	// Anyone else can queue for staging
+	button, ok := blocks[2].Accessory.(ButtonElement)
+	if !ok || button.Value != "queue staging for 1 hour" {
+		t.Error("expected a queue button, got", blocks[2].Accessory)
+	}
+
+	// Whereas alice can extend or release it
+	blocks = listBlocks(reservations, waitlists, UserIdentity{Id: "UALICE"})
+	if len(blocks) != 6 || blocks[3].Type != "actions" {
+		t.Fatal("expected an actions block after staging, got", blocks)
+	}
+	if len(blocks[3].Elements) != 2 {
+		t.Error("expected", 2, "got", len(blocks[3].Elements))
+	}
+
+}
+
+func TestListBlocksWithCapacity(t *testing.T) {
+
+	cleanup, err := useResourcesFile(`{"resources": [{"name": "load-test", "capacity": 3}]}`)
+	defer cleanup()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+
+	reservations := Reservations{
+		"load-test": Schedule{
+			{User: "alice", UserId: "UALICE", StartAt: now, EndAt: now.Add(time.Hour)},
+			{User: "bob", UserId: "UBOB", StartAt: now, EndAt: now.Add(2 * time.Hour)},
+		},
+	}
+
+	blocks := listBlocks(reservations, Waitlists{}, UserIdentity{Id: "UDAVE"})
+
+	section := blocks[1].Text.Text
+	for _, expected := range []string{
+		":large_green_circle: *load-test*\n2/3 slots used",
+		"Reserved by <@UALICE> until <!date^",
+		"Reserved by <@UBOB> until <!date^",
+	} {
+		if !strings.Contains(section, expected) {
+			t.Errorf("expected %q to contain %q", section, expected)
+		}
+	}
+
+	// There's still a slot free, so no need to queue
+	if blocks[1].Accessory != nil {
+		t.Error("expected no button, got", blocks[1].Accessory)
+	}
+
+	// bob can extend or release their own slot
+	blocks = listBlocks(reservations, Waitlists{}, UserIdentity{Id: "UBOB"})
+	if blocks[2].Type != "actions" {
+		t.Error("expected an actions block, got", blocks[2])
+	}
+
+}
+
+func TestBuildResponse(t *testing.T) {
+
+	t.Run("Blocks", func(t *testing.T) {
+
+		recorder := httptest.NewRecorder()
+		buildResponse(SlackResponse{
+			Text:   "fallback",
+			Blocks: []Block{NewSectionBlock("hello")},
+		}, recorder)
+
+		var body map[string]interface{}
+		json.Unmarshal(recorder.Body.Bytes(), &body)
+
+		if body["text"] != "fallback" {
+			t.Error("expected", "fallback", "got", body["text"])
+		}
+		if blocks, _ := body["blocks"].([]interface{}); len(blocks) != 1 {
+			t.Error("expected", 1, "got", body["blocks"])
+		}
+
+	})
+
+	t.Run("TooManyBlocks", func(t *testing.T) {
+
+		blocks := make([]Block, max_slack_blocks+1)
+		for i := range blocks {
+			blocks[i] = NewDividerBlock()
+		}
+
+		recorder := httptest.NewRecorder()
+		buildResponse(SlackResponse{Text: "fallback", Blocks: blocks}, recorder)
+
+		var body map[string]interface{}
+		json.Unmarshal(recorder.Body.Bytes(), &body)
+
+		if _, ok := body["blocks"]; ok {
+			t.Error("expected no blocks, got", body["blocks"])
+		}
+
+	})
+
+}
@@ -9,8 +9,31 @@ var log = initializeLogger()
 func main() {
 
 	validateOptions()
+	configureStore()
 	logOptions()
 
+	err := store.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = configureResourceCatalog()
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Infof("Available resources: %v", ListOfResourcesToString())
+
+	// Notifications and user ID lookups need a bot token
+	slack_client = NewSlackClient()
+	migrateUserIds()
+
+	if slack_client != nil {
+		StartScheduler(scheduler_interval)
+	}
+
+	// Pick up changes to the resources without needing a restart
+	WatchResources()
+
 	router := NewRouter()
 
 	log.Info("I'm listening...")
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+/*
+Cancels the reservation in effect on a resource, whoever holds it. Only
+available to admins.
+
+Run this locally with:
+
+	curl -XPOST \
+	     -H "Content-Type: application/json" \
+	     -d @example/force-cancel \
+	     http://localhost:8080/slack/commands/reservations
+*/
+func handleCommandForceCancel(slack_request SlackRequest, args CommandArgs) (SlackResponse, bool) {
+
+	command := slack_request.FormattedSubcommand()
+	response := SlackResponse{}
+
+	if !isAdmin(slack_request) {
+		log.Warningf("Refused force-cancel from %v: %q", slack_request.UserId, command)
+		response.Text = "Sorry, only admins can do that"
+		return response, true
+	}
+
+	// Extract data from command
+	resource := args["resource"]
+
+	if !IsValidResource(resource) {
+		response.Text = unknownResourceText(resource)
+		return response, true
+	}
+
+	holder, err := moderatedHolder(args, resource, "force-cancel", slack_request.TeamId)
+	if err != nil {
+		response.Text = err.Error()
+		return response, true
+	}
+
+	// Cancel the reservation and hand the resource on in a single transaction
+	var reservation Reservation
+	var promotion Promotion
+	var ok bool
+	err = store.Update(func(tx *StoreTx) error {
+
+		reservation = heldReservation(tx, resource, holder)
+		if !reservation.IsPresent() {
+			response.Text = notReservedText(resource, holder)
+			return ErrRollback
+		}
+
+		err := tx.Reservations.Delete(resource, reservation)
+		if err != nil {
+			return err
+		}
+
+		event := newHistoryEvent(HISTORY_FORCE_CANCEL, resource, slack_request, reservation)
+		event.OldEndAt = reservation.EndAt
+		tx.Record(event)
+
+		promotion, ok = promoteWaitlist(tx, resource)
+		return nil
+	})
+
+	if err != nil {
+		log.Error(err)
+		return response, false
+	}
+
+	// Nothing to cancel
+	if response.Text != "" {
+		return response, true
+	}
+
+	log.Noticef(
+		"%v (%v) force-cancelled %v's reservation of %v",
+		slack_request.UserName,
+		slack_request.UserId,
+		reservation.User,
+		resource)
+
+	notifications := []Notification{{
+		UserId: reservation.UserId,
+		Text: fmt.Sprintf(
+			"%v has cancelled your reservation of *%v*",
+			slack_request.User().Mention(),
+			resource),
+	}}
+
+	// Construct a response for the user
+	response.Text = fmt.Sprintf(
+		"You've cancelled %v's reservation on \"*%v*\"",
+		reservation.Mention(),
+		resource)
+
+	if ok {
+		notifications = append(notifications, promotionNotifications([]Promotion{promotion})...)
+		response.Text += fmt.Sprintf(
+			". It's been handed over to %v, who was next in line",
+			promotion.Reservation.Mention())
+	}
+
+	sendNotificationsInBackground(notifications)
+
+	return response, true
+
+}
+
+/*
+Hands the reservation in effect on a resource over to someone else, for the
+rest of its time. Only available to admins.
+
+Run this locally with:
+
+	curl -XPOST \
+	     -H "Content-Type: application/json" \
+	     -d @example/reassign \
+	     http://localhost:8080/slack/commands/reservations
+*/
+func handleCommandReassign(slack_request SlackRequest, args CommandArgs) (SlackResponse, bool) {
+
+	command := slack_request.FormattedSubcommand()
+	response := SlackResponse{}
+
+	if !isAdmin(slack_request) {
+		log.Warningf("Refused reassign from %v: %q", slack_request.UserId, command)
+		response.Text = "Sorry, only admins can do that"
+		return response, true
+	}
+
+	// Extract data from command
+	resource := args["resource"]
+	target := args["user"]
+
+	if !IsValidResource(resource) {
+		response.Text = unknownResourceText(resource)
+		return response, true
+	}
+
+	new_holder, err := resolveUser(target, slack_request.TeamId)
+	if err != nil {
+		response.Text = err.Error()
+		return response, true
+	}
+	if new_holder.Name == "" {
+		new_holder.Name = new_holder.Id
+	}
+
+	holder, err := moderatedHolder(args, resource, "reassign", slack_request.TeamId)
+	if err != nil {
+		response.Text = err.Error()
+		return response, true
+	}
+
+	// Replace the holder and take the new one out of the waitlist in a single
+	// transaction
+	var previous Reservation
+	var reservation Reservation
+	err = store.Update(func(tx *StoreTx) error {
+
+		previous = heldReservation(tx, resource, holder)
+		if !previous.IsPresent() {
+			response.Text = notReservedText(resource, holder)
+			return ErrRollback
+		}
+
+		var text string
+		var err error
+		reservation, text, err = handOver(
+			tx, resource, previous, new_holder, HISTORY_REASSIGN, slack_request)
+		if text != "" {
+			response.Text = text
+			return ErrRollback
+		}
+
+		return err
+	})
+
+	if err != nil {
+		log.Error(err)
+		return response, false
+	}
+
+	// Nothing to reassign
+	if response.Text != "" {
+		return response, true
+	}
+
+	log.Noticef(
+		"%v (%v) reassigned %v's reservation of %v to %v",
+		slack_request.UserName,
+		slack_request.UserId,
+		previous.User,
+		resource,
+		reservation.User)
+
+	sendNotificationsInBackground([]Notification{
+		{
+			UserId: previous.UserId,
+			Text: fmt.Sprintf(
+				"%v has handed your reservation of *%v* over to %v",
+				slack_request.User().Mention(),
+				resource,
+				reservation.Mention()),
+		},
+		{
+			UserId: reservation.UserId,
+			Text: fmt.Sprintf(
+				"%v has handed *%v* over to you. It's yours for the next %v",
+				slack_request.User().Mention(),
+				resource,
+				reservation.RemainingTimeToString()),
+		},
+	})
+
+	// Construct a response for the user
+	response.Text = fmt.Sprintf(
+		"\"*%v*\" is now reserved for %v for the next *%v*, instead of %v",
+		resource,
+		reservation.Mention(),
+		reservation.RemainingTimeToString(),
+		previous.Mention())
+
+	return response, true
+
+}
+
+// Works out whose reservation an admin command acts on, from its optional
+// `holder` argument. Resources several people can hold at once need it, since
+// otherwise there's no telling whose.
+func moderatedHolder(
+	args CommandArgs,
+	resource string,
+	command string,
+	team_id string) (UserIdentity, error) {
+
+	if args["holder"] != "" {
+		return resolveUser(args["holder"], team_id)
+	}
+
+	config, _ := FindResource(resource)
+	if config.Slots() > 1 {
+		return UserIdentity{}, errors.New(fmt.Sprintf(
+			"Up to %v people can hold \"*%v*\" at once, so say whose "+
+				"reservation you mean, e.g. `/reservations %v %v @alice`",
+			config.Slots(),
+			resource,
+			command,
+			resource))
+	}
+
+	return UserIdentity{}, nil
+
+}
+
+// Returns the holder's reservation in effect on the resource, or whichever
+// one is in effect if no holder is given. Returns the zero value if there
+// isn't one.
+func heldReservation(tx *StoreTx, resource string, holder UserIdentity) Reservation {
+
+	if holder == (UserIdentity{}) {
+		return tx.Reservations.FindByResource(resource)
+	}
+
+	reservation := tx.Reservations.FindByUser(resource, holder)
+	if !reservation.IsActive() {
+		return Reservation{}
+	}
+
+	return reservation
+
+}
+
+func notReservedText(resource string, holder UserIdentity) string {
+
+	if holder != (UserIdentity{}) {
+		return fmt.Sprintf(
+			"%v doesn't have \"*%v*\" reserved right now",
+			holder.Mention(),
+			resource)
+	}
+
+	return fmt.Sprintf("Nobody has \"*%v*\" reserved right now", resource)
+
+}
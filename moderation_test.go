@@ -0,0 +1,300 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandleCommandForceCancel(t *testing.T) {
+
+	//
+	// Setup
+	//
+
+	defer useResources("production, staging")()
+
+	old_env := os.Getenv("ADMIN_USER_IDS")
+	defer os.Setenv("ADMIN_USER_IDS", old_env)
+	os.Setenv("ADMIN_USER_IDS", "Uroot")
+
+	defer useTempStore()()
+
+	api, cleanup_api := useFakeSlackApi()
+	defer cleanup_api()
+
+	now := time.Now()
+	store.Upsert("staging", Reservation{
+		User: "alice", UserId: "Ualice", TeamId: "T0001", StartAt: now, EndAt: now.Add(8 * time.Hour)})
+	store.Update(func(tx *StoreTx) error {
+		tx.Waitlists.Push("staging", WaitlistEntry{
+			User: "bob", UserId: "Ubob", TeamId: "T0001", Duration: time.Hour, QueuedAt: now})
+		return nil
+	})
+
+	//
+	// Test
+	//
+
+	t.Run("NotAdmin", func(t *testing.T) {
+
+		actual := runCommand(t, handleCommandForceCancel, "carol", "force-cancel staging")
+		if !strings.Contains(actual, "only admins can do that") {
+			t.Error("expected a refusal, got", actual)
+		}
+
+		if reservation, _ := store.Get("staging"); reservation.User != "alice" {
+			t.Error("expected", "alice", "got", reservation.User)
+		}
+
+	})
+
+	t.Run("NotReserved", func(t *testing.T) {
+
+		actual := runCommand(t, handleCommandForceCancel, "root", "force-cancel production")
+		if !strings.Contains(actual, "Nobody has \"*production*\" reserved") {
+			t.Error("expected production to be free, got", actual)
+		}
+
+	})
+
+	t.Run("InvalidResource", func(t *testing.T) {
+
+		actual := runCommand(t, handleCommandForceCancel, "root", "force-cancel foo")
+		if !strings.Contains(actual, "foo") {
+			t.Error("expected an unknown resource message, got", actual)
+		}
+
+	})
+
+	t.Run("Success", func(t *testing.T) {
+
+		actual := runCommand(t, handleCommandForceCancel, "root", "force-cancel staging")
+		expected := "You've cancelled <@Ualice>'s reservation on \"*staging*\". " +
+			"It's been handed over to <@Ubob>, who was next in line"
+		if actual != expected {
+			t.Error("expected", expected, "got", actual)
+		}
+
+		if reservation, _ := store.Get("staging"); reservation.User != "bob" {
+			t.Error("expected", "bob", "got", reservation.User)
+		}
+
+		// Recorded in the history, along with the handover
+		events, _ := store.History("staging", now.Add(-time.Minute))
+		if len(events) != 2 ||
+			events[0].Action != HISTORY_FORCE_CANCEL ||
+			events[0].UserId != "Uroot" ||
+			events[0].HolderId != "Ualice" ||
+			events[1].Action != HISTORY_PROMOTE {
+			t.Error("expected a force-cancel and a promotion, got", events)
+		}
+
+		expected_messages := map[string]string{
+			"Ualice": "<@Uroot> has cancelled your reservation of *staging*",
+			"Ubob":   "You're up! *staging* is now reserved for you",
+		}
+
+		messages := api.waitForMessages(len(expected_messages))
+		if len(messages) != len(expected_messages) {
+			t.Fatal("expected", len(expected_messages), "messages, got", messages)
+		}
+
+		for _, message := range messages {
+			prefix, ok := expected_messages[message["channel"]]
+			if !ok || !strings.HasPrefix(message["text"], prefix) {
+				t.Errorf("unexpected message %v", message)
+			}
+		}
+
+	})
+
+}
+
+func TestHandleCommandForceCancelWithCapacity(t *testing.T) {
+
+	//
+	// Setup
+	//
+
+	cleanup_resources, err := useResourcesFile(
+		`{"resources": [{"name": "load-test", "capacity": 2}]}`)
+	defer cleanup_resources()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	old_env := os.Getenv("ADMIN_USER_IDS")
+	defer os.Setenv("ADMIN_USER_IDS", old_env)
+	os.Setenv("ADMIN_USER_IDS", "Uroot")
+
+	defer useTempStore()()
+
+	api, cleanup_api := useFakeSlackApi()
+	defer cleanup_api()
+
+	now := time.Now()
+	for _, user := range []string{"ALICE", "BOB"} {
+		store.Upsert("load-test", Reservation{
+			User: user, UserId: "U" + user, TeamId: "T0001", StartAt: now, EndAt: now.Add(time.Hour)})
+	}
+
+	//
+	// Test
+	//
+
+	// Either holder could be meant
+	ambiguous := map[string]func(SlackRequest, CommandArgs) (SlackResponse, bool){
+		"force-cancel load-test":                handleCommandForceCancel,
+		"reassign load-test to <@UCAROL|carol>": handleCommandReassign,
+	}
+	for text, fn := range ambiguous {
+		actual := runCommand(t, fn, "root", text)
+		if !strings.Contains(actual, "say whose reservation you mean") {
+			t.Error(text, ": expected to be asked whose, got", actual)
+		}
+	}
+
+	actual := runCommand(t, handleCommandForceCancel, "root", "force-cancel load-test <@UCAROL|carol>")
+	if !strings.Contains(actual, "<@UCAROL> doesn't have \"*load-test*\" reserved") {
+		t.Error("expected carol to have no reservation, got", actual)
+	}
+
+	actual = runCommand(t, handleCommandReassign, "root", "reassign load-test <@UBOB|bob> to <@UCAROL|carol>")
+	if !strings.Contains(actual, "instead of <@UBOB>") {
+		t.Error("expected bob's reservation to be reassigned, got", actual)
+	}
+
+	actual = runCommand(t, handleCommandForceCancel, "root", "force-cancel load-test <@UALICE|alice>")
+	if !strings.Contains(actual, "You've cancelled <@UALICE>'s reservation") {
+		t.Error("expected alice's reservation to be cancelled, got", actual)
+	}
+
+	holders := []string{}
+	reservations, _ := store.List()
+	for _, reservation := range reservations["load-test"].Active() {
+		holders = append(holders, reservation.User)
+	}
+	if len(holders) != 1 || holders[0] != "carol" {
+		t.Error("expected only carol to hold load-test, got", holders)
+	}
+
+	// Bob and carol hear about the handover, and alice about the cancellation
+	if messages := api.waitForMessages(3); len(messages) != 3 {
+		t.Error("expected", 3, "messages, got", messages)
+	}
+
+}
+
+func TestHandleCommandReassign(t *testing.T) {
+
+	//
+	// Setup
+	//
+
+	defer useResources("production, staging")()
+
+	old_env := os.Getenv("ADMIN_USER_IDS")
+	defer os.Setenv("ADMIN_USER_IDS", old_env)
+	os.Setenv("ADMIN_USER_IDS", "Uroot")
+
+	defer useTempStore()()
+
+	api, cleanup_api := useFakeSlackApi()
+	defer cleanup_api()
+
+	now := time.Now()
+	end_at := now.Add(8 * time.Hour)
+	store.Upsert("staging", Reservation{
+		User: "bob", UserId: "UBOB", TeamId: "T0001", StartAt: now, EndAt: end_at, Reminded: true})
+	store.Update(func(tx *StoreTx) error {
+		tx.Waitlists.Push("staging", WaitlistEntry{
+			User: "alice", UserId: "UALICE", TeamId: "T0001", Duration: time.Hour, QueuedAt: now})
+		return nil
+	})
+
+	//
+	// Test
+	//
+
+	t.Run("NotAdmin", func(t *testing.T) {
+
+		expectMatch(t,
+			runCommand(t, handleCommandReassign, "carol", "reassign staging to <@UCAROL|carol>"),
+			"only admins can do that")
+
+	})
+
+	t.Run("NotReserved", func(t *testing.T) {
+
+		expectMatch(t,
+			runCommand(t, handleCommandReassign, "root", "reassign production to <@UALICE|alice>"),
+			"Nobody has \"\\*production\\*\" reserved")
+
+	})
+
+	t.Run("SameHolder", func(t *testing.T) {
+
+		expectMatch(t,
+			runCommand(t, handleCommandReassign, "root", "reassign staging to <@UBOB|bob>"),
+			"<@UBOB> already has \"\\*staging\\*\"")
+
+	})
+
+	t.Run("UnknownUser", func(t *testing.T) {
+
+		expectMatch(t,
+			runCommand(t, handleCommandReassign, "root", "reassign staging to @nobody"),
+			"I couldn't find anyone called \\*@nobody\\*")
+
+	})
+
+	t.Run("Success", func(t *testing.T) {
+
+		expectMatch(t,
+			runCommand(t, handleCommandReassign, "root", "Reassign staging to <@UALICE|alice>"),
+			"\\A\"\\*staging\\*\" is now reserved for <@UALICE> for the next "+
+				"\\*.*\\*, instead of <@UBOB>\\z")
+
+		reservation, _ := store.Get("staging")
+		if !reservation.IsHeldBy(UserIdentity{Id: "UALICE", TeamId: "T0001"}) {
+			t.Error("expected", "UALICE", "got", reservation)
+		}
+		if !reservation.EndAt.Equal(end_at) {
+			t.Error("expected", end_at, "got", reservation.EndAt)
+		}
+		if reservation.Reminded {
+			t.Error("expected", false, "got", reservation.Reminded)
+		}
+
+		// No longer waiting for it
+		var waitlist Waitlist
+		store.Update(func(tx *StoreTx) error {
+			waitlist = tx.Waitlists["staging"]
+			return ErrRollback
+		})
+		if len(waitlist) != 0 {
+			t.Error("expected an empty waitlist, got", waitlist)
+		}
+
+		expected_messages := map[string]string{
+			"UBOB":   "<@Uroot> has handed your reservation of *staging* over to <@UALICE>",
+			"UALICE": "<@Uroot> has handed *staging* over to you",
+		}
+
+		messages := api.waitForMessages(len(expected_messages))
+		if len(messages) != len(expected_messages) {
+			t.Fatal("expected", len(expected_messages), "messages, got", messages)
+		}
+
+		for _, message := range messages {
+			prefix, ok := expected_messages[message["channel"]]
+			if !ok || !strings.HasPrefix(message["text"], prefix) {
+				t.Errorf("unexpected message %v", message)
+			}
+		}
+
+	})
+
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Stands for the number in a NOTE_LINKS URL template
+const note_link_id = "{id}"
+
+// Escapes the characters that mean something in mrkdwn, so that a note can't
+// add mentions or links of its own. Slack may have escaped them in the
+// command text already, in which case they're left as they are.
+var note_escaper = strings.NewReplacer(
+	"&amp;", "&amp;",
+	"&lt;", "&lt;",
+	"&gt;", "&gt;",
+	"&", "&amp;",
+	"<", "&lt;",
+	">", "&gt;")
+
+// Links references like "#4312" or "OPS-12" in a note to the URL for them.
+// `Prefix` is what comes before the number, and `Template` the URL with
+// `{id}` in place of it.
+type NoteLink struct {
+	Prefix   string
+	Template string
+}
+
+// Reads NOTE_LINKS, a comma separated list of prefixes and URL templates, e.g.
+//
+//	#=https://github.com/acme/app/pull/{id},OPS-=https://acme.atlassian.net/browse/OPS-{id}
+func noteLinks() ([]NoteLink, error) {
+
+	links := []NoteLink{}
+
+	for _, entry := range strings.Split(os.Getenv("NOTE_LINKS"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || !strings.Contains(parts[1], note_link_id) {
+			return nil, errors.New(fmt.Sprintf(
+				"%v should be a prefix and a URL containing %v, e.g. #=https://github.com/acme/app/pull/%v",
+				entry,
+				note_link_id,
+				note_link_id))
+		}
+
+		links = append(links, NoteLink{Prefix: parts[0], Template: parts[1]})
+	}
+
+	return links, nil
+
+}
+
+// Turns the references in a note into Slack links, e.g. "testing PR #4312"
+// into "testing PR <https://github.com/acme/app/pull/4312|#4312>", and
+// escapes the rest
+func linkNote(note string) string {
+
+	links, err := noteLinks()
+	if err != nil || len(links) == 0 {
+		return note_escaper.Replace(note)
+	}
+
+	// Longest prefix first, so that "OPS-" wins over "S-"
+	sort.SliceStable(links, func(i, j int) bool {
+		return len(links[i].Prefix) > len(links[j].Prefix)
+	})
+
+	templates := map[string]string{}
+	prefixes := []string{}
+	for _, link := range links {
+		templates[link.Prefix] = link.Template
+		prefixes = append(prefixes, regexp.QuoteMeta(link.Prefix))
+	}
+
+	// A reference has to start a word, so "abc#12" isn't one
+	reference := regexp.MustCompile(
+		"(\\A|[^\\w])(" + strings.Join(prefixes, "|") + ")(\\d+)\\b")
+
+	linked := ""
+	last := 0
+	for _, match := range reference.FindAllStringSubmatchIndex(note, -1) {
+		prefix := note[match[4]:match[5]]
+		id := note[match[6]:match[7]]
+		url := strings.Replace(templates[prefix], note_link_id, id, -1)
+
+		linked += note_escaper.Replace(note[last:match[4]]) +
+			fmt.Sprintf("<%v|%v%v>", url, note_escaper.Replace(prefix), id)
+		last = match[1]
+	}
+
+	return linked + note_escaper.Replace(note[last:])
+
+}
+
+// Renders the reservation's note to follow a description of it, e.g.
+// " (_testing PR #4312_)", or an empty string if it has none
+func noteText(reservation Reservation) string {
+
+	if reservation.Note == "" {
+		return ""
+	}
+
+	return fmt.Sprintf(" (_%v_)", linkNote(reservation.Note))
+
+}
+
+/*
+Sets or clears the note on the user's current (or else next) reservation.
+
+Run this locally with:
+
+	curl -XPOST \
+	     -H "Content-Type: application/json" \
+	     -d @example/note \
+	     http://localhost:8080/slack/commands/reservations
+*/
+func handleCommandNote(slack_request SlackRequest, args CommandArgs) (SlackResponse, bool) {
+
+	response := SlackResponse{}
+
+	// Extract data from command
+	resource := args["resource"]
+	note := args["note"]
+
+	if !IsValidResource(resource) {
+		response.Text = unknownResourceText(resource)
+		return response, true
+	}
+
+	var reservation Reservation
+	err := store.Update(func(tx *StoreTx) error {
+
+		reservation = tx.Reservations.FindByUser(resource, slack_request.User())
+		if !reservation.IsPresent() {
+			response.Text = noReservationText(resource, "add a note to")
+			return ErrRollback
+		}
+
+		reservation.Note = note
+		return tx.Reservations.Upsert(resource, reservation)
+	})
+
+	if err != nil {
+		log.Error(err)
+		return response, false
+	}
+
+	// No reservation to add a note to
+	if response.Text != "" {
+		return response, true
+	}
+
+	// Construct a response for the user
+	if note == "" {
+		response.Text = fmt.Sprintf(
+			"You've removed the note from your reservation on \"*%v*\"",
+			resource)
+	} else {
+		response.Text = fmt.Sprintf(
+			"Your reservation on \"*%v*\" now has the note _%v_",
+			resource,
+			linkNote(note))
+	}
+
+	return response, true
+
+}
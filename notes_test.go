@@ -0,0 +1,106 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestLinkNote(t *testing.T) {
+
+	old_links := os.Getenv("NOTE_LINKS")
+	defer os.Setenv("NOTE_LINKS", old_links)
+	os.Setenv("NOTE_LINKS", "#=https://github.com/acme/app/pull/{id}, OPS-=https://acme.atlassian.net/browse/OPS-{id}")
+
+	test_cases := map[string]string{
+		"testing PR #4312":     "testing PR <https://github.com/acme/app/pull/4312|#4312>",
+		"OPS-12,#7":            "<https://acme.atlassian.net/browse/OPS-12|OPS-12>,<https://github.com/acme/app/pull/7|#7>",
+		"abc#12 and #12a":      "abc#12 and #12a",
+		"nothing to link here": "nothing to link here",
+		"<!channel> & <@U123>": "&lt;!channel&gt; &amp; &lt;@U123&gt;",
+		"#1 &lt;b&gt; & co":    "<https://github.com/acme/app/pull/1|#1> &lt;b&gt; &amp; co",
+	}
+
+	for note, expected := range test_cases {
+		if actual := linkNote(note); actual != expected {
+			t.Error("expected", expected, "got", actual)
+		}
+	}
+
+	t.Run("NoLinks", func(t *testing.T) {
+
+		os.Setenv("NOTE_LINKS", "")
+		if actual := linkNote("a < b"); actual != "a &lt; b" {
+			t.Error("expected", "a &lt; b", "got", actual)
+		}
+
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+
+		for _, value := range []string{"#", "#=https://example.com", "=https://example.com/{id}"} {
+			os.Setenv("NOTE_LINKS", value)
+			if _, err := noteLinks(); err == nil {
+				t.Error(value, ": expected an error")
+			}
+		}
+
+	})
+
+}
+
+func TestHandleCommandNote(t *testing.T) {
+
+	//
+	// Setup
+	//
+
+	defer useResources("production, staging")()
+
+	defer useTempStore()()
+
+	old_links := os.Getenv("NOTE_LINKS")
+	defer os.Setenv("NOTE_LINKS", old_links)
+	os.Setenv("NOTE_LINKS", "#=https://github.com/acme/app/pull/{id}")
+
+	expectNote := func(resource string, expected string) {
+		reservation, _ := store.Get(resource)
+		if reservation.Note != expected {
+			t.Error(resource, ": expected", expected, "got", reservation.Note)
+		}
+	}
+
+	//
+	// Test
+	//
+
+	runCommand(t, handleCommandCreate, "alice", "reserve staging for 2 hours -- Testing PR #4312")
+	expectNote("staging", "Testing PR #4312")
+
+	expectMatch(t,
+		runCommand(t, handleCommandCreate, "bob", "reserve staging for 1 hour"),
+		"<@Ualice> has reserved \"\\*staging\\*\" for the next \\*2 hours, 0 minutes\\* "+
+			"\\(_Testing PR <https://github.com/acme/app/pull/4312\\|#4312>_\\)")
+
+	expectMatch(t,
+		runCommand(t, handleCommandShow, "bob", "list"),
+		"→  staging \\(reserved by <@Ualice>, expires in .*\\) \\(_Testing PR <https://github.com/acme/app/pull/4312\\|#4312>_\\)\n")
+
+	expectMatch(t,
+		runCommand(t, handleCommandNote, "alice", "note staging -- Now testing #4400"),
+		"Your reservation on \"\\*staging\\*\" now has the note _Now testing <https://github.com/acme/app/pull/4400\\|#4400>_")
+	expectNote("staging", "Now testing #4400")
+
+	expectMatch(t,
+		runCommand(t, handleCommandNote, "alice", "note staging"),
+		"You've removed the note from your reservation on \"\\*staging\\*\"")
+	expectNote("staging", "")
+
+	expectMatch(t,
+		runCommand(t, handleCommandNote, "bob", "note staging -- mine now"),
+		"You don't have any reservation on \"\\*staging\\*\" to add a note to")
+
+	expectMatch(t,
+		runCommand(t, handleCommandNote, "bob", "note foo -- bar"),
+		"I don't know what \"\\*foo\\*\" is")
+
+}
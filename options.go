@@ -4,31 +4,93 @@ import (
 	"fmt"
 	"os"
 	"regexp"
+	"strconv"
 )
 
 func validateOptions() {
 
-	resources := os.Getenv("RESOURCES")
-	if resources == "" {
-		fmt.Println("Please set environment variable RESOURCES")
+	// Resources only need configuring to seed the catalog the first time
+	// round, after which they're kept in the store
+	if os.Getenv("RESOURCES") != "" || resourcesFile() != "" {
+		err := configureResources()
+		if err != nil {
+			fmt.Printf("Invalid resources configuration: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if slackSigningSecret() == "" && !isLegacyTokenFallbackEnabled() {
+		fmt.Println("Please set environment variable SLACK_SIGNING_SECRET")
 		os.Exit(1)
 	}
 
+	// The legacy verification token is only required if it's been opted in
+	// to as a fallback
 	token := os.Getenv("SLACK_VERIFICATION_TOKEN")
-	if !regexp.MustCompile("\\A[a-zA-Z0-9]{24}\\z").Match([]byte(token)) {
+	if isLegacyTokenFallbackEnabled() &&
+		!regexp.MustCompile("\\A[a-zA-Z0-9]{24}\\z").Match([]byte(token)) {
 		fmt.Println(
 			"Environment variable SLACK_VERIFICATION_TOKEN missing or invalid")
 		os.Exit(1)
 	}
 
+	if !isValidStoreType(storeType()) {
+		fmt.Printf(
+			"Environment variable RESERVATIONS_STORE must be one of [%v, %v]\n",
+			STORE_TYPE_FILE,
+			STORE_TYPE_BOLT)
+		os.Exit(1)
+	}
+
+	// Members of the admin user group are looked up with the bot token
+	if adminUsergroupId() != "" && slackBotToken() == "" {
+		fmt.Println(
+			"Environment variable SLACK_BOT_TOKEN is required to use ADMIN_USERGROUP_ID")
+		os.Exit(1)
+	}
+
+	if _, err := noteLinks(); err != nil {
+		fmt.Printf("Environment variable NOTE_LINKS is invalid: %v\n", err)
+		os.Exit(1)
+	}
+
+	lead, err := strconv.Atoi(reminderLeadMinutes())
+	if err != nil || lead < 0 {
+		fmt.Println(
+			"Environment variable REMINDER_LEAD_MINUTES must be a number of minutes")
+		os.Exit(1)
+	}
+
 }
 
 func logOptions() {
 
-	log.Infof("Available resources: %v", ListOfResourcesToString())
-	log.Infof(
-		"Slack API Token: %v",
-		maskToken(os.Getenv("SLACK_VERIFICATION_TOKEN")),
-	)
+	if resourcesFile() != "" {
+		log.Infof("Resources file: %v", resourcesFile())
+	}
+	log.Infof("Admins: %v", adminUserIds())
+	if adminUsergroupId() != "" {
+		log.Infof("Admin user group: %v", adminUsergroupId())
+	}
+	log.Infof("Slack Signing Secret: %v", maskToken(slackSigningSecret()))
+	if isLegacyTokenFallbackEnabled() {
+		log.Warningf(
+			"Slack API Token (legacy fallback): %v",
+			maskToken(os.Getenv("SLACK_VERIFICATION_TOKEN")),
+		)
+	}
+	log.Infof("Reservations store: %v (%v)", storeType(), reservations_dir)
+	if statsApiToken() == "" {
+		log.Infof("Stats API: disabled")
+	} else {
+		log.Infof("Stats API Token: %v", maskToken(statsApiToken()))
+	}
+	if slackBotToken() == "" {
+		log.Infof("Slack Bot Token: not set, notifications are disabled")
+	} else {
+		log.Infof("Slack Bot Token: %v", maskToken(slackBotToken()))
+		log.Infof("Slack API: %v", slackApiUrl())
+		log.Infof("Reminder lead time: %v minutes", reminderLeadMinutes())
+	}
 
 }
@@ -12,9 +12,36 @@ const (
 	SECS_PER_MINUTE = 60
 )
 
+// Layout used when displaying the start or end of a reservation
+const reservation_time_layout = "Mon Jan 2 3:04pm"
+
+// A reservation of a resource by a user from `StartAt` until `EndAt`.
+// Reservations written before start times were introduced have a zero
+// `StartAt`, and are treated as having started immediately.
+//
+// The holder is identified by `UserId` and `TeamId` (see `UserIdentity`).
+// `Reminded` records that they've been warned it's about to expire. `Note`
+// is what they've said it's for, if anything.
 type Reservation struct {
-	User  string    `json:"user"`
-	EndAt time.Time `json:"end_at"`
+	User     string    `json:"user"`
+	UserId   string    `json:"user_id,omitempty"`
+	TeamId   string    `json:"team_id,omitempty"`
+	StartAt  time.Time `json:"start_at"`
+	EndAt    time.Time `json:"end_at"`
+	Reminded bool      `json:"reminded,omitempty"`
+	Note     string    `json:"note,omitempty"`
+}
+
+func (r Reservation) Holder() UserIdentity {
+
+	return UserIdentity{Id: r.UserId, TeamId: r.TeamId, Name: r.User}
+
+}
+
+func (r Reservation) IsHeldBy(user UserIdentity) bool {
+
+	return r.Holder().Is(user)
+
 }
 
 func (r Reservation) IsPresent() bool {
@@ -24,7 +51,72 @@ func (r Reservation) IsPresent() bool {
 }
 
 func (r Reservation) IsActive() bool {
-	return !r.EndAt.IsZero() && r.EndAt.After(time.Now())
+	return !r.EndAt.IsZero() && r.EndAt.After(time.Now()) && !r.IsUpcoming()
+}
+
+// Whether the reservation is booked to start some time in the future
+func (r Reservation) IsUpcoming() bool {
+
+	return r.StartAt.After(time.Now())
+
+}
+
+func (r Reservation) IsExpired() bool {
+
+	return !r.EndAt.After(time.Now())
+
+}
+
+// How long the reservation runs for in total. Reservations made before
+// start times were recorded count as starting now.
+func (r Reservation) Length() time.Duration {
+
+	if r.StartAt.IsZero() {
+		return time.Until(r.EndAt)
+	}
+
+	return r.EndAt.Sub(r.StartAt)
+
+}
+
+// Whether the two reservations cover any of the same time
+func (r Reservation) Overlaps(other Reservation) bool {
+
+	return r.StartAt.Before(other.EndAt) && other.StartAt.Before(r.EndAt)
+
+}
+
+// Two reservations are the same booking if they were made by the same user
+// for the same start time, even if one has since been extended
+func (r Reservation) IsSameBooking(other Reservation) bool {
+
+	return r.Holder().Is(other.Holder()) && r.StartAt.Equal(other.StartAt)
+
+}
+
+// Renders e.g. "Tue Aug 15 2:00pm - 5:00pm", including the end date only if
+// it's on a different day
+func (r Reservation) PeriodToString() string {
+
+	start := r.StartAt.Local()
+	end := r.EndAt.Local()
+
+	end_layout := "3:04pm"
+	if start.YearDay() != end.YearDay() || start.Year() != end.Year() {
+		end_layout = reservation_time_layout
+	}
+
+	return fmt.Sprintf(
+		"%v - %v",
+		start.Format(reservation_time_layout),
+		end.Format(end_layout))
+
+}
+
+func (r Reservation) Mention() string {
+
+	return r.Holder().Mention()
+
 }
 
 func (r Reservation) RemainingTimeToString() string {
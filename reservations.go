@@ -5,9 +5,11 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"sort"
 )
 
-type Reservations map[string]Reservation
+// Schedule of reservations for each resource, keyed by resource
+type Reservations map[string]Schedule
 
 func NewReservations() (Reservations, error) {
 
@@ -26,7 +28,11 @@ func NewReservations() (Reservations, error) {
 	err = json.Unmarshal(body, &reservations)
 	if err != nil {
 		log.Error("Could not unmarshal JSON data")
-		return reservations, err
+
+		reservations = Reservations{}
+		if !recoverFromSnapshot(reservations_file, &reservations, err) {
+			return nil, err
+		}
 	}
 
 	return reservations, nil
@@ -45,7 +51,7 @@ func (r Reservations) WriteToFile() error {
 	}
 
 	// Write to file
-	err = ioutil.WriteFile(reservations_file, body, 0755)
+	err = writeFileAtomically(reservations_file, body, 0644)
 	if err != nil {
 		log.Error("Could not write to file")
 		return err
@@ -55,32 +61,137 @@ func (r Reservations) WriteToFile() error {
 
 }
 
+// Returns the reservation currently in effect on the resource, or the zero
+// value `Reservation{}` if it's free. Resources with several slots may have
+// others in effect too (see `Schedule.Active()`).
 func (r Reservations) FindByResource(resource string) Reservation {
 
-	return r[resource]
+	return r[resource].Current()
+
+}
+
+// Returns the user's current reservation on the resource if they have one,
+// otherwise their next upcoming one, otherwise the zero value
+func (r Reservations) FindByUser(resource string, user UserIdentity) Reservation {
+
+	for _, current := range r[resource].Active() {
+		if current.IsHeldBy(user) {
+			return current
+		}
+	}
+
+	for _, reservation := range r[resource].Upcoming() {
+		if reservation.IsHeldBy(user) {
+			return reservation
+		}
+	}
+
+	return Reservation{}
 
 }
 
+// Whether every slot on the resource is in use right now
+func (r Reservations) IsFull(resource string) bool {
+
+	config, _ := FindResource(resource)
+	return len(r[resource].Active()) >= config.Slots()
+
+}
+
+// Adds the reservation to the resource's schedule, replacing any earlier
+// version of the same booking (see `IsSameBooking()`). Returns a
+// `*ConflictError` if there'd be no slot free for it, or it would overlap
+// with another of the holder's reservations.
 func (r Reservations) Upsert(resource string, reservation Reservation) error {
 
-	if !IsValidResource(resource) {
+	config, ok := FindResource(resource)
+	if !ok {
 		return errors.New(fmt.Sprintf("Invalid Resource: %v", resource))
 	}
 
-	r[resource] = reservation
+	schedule := r[resource]
+
+	if conflict, ok := schedule.FindConflict(reservation, config.Slots()); ok {
+		return &ConflictError{Resource: resource, Conflict: conflict}
+	}
+
+	if i := schedule.indexOf(reservation); i >= 0 {
+		schedule[i] = reservation
+	} else {
+		schedule = append(schedule, reservation)
+	}
+
+	schedule.sort()
+	r[resource] = schedule
+
 	return nil
 
 }
 
-func (r Reservations) Delete(resource string) error {
+// Removes the booking from the resource's schedule, if it's there
+func (r Reservations) Delete(resource string, reservation Reservation) error {
 
 	if !IsValidResource(resource) {
 		return errors.New(fmt.Sprintf("Invalid Resource: %v", resource))
 	}
 
-	if (r[resource] != Reservation{}) {
+	schedule := r[resource]
+
+	if i := schedule.indexOf(reservation); i >= 0 {
+		schedule = append(schedule[:i:i], schedule[i+1:]...)
+	}
+
+	if len(schedule) == 0 {
 		delete(r, resource)
+	} else {
+		r[resource] = schedule
 	}
+
 	return nil
 
 }
+
+// Returns the resources, in alphabetical order, that still have current or
+// upcoming reservations but can no longer be reserved, because they've been
+// removed or retired
+func (r Reservations) Orphaned() []string {
+
+	orphaned := []string{}
+
+	for resource, schedule := range r {
+		if config, ok := FindResource(resource); ok && !config.Retired {
+			continue
+		}
+
+		for _, reservation := range schedule {
+			if !reservation.IsExpired() {
+				orphaned = append(orphaned, resource)
+				break
+			}
+		}
+	}
+
+	sort.Strings(orphaned)
+	return orphaned
+
+}
+
+// Drops reservations that have already ended
+func (r Reservations) Prune() {
+
+	for resource, schedule := range r {
+		kept := Schedule{}
+		for _, reservation := range schedule {
+			if !reservation.IsExpired() {
+				kept = append(kept, reservation)
+			}
+		}
+
+		if len(kept) == 0 {
+			delete(r, resource)
+		} else {
+			r[resource] = kept
+		}
+	}
+
+}
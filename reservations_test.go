@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"regexp"
 	"testing"
 	"time"
@@ -16,19 +17,17 @@ func TestNewReservations(t *testing.T) {
 	// Setup
 	//
 
-	old_env := os.Getenv("RESOURCES")
-	defer os.Setenv("RESOURCES", old_env)
-	os.Setenv("RESOURCES", "production, staging")
+	defer useResources("production, staging")()
 
 	reservations_file = reservations_file + ".test"
 
 	t.Run("Success", func(t *testing.T) {
 
 		expected := Reservations{
-			"production": Reservation{
-				User: "foo", EndAt: time.Now().AddDate(0, 0, 1)},
-			"staging": Reservation{
-				User: "foo", EndAt: time.Now().AddDate(0, 0, 2)},
+			"production": Schedule{Reservation{
+				User: "foo", EndAt: time.Now().AddDate(0, 0, 1)}},
+			"staging": Schedule{Reservation{
+				User: "foo", EndAt: time.Now().AddDate(0, 0, 2)}},
 		}
 
 		body, err := json.Marshal(expected)
@@ -54,10 +53,12 @@ func TestNewReservations(t *testing.T) {
 		}
 
 		for key, value := range expected {
-			e := value
-			a := actual[key]
+			e := value[0]
+			a := actual.FindByResource(key)
 
-			if a != e {
+			// Compare times with Equal() since the monotonic clock reading
+			// and location don't survive the JSON round trip
+			if a.User != e.User || !a.EndAt.Equal(e.EndAt) {
 				t.Error(
 					"expected", e,
 					"got", a,
@@ -66,6 +67,26 @@ func TestNewReservations(t *testing.T) {
 		}
 	})
 
+	t.Run("LegacyFormat", func(t *testing.T) {
+
+		// Before start times, each resource had a single reservation
+		err := writeToReservationsFile(
+			"{\"staging\":{\"user\":\"foo\",\"end_at\":\"2100-01-01T00:00:00Z\"}}")
+		if err != nil {
+			t.Error("Expected no error writing to file. Got", err)
+		}
+
+		actual, err := NewReservations()
+		if err != nil {
+			t.Error("Error while calling NewReservations():", err)
+		}
+
+		reservation := actual.FindByResource("staging")
+		if reservation.User != "foo" || !reservation.IsActive() {
+			t.Error("expected an active reservation by foo, got", reservation)
+		}
+	})
+
 	t.Run("FailToReadFromFile", func(t *testing.T) {
 
 		err := writeToReservationsFile("{}")
@@ -121,21 +142,23 @@ func TestWriteToFile(t *testing.T) {
 	// Setup
 	//
 
-	old_env := os.Getenv("RESOURCES")
-	defer os.Setenv("RESOURCES", old_env)
-	os.Setenv("RESOURCES", "production, staging")
+	defer useResources("production, staging")()
 
 	reservations_file = reservations_file + ".test"
 
 	dateFormat := "2006-01-02T15:04:05.000000000-07:00"
+	start_timestamp := "2017-08-11T15:48:37.556835687-04:00"
 	timestamp := "2017-08-11T17:48:37.556835687-04:00"
 
 	t.Run("Success", func(t *testing.T) {
 
+		startAt, _ := time.Parse(dateFormat, start_timestamp)
 		endAt, _ := time.Parse(dateFormat, timestamp)
 
 		reservations := Reservations{
-			"staging": Reservation{User: "foo", EndAt: endAt},
+			"staging": Schedule{
+				Reservation{User: "foo", StartAt: startAt, EndAt: endAt},
+			},
 		}
 
 		err := reservations.WriteToFile()
@@ -145,8 +168,9 @@ func TestWriteToFile(t *testing.T) {
 
 		expected :=
 			fmt.Sprintf(
-				"{\"staging\":{\"user\":\"%v\",\"end_at\":\"%v\"}}",
-				reservations["staging"].User,
+				"{\"staging\":[{\"user\":\"%v\",\"start_at\":\"%v\",\"end_at\":\"%v\"}]}",
+				reservations["staging"][0].User,
+				start_timestamp,
 				timestamp,
 			)
 
@@ -201,15 +225,13 @@ func TestWriteToFile(t *testing.T) {
 
 func TestFindByResource(t *testing.T) {
 
-	old_env := os.Getenv("RESOURCES")
-	defer os.Setenv("RESOURCES", old_env)
-	os.Setenv("RESOURCES", "production, staging")
+	defer useResources("production, staging")()
 
 	reservations_file = reservations_file + ".test"
 
 	r1 := Reservation{User: "abc", EndAt: time.Now().AddDate(0, 0, 1)}
 	r2 := Reservation{User: "def", EndAt: time.Now().AddDate(0, 0, 1)}
-	reservations := Reservations{"production": r1, "staging": r2}
+	reservations := Reservations{"production": Schedule{r1}, "staging": Schedule{r2}}
 
 	test_cases := map[string]Reservation{
 		"production": r1,
@@ -232,9 +254,7 @@ func TestUpsert(t *testing.T) {
 
 	// Setup
 
-	old_env := os.Getenv("RESOURCES")
-	defer os.Setenv("RESOURCES", old_env)
-	os.Setenv("RESOURCES", "production, staging")
+	defer useResources("production, staging")()
 
 	reservations_file = reservations_file + ".test"
 
@@ -242,13 +262,26 @@ func TestUpsert(t *testing.T) {
 
 		r1 := Reservation{User: "abc", EndAt: time.Now().AddDate(0, 0, 1)}
 		r2 := Reservation{User: "def", EndAt: time.Now().AddDate(0, 0, 1)}
-		r3 := Reservation{User: "ghi", EndAt: time.Now().AddDate(0, 0, 1)}
 
-		reservations := Reservations{"production": r1, "staging": r2}
+		// Same booking as r2, extended
+		r2_extended := r2
+		r2_extended.EndAt = r2.EndAt.AddDate(0, 0, 1)
 
-		err := reservations.Upsert("staging", r3)
+		// Starts once r2_extended ends
+		r3 := Reservation{
+			User:    "ghi",
+			StartAt: r2_extended.EndAt,
+			EndAt:   r2_extended.EndAt.AddDate(0, 0, 1),
+		}
 
-		if err != nil {
+		reservations := Reservations{"production": Schedule{r1}, "staging": Schedule{r2}}
+
+		// Upsert out of order to check they're kept sorted
+		if err := reservations.Upsert("staging", r3); err != nil {
+			t.Error("Expected no error, got", err)
+		}
+
+		if err := reservations.Upsert("staging", r2_extended); err != nil {
 			t.Error("Expected no error, got", err)
 		}
 
@@ -256,8 +289,41 @@ func TestUpsert(t *testing.T) {
 			t.Error("expected", r1, "got", actual)
 		}
 
-		if actual := reservations.FindByResource("staging"); actual != r3 {
-			t.Error("expected", r3, "got", actual)
+		if actual := reservations.FindByResource("staging"); actual != r2_extended {
+			t.Error("expected", r2_extended, "got", actual)
+		}
+
+		expected := Schedule{r2_extended, r3}
+		if actual := reservations["staging"]; len(actual) != 2 ||
+			actual[0] != expected[0] || actual[1] != expected[1] {
+			t.Error("expected", expected, "got", actual)
+		}
+
+	})
+
+	t.Run("Conflict", func(t *testing.T) {
+
+		r1 := Reservation{User: "abc", EndAt: time.Now().AddDate(0, 0, 1)}
+		r2 := Reservation{
+			User:    "def",
+			StartAt: time.Now().Add(time.Hour),
+			EndAt:   time.Now().AddDate(0, 0, 2),
+		}
+
+		reservations := Reservations{"staging": Schedule{r1}}
+
+		err := reservations.Upsert("staging", r2)
+
+		if !isConflictError(err) {
+			t.Fatal("expected a conflict error, got", err)
+		}
+
+		if actual := err.(*ConflictError).Conflict; actual != r1 {
+			t.Error("expected", r1, "got", actual)
+		}
+
+		if actual := reservations["staging"]; len(actual) != 1 {
+			t.Error("expected", Schedule{r1}, "got", actual)
 		}
 
 	})
@@ -268,7 +334,7 @@ func TestUpsert(t *testing.T) {
 		r2 := Reservation{User: "def", EndAt: time.Now().AddDate(0, 0, 1)}
 		r3 := Reservation{User: "ghi", EndAt: time.Now().AddDate(0, 0, 1)}
 
-		reservations := Reservations{"production": r1, "staging": r2}
+		reservations := Reservations{"production": Schedule{r1}, "staging": Schedule{r2}}
 
 		err := reservations.Upsert("foo", r3)
 
@@ -290,13 +356,49 @@ func TestUpsert(t *testing.T) {
 	})
 }
 
+func TestFindConflictWithSlots(t *testing.T) {
+
+	now := time.Now()
+	at := func(hours int) time.Time { return now.Add(time.Duration(hours) * time.Hour) }
+
+	// Two slots, with one in use from 0 to 4 and another from 2 to 3
+	schedule := Schedule{
+		{User: "alice", StartAt: at(0), EndAt: at(4)},
+		{User: "bob", StartAt: at(2), EndAt: at(3)},
+	}
+
+	test_cases := []struct {
+		reservation Reservation
+		expected    string
+	}{
+		{Reservation{User: "carol", StartAt: at(0), EndAt: at(2)}, ""},
+		{Reservation{User: "carol", StartAt: at(3), EndAt: at(5)}, ""},
+		{Reservation{User: "carol", StartAt: at(1), EndAt: at(5)}, "bob"},
+		{Reservation{User: "carol", StartAt: at(2), EndAt: at(3)}, "bob"},
+		{Reservation{User: "alice", StartAt: at(5), EndAt: at(6)}, ""},
+		// A user's own reservations never overlap, even with a slot free
+		{Reservation{User: "alice", StartAt: at(3), EndAt: at(5)}, "alice"},
+	}
+
+	for _, test_case := range test_cases {
+		conflict, ok := schedule.FindConflict(test_case.reservation, 2)
+		if ok != (test_case.expected != "") || conflict.User != test_case.expected {
+			t.Error(test_case.reservation, ": expected", test_case.expected, "got", conflict.User)
+		}
+	}
+
+	// With a single slot anything overlapping conflicts
+	if conflict, _ := schedule.FindConflict(Reservation{User: "carol", StartAt: at(0), EndAt: at(1)}, 1); conflict.User != "alice" {
+		t.Error("expected", "alice", "got", conflict.User)
+	}
+
+}
+
 func TestDelete(t *testing.T) {
 
 	// Setup
 
-	old_env := os.Getenv("RESOURCES")
-	defer os.Setenv("RESOURCES", old_env)
-	os.Setenv("RESOURCES", "production, staging")
+	defer useResources("production, staging")()
 
 	reservations_file = reservations_file + ".test"
 
@@ -306,9 +408,9 @@ func TestDelete(t *testing.T) {
 		r2 := Reservation{User: "def", EndAt: time.Now().AddDate(0, 0, 1)}
 		zero_value := Reservation{}
 
-		reservations := Reservations{"production": r1, "staging": r2}
+		reservations := Reservations{"production": Schedule{r1}, "staging": Schedule{r2}}
 
-		err := reservations.Delete("staging")
+		err := reservations.Delete("staging", r2)
 
 		if err != nil {
 			t.Error("Expected no error, got", err)
@@ -329,9 +431,9 @@ func TestDelete(t *testing.T) {
 		r1 := Reservation{User: "abc", EndAt: time.Now().AddDate(0, 0, 1)}
 		r2 := Reservation{User: "def", EndAt: time.Now().AddDate(0, 0, 1)}
 
-		reservations := Reservations{"production": r1, "staging": r2}
+		reservations := Reservations{"production": Schedule{r1}, "staging": Schedule{r2}}
 
-		err := reservations.Delete("foo")
+		err := reservations.Delete("foo", r1)
 
 		if err == nil ||
 			!regexp.MustCompile("Invalid Resource").MatchString(err.Error()) {
@@ -355,9 +457,9 @@ func TestDelete(t *testing.T) {
 		r1 := Reservation{User: "abc", EndAt: time.Now().AddDate(0, 0, 1)}
 		zero_value := Reservation{}
 
-		reservations := Reservations{"production": r1}
+		reservations := Reservations{"production": Schedule{r1}}
 
-		err := reservations.Delete("staging")
+		err := reservations.Delete("staging", r1)
 
 		if err != nil {
 			t.Error("Expected no error, got", err)
@@ -400,3 +502,105 @@ func writeToReservationsFile(body string) error {
 	return nil
 
 }
+
+func TestWriteToFileSnapshots(t *testing.T) {
+
+	//
+	// Setup
+	//
+
+	defer useResources("production, staging")()
+
+	dir, cleanup := useTempStoreDir()
+	defer cleanup()
+
+	// Write one more version than there are snapshots, so the oldest is
+	// rotated out
+	users := []string{"a", "b", "c", "d", "e"}
+	for _, user := range users {
+		reservations := Reservations{
+			"staging": Schedule{
+				Reservation{User: user, EndAt: time.Now().AddDate(0, 0, 1)},
+			},
+		}
+
+		err := reservations.WriteToFile()
+		if err != nil {
+			t.Fatal("Error while calling WriteToFile():", err)
+		}
+	}
+
+	t.Run("KeepsSnapshots", func(t *testing.T) {
+
+		// Newest first
+		expected := []string{"d", "c", "b"}
+
+		for i, user := range expected {
+			body, err := ioutil.ReadFile(snapshotPath(reservations_file, i+1))
+			if err != nil {
+				t.Fatal("Error reading snapshot", err)
+			}
+
+			var snapshot Reservations
+			json.Unmarshal(body, &snapshot)
+
+			if actual := snapshot.FindByResource("staging").User; actual != user {
+				t.Error("expected", user, "got", actual)
+			}
+		}
+
+		_, err := os.Stat(snapshotPath(reservations_file, len(expected)+1))
+		if !os.IsNotExist(err) {
+			t.Error("expected only", len(expected), "snapshots to be kept")
+		}
+
+	})
+
+	t.Run("DoesNotLeaveTempFiles", func(t *testing.T) {
+
+		matches, _ := filepath.Glob(filepath.Join(dir, "*.tmp*"))
+		if len(matches) != 0 {
+			t.Error("expected no temp files, got", matches)
+		}
+
+	})
+
+	t.Run("RecoverFromSnapshot", func(t *testing.T) {
+
+		// Simulate a crash mid-write on the main file
+		err := ioutil.WriteFile(reservations_file, []byte("{\"stag"), 0644)
+		if err != nil {
+			panic(err)
+		}
+
+		actual, err := NewReservations()
+		if err != nil {
+			t.Fatal("Expected no error, got", err)
+		}
+
+		if user := actual.FindByResource("staging").User; user != "d" {
+			t.Error("expected", "d", "got", user)
+		}
+
+	})
+
+	t.Run("SkipsCorruptSnapshots", func(t *testing.T) {
+
+		err := ioutil.WriteFile(
+			snapshotPath(reservations_file, 1), []byte("garbage"), 0644)
+		if err != nil {
+			panic(err)
+		}
+
+		actual, err := NewReservations()
+		if err != nil {
+			t.Fatal("Expected no error, got", err)
+		}
+
+		if user := actual.FindByResource("staging").User; user != "c" {
+			t.Error("expected", "c", "got", user)
+		}
+
+	})
+
+}
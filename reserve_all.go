@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// A resource that was reserved, e.g. "qa-2" for "any qa"
+type reservedResource struct {
+	Resource    string
+	Reservation Reservation
+}
+
+/*
+Reserves several resources at once, e.g. a server and its database, for when
+they're needed together. Either all of them are reserved or none are.
+
+Each requested resource has one or more candidates. "any qa" can be met by any
+resource in the qa group, so they're tried in turn until one is free.
+
+Run this locally with:
+
+	curl -XPOST \
+	     -H "Content-Type: application/json" \
+	     -d @example/create-many \
+	     http://localhost:8080/slack/commands/reservations
+*/
+func reserveAll(
+	slack_request SlackRequest,
+	resources []string,
+	candidates map[string][]Resource,
+	start_at time.Time,
+	starts_now bool,
+	durations map[string]time.Duration,
+	note string,
+	location *time.Location) (SlackResponse, bool) {
+
+	response := SlackResponse{}
+
+	// Reserve them in a single transaction, so that if any of them is taken
+	// the others are left alone
+	var reserved []reservedResource
+	var blocked []string
+	var promotions []Promotion
+	err := store.Update(func(tx *StoreTx) error {
+
+		pruneExpiredUnlessScheduled(tx)
+
+		for _, requested := range resources {
+			var first_conflict *ConflictError
+
+			for _, candidate := range candidates[requested] {
+				// If the resource has freed up and people are waiting for it,
+				// the first in line gets it rather than whoever asks next
+				if promotion, ok := promoteWaitlist(tx, candidate.Name); ok {
+					promotions = append(promotions, promotion)
+				}
+
+				reservation, err := reserveResource(
+					tx, slack_request, candidate.Name, start_at, durations[candidate.Name], starts_now, note)
+				if isConflictError(err) {
+					if first_conflict == nil {
+						first_conflict = err.(*ConflictError)
+					}
+					continue
+				}
+				if err != nil {
+					return err
+				}
+
+				reserved = append(reserved, reservedResource{
+					Resource:    candidate.Name,
+					Reservation: reservation,
+				})
+				first_conflict = nil
+				break
+			}
+
+			if first_conflict == nil {
+				continue
+			}
+			if group, ok := anyGroupName(requested); ok {
+				blocked = append(blocked, groupTakenText(group))
+			} else {
+				blocked = append(blocked, blockedText(first_conflict, slack_request, starts_now))
+			}
+		}
+
+		return rollbackUnless(len(blocked) == 0)
+	})
+
+	if err != nil {
+		log.Error(err)
+		return response, false
+	}
+
+	// Promotions are only saved along with the reservations
+	if len(blocked) == 0 {
+		sendNotificationsInBackground(promotionNotifications(promotions))
+	}
+
+	// Construct a response for the user
+	if len(resources) == 1 {
+		if len(blocked) > 0 {
+			response.Text = blocked[0]
+			return response, true
+		}
+
+		return reservedResponse(reserved[0].Resource, reserved[0].Reservation, location), true
+	}
+
+	lines := []string{}
+
+	if len(blocked) > 0 {
+		lines = append(lines, "Sorry, I couldn't reserve all of them, so I haven't reserved any:")
+		for _, text := range blocked {
+			lines = append(lines, "• "+text)
+		}
+
+		response.Text = strings.Join(lines, "\n")
+		return response, true
+	}
+
+	lines = append(lines, "You've successfully reserved:")
+	for _, r := range reserved {
+		if r.Reservation.IsUpcoming() {
+			lines = append(lines, fmt.Sprintf(
+				"• \"*%v*\" for *%v*",
+				r.Resource,
+				r.Reservation.PeriodToString()))
+		} else {
+			lines = append(lines, fmt.Sprintf(
+				"• \"*%v*\" for the next *%v* (until %v)",
+				r.Resource,
+				r.Reservation.RemainingTimeToString(),
+				endTimeText(r.Reservation.EndAt, location)))
+		}
+	}
+
+	response.Text = strings.Join(lines, "\n")
+
+	return response, true
+
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHandleCommandCreateMany(t *testing.T) {
+
+	//
+	// Setup
+	//
+
+	defer useResources("production, staging, staging-db, qa")()
+
+	defer useTempStore()()
+
+	expectHolder := func(resource string, expected string) {
+		reservation, _ := store.Get(resource)
+		if reservation.User != expected {
+			t.Error(resource, ": expected", expected, "got", reservation.User)
+		}
+	}
+
+	//
+	// Test
+	//
+
+	t.Run("Success", func(t *testing.T) {
+
+		actual := runCommand(t, handleCommandCreate, "alice", "reserve staging, staging-db for 2 hours")
+		expectMatch(t, actual, "\\AYou've successfully reserved:\n")
+		expectMatch(t, actual, "• \"\\*staging\\*\" for the next \\*2 hours, 0 minutes\\* \\(until ")
+		expectMatch(t, actual, "• \"\\*staging-db\\*\" for the next \\*2 hours, 0 minutes\\*")
+
+		expectHolder("staging", "alice")
+		expectHolder("staging-db", "alice")
+
+		events, _ := store.History("staging-db", time.Time{})
+		if len(events) != 1 || events[0].Action != HISTORY_RESERVE {
+			t.Error("expected a reserve event, got", events)
+		}
+
+	})
+
+	t.Run("Blocked", func(t *testing.T) {
+
+		actual := runCommand(t, handleCommandCreate, "bob", "reserve qa, staging-db for 1 hour")
+		expectMatch(t, actual, "\\ASorry, I couldn't reserve all of them, so I haven't reserved any:\n")
+		expectMatch(t, actual, "• <@Ualice> has reserved \"\\*staging-db\\*\" for the next \\*2 hours, 0 minutes\\*\\z")
+
+		// Nothing was reserved
+		expectHolder("qa", "")
+
+	})
+
+	t.Run("Future", func(t *testing.T) {
+
+		actual := runCommand(t, handleCommandCreate, "carol", "reserve qa, staging tomorrow 2pm for 1 hour")
+		expectMatch(t, actual, "• \"\\*qa\\*\" for \\*.* 2:00pm - 3:00pm\\*\n")
+		expectMatch(t, actual, "• \"\\*staging\\*\" for \\*.* 2:00pm - 3:00pm\\*\\z")
+
+		actual = runCommand(t, handleCommandCreate, "dave", "reserve production, qa tomorrow 2:30pm for 1 hour")
+		expectMatch(t, actual, "• Sorry, that would overlap with <@Ucarol>'s reservation of \"\\*qa\\*\"")
+
+		reservations, _ := store.List()
+		if len(reservations["production"]) != 0 {
+			t.Error("expected production not to be booked, got", reservations["production"])
+		}
+
+	})
+
+	t.Run("InvalidResource", func(t *testing.T) {
+
+		expectMatch(t,
+			runCommand(t, handleCommandCreate, "bob", "reserve production, foo for 1 hour"),
+			"I don't know what \"\\*foo\\*\" is")
+
+		expectHolder("production", "")
+
+	})
+
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+)
+
+var catalog_file = filepath.Join(reservations_dir, "catalog.json")
+
+// The catalog as it's kept in the store, along with the resources from
+// RESOURCES_FILE (or RESOURCES) it was last synced with. The catalog itself
+// is at the top level, so catalogs saved before `Source` was recorded still
+// load.
+type SavedCatalog struct {
+	ResourceConfig
+	Source ResourceConfig `json:"source"`
+}
+
+// Reads the resource catalog saved by `FileStore`. A missing file means the
+// catalog hasn't been seeded yet.
+func NewResourceCatalog() (SavedCatalog, error) {
+
+	log.Debugf("Reading catalog file %v", catalog_file)
+
+	catalog := SavedCatalog{}
+
+	body, err := ioutil.ReadFile(catalog_file)
+	if os.IsNotExist(err) {
+		return catalog, nil
+	}
+	if err != nil {
+		log.Error("Could not read from file")
+		return catalog, err
+	}
+
+	err = json.Unmarshal(body, &catalog)
+	if err != nil {
+		log.Error("Could not unmarshal JSON data")
+
+		catalog = SavedCatalog{}
+		if !recoverFromSnapshot(catalog_file, &catalog, err) {
+			return catalog, err
+		}
+	}
+
+	return catalog, nil
+
+}
+
+func (c SavedCatalog) WriteToFile() error {
+
+	log.Debugf("Writing to catalog file %v", catalog_file)
+
+	body, err := json.Marshal(c)
+	if err != nil {
+		log.Error("Could not marshal JSON data")
+		return err
+	}
+
+	err = writeFileAtomically(catalog_file, body, 0644)
+	if err != nil {
+		log.Error("Could not write to file")
+		return err
+	}
+
+	return nil
+
+}
+
+// Loads the resource catalog from the store, seeding it from RESOURCES_FILE
+// or RESOURCES the first time round. After that, changes made to the file
+// since the catalog was last synced with it are applied, even if they were
+// made while the server was stopped. Otherwise the catalog is only changed
+// by admin subcommands.
+func configureResourceCatalog() error {
+
+	var catalog ResourceConfig
+
+	err := store.Update(func(tx *StoreTx) error {
+		changed := tx.seedCatalog()
+		if !changed {
+			var err error
+			changed, err = tx.syncCatalogSource(resource_file_config)
+			if err != nil {
+				return err
+			}
+		}
+		catalog = tx.Catalog
+
+		return rollbackUnless(changed)
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(catalog.Resources) == 0 {
+		return errors.New(
+			"No resources configured. Set RESOURCES or RESOURCES_FILE")
+	}
+
+	setResourceConfig(catalog)
+	return nil
+
+}
+
+// Seeds an empty catalog with the configured resources. Returns whether it
+// did so.
+func (tx *StoreTx) seedCatalog() bool {
+
+	if len(tx.Catalog.Resources) > 0 {
+		return false
+	}
+
+	tx.Catalog = currentResourceConfig()
+	tx.CatalogSource = normalizeResourceConfig(resource_file_config)
+	return len(tx.Catalog.Resources) > 0
+
+}
+
+// Applies the changes between the resources the catalog was last synced
+// with and `config`, and records `config` as synced. Returns whether
+// anything changed.
+func (tx *StoreTx) syncCatalogSource(config ResourceConfig) (bool, error) {
+
+	if len(config.Resources) == 0 {
+		return false, nil
+	}
+
+	config = normalizeResourceConfig(config)
+	if reflect.DeepEqual(tx.CatalogSource, config) {
+		return false, nil
+	}
+
+	// Catalogs saved before their source was recorded are taken to be in
+	// sync with the file as this process last read it
+	source := tx.CatalogSource
+	if len(source.Resources) == 0 {
+		source = normalizeResourceConfig(resource_file_config)
+	}
+
+	catalog, err := syncCatalog(tx.Catalog, source, config)
+	if err != nil {
+		return false, err
+	}
+
+	tx.Catalog = catalog
+	tx.CatalogSource = config
+	return true, nil
+
+}
+
+// Puts the config in the form it takes once saved and loaded again, so that
+// it can be compared with one read from the store
+func normalizeResourceConfig(config ResourceConfig) ResourceConfig {
+
+	normalized := ResourceConfig{}
+
+	body, err := json.Marshal(config)
+	if err == nil {
+		err = json.Unmarshal(body, &normalized)
+	}
+	if err != nil {
+		log.Error(err)
+		return config
+	}
+
+	return normalized
+
+}
+
+// Starts using the catalog read from (or saved to) the store, so that
+// changes made by other processes are picked up. Until the catalog is
+// seeded, the configured resources are used instead.
+func useCatalog(catalog ResourceConfig) {
+
+	if len(catalog.Resources) == 0 {
+		return
+	}
+
+	setResourceConfig(catalog)
+
+}
+
+func (c ResourceConfig) Add(resource Resource) (ResourceConfig, error) {
+
+	if _, ok := c.Find(resource.Name); ok {
+		return c, errors.New(
+			fmt.Sprintf("\"*%v*\" already exists", resource.Name))
+	}
+
+	resources := append([]Resource{}, c.Resources...)
+	c.Resources = append(resources, resource)
+
+	return c, c.Validate()
+
+}
+
+func (c ResourceConfig) Remove(name string) (ResourceConfig, error) {
+
+	if _, ok := c.Find(name); !ok {
+		return c, errors.New(fmt.Sprintf("\"*%v*\" doesn't exist", name))
+	}
+
+	resources := []Resource{}
+	for _, resource := range c.Resources {
+		if resource.Name != name {
+			resources = append(resources, resource)
+		}
+	}
+	c.Resources = resources
+
+	return c, c.Validate()
+
+}
+
+// Replaces the resource of the same name
+func (c ResourceConfig) Replace(resource Resource) (ResourceConfig, error) {
+
+	return c.update(resource.Name, func(r *Resource) {
+		*r = resource
+	})
+
+}
+
+func (c ResourceConfig) Rename(name string, new_name string) (ResourceConfig, error) {
+
+	if _, ok := c.Find(new_name); ok {
+		return c, errors.New(fmt.Sprintf("\"*%v*\" already exists", new_name))
+	}
+
+	return c.update(name, func(r *Resource) {
+		r.Name = new_name
+	})
+
+}
+
+func (c ResourceConfig) Retire(name string) (ResourceConfig, error) {
+
+	return c.update(name, func(r *Resource) {
+		r.Retired = true
+	})
+
+}
+
+// Applies `fn` to a copy of the named resource. The original is left alone,
+// since it may be in use by other requests.
+func (c ResourceConfig) update(name string, fn func(r *Resource)) (ResourceConfig, error) {
+
+	resources := append([]Resource{}, c.Resources...)
+
+	for i := range resources {
+		if resources[i].Name == name {
+			fn(&resources[i])
+			c.Resources = resources
+			return c, c.Validate()
+		}
+	}
+
+	return c, errors.New(fmt.Sprintf("\"*%v*\" doesn't exist", name))
+
+}
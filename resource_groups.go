@@ -0,0 +1,206 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"time"
+)
+
+// "any qa" in a command stands for whichever resource in the qa group is free
+var any_group_regex = regexp.MustCompile("\\Aany (.+)\\z")
+
+// Settings for a group of interchangeable resources, i.e. those with the same
+// `group`. Groups don't need settings to be used. A `LeastRecentlyUsed`
+// group hands out whichever of its free resources has gone unused the
+// longest, rather than the first one configured.
+type ResourceGroup struct {
+	Name              string `json:"name"`
+	LeastRecentlyUsed bool   `json:"least_recently_used,omitempty"`
+}
+
+// Resources listed under a group by `list`. Resources without a group are
+// listed under an empty `Group`.
+type resourceListing struct {
+	Group     string
+	Resources []Resource
+}
+
+func (c ResourceConfig) validateGroups() error {
+
+	seen := map[string]bool{}
+
+	for _, group := range c.Groups {
+		if group.Name == "" {
+			return errors.New("Every group needs a name")
+		}
+
+		if seen[group.Name] {
+			return errors.New(
+				fmt.Sprintf("Group %v is configured more than once", group.Name))
+		}
+		seen[group.Name] = true
+	}
+
+	return nil
+
+}
+
+// The group's settings, or the defaults if it has none
+func (c ResourceConfig) FindGroup(name string) ResourceGroup {
+
+	for _, group := range c.Groups {
+		if group.Name == name {
+			return group
+		}
+	}
+
+	return ResourceGroup{Name: name}
+
+}
+
+// The resources in the group that can still be reserved, in the order
+// they're configured
+func (c ResourceConfig) GroupMembers(name string) []Resource {
+
+	members := []Resource{}
+
+	for _, resource := range c.Resources {
+		if resource.Group == name && !resource.Retired {
+			members = append(members, resource)
+		}
+	}
+
+	return members
+
+}
+
+// The resources that can still be reserved, those without a group first and
+// then each group in the order its first resource is configured
+func (c ResourceConfig) Listing() []resourceListing {
+
+	listings := []resourceListing{{}}
+	index := map[string]int{"": 0}
+
+	for _, resource := range c.Resources {
+		if resource.Retired {
+			continue
+		}
+
+		i, ok := index[resource.Group]
+		if !ok {
+			i = len(listings)
+			index[resource.Group] = i
+			listings = append(listings, resourceListing{Group: resource.Group})
+		}
+		listings[i].Resources = append(listings[i].Resources, resource)
+	}
+
+	return listings
+
+}
+
+// The groups with resources that can still be reserved
+func (c ResourceConfig) GroupNames() []string {
+
+	names := []string{}
+	for _, listing := range c.Listing() {
+		if listing.Group != "" {
+			names = append(names, listing.Group)
+		}
+	}
+
+	return names
+
+}
+
+// Renders e.g. "qa (2 of 5 free)"
+func (l resourceListing) Heading(reservations Reservations) string {
+
+	free := 0
+	for _, resource := range l.Resources {
+		if !reservations.IsFull(resource.Name) {
+			free++
+		}
+	}
+
+	return fmt.Sprintf("%v (%v of %v free)", l.Group, free, len(l.Resources))
+
+}
+
+// Returns the group that `name` asks for any resource from, e.g. "qa" for
+// "any qa"
+func anyGroupName(name string) (string, bool) {
+
+	matches := any_group_regex.FindStringSubmatch(name)
+	if matches == nil {
+		return "", false
+	}
+
+	return matches[1], true
+
+}
+
+// The resources in the group that can be reserved from the channel the
+// request came from, in the order they should be tried. Returns why there
+// aren't any if there aren't.
+func reservableGroupMembers(group string, slack_request SlackRequest) ([]Resource, string) {
+
+	config := currentResourceConfig()
+
+	members := config.GroupMembers(group)
+	if len(members) == 0 {
+		return nil, fmt.Sprintf("I don't know of a group of resources called \"*%v*\"", group)
+	}
+
+	allowed := []Resource{}
+	for _, member := range members {
+		if member.IsAllowedInChannel(slack_request.ChannelId, slack_request.ChannelName) {
+			allowed = append(allowed, member)
+		}
+	}
+	if len(allowed) == 0 {
+		return nil, channelNotAllowedText(members[0])
+	}
+
+	if config.FindGroup(group).LeastRecentlyUsed {
+		sortLeastRecentlyUsed(allowed)
+	}
+
+	return allowed, ""
+
+}
+
+// Sorts resources by when anything last happened to them, according to the
+// history, oldest first
+func sortLeastRecentlyUsed(resources []Resource) {
+
+	last_used := map[string]time.Time{}
+
+	history, err := historyByResource(time.Time{})
+	if err != nil {
+		log.Error(err)
+	}
+
+	for _, resource := range resources {
+		for _, event := range history[resource.Name] {
+			if event.At.After(last_used[resource.Name]) {
+				last_used[resource.Name] = event.At
+			}
+		}
+	}
+
+	sort.SliceStable(resources, func(i, j int) bool {
+		return last_used[resources[i].Name].Before(last_used[resources[j].Name])
+	})
+
+}
+
+func groupTakenText(group string) string {
+
+	return fmt.Sprintf(
+		"Every resource in \"*%v*\" is taken. Type `/reservations list` to see who has them",
+		group)
+
+}
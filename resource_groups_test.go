@@ -0,0 +1,250 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResourceGroups(t *testing.T) {
+
+	config := ResourceConfig{
+		Resources: []Resource{
+			{Name: "qa1", Group: "qa"},
+			{Name: "staging"},
+			{Name: "dev1", Group: "dev"},
+			{Name: "qa2", Group: "qa"},
+			{Name: "qa3", Group: "qa", Retired: true},
+		},
+		Groups: []ResourceGroup{{Name: "qa", LeastRecentlyUsed: true}},
+	}
+
+	t.Run("GroupMembers", func(t *testing.T) {
+
+		members := config.GroupMembers("qa")
+		if len(members) != 2 || members[0].Name != "qa1" || members[1].Name != "qa2" {
+			t.Error("expected qa1 and qa2, got", members)
+		}
+
+		if members := config.GroupMembers("foo"); len(members) != 0 {
+			t.Error("expected no members, got", members)
+		}
+
+	})
+
+	t.Run("FindGroup", func(t *testing.T) {
+
+		if !config.FindGroup("qa").LeastRecentlyUsed {
+			t.Error("expected qa to be least recently used")
+		}
+
+		if group := config.FindGroup("dev"); group.Name != "dev" || group.LeastRecentlyUsed {
+			t.Error("expected the default settings, got", group)
+		}
+
+	})
+
+	t.Run("Listing", func(t *testing.T) {
+
+		listings := config.Listing()
+		if len(listings) != 3 {
+			t.Fatal("expected", 3, "got", len(listings))
+		}
+
+		expected := []string{"=staging", "qa=qa1,qa2", "dev=dev1"}
+		for i, listing := range listings {
+			names := []string{}
+			for _, resource := range listing.Resources {
+				names = append(names, resource.Name)
+			}
+
+			actual := listing.Group + "=" + strings.Join(names, ",")
+			if actual != expected[i] {
+				t.Error("expected", expected[i], "got", actual)
+			}
+		}
+
+		if names := config.GroupNames(); strings.Join(names, ",") != "qa,dev" {
+			t.Error("expected", "qa,dev", "got", names)
+		}
+
+	})
+
+	t.Run("Heading", func(t *testing.T) {
+
+		now := time.Now()
+		reservations := Reservations{
+			"qa1": Schedule{{User: "alice", StartAt: now, EndAt: now.Add(time.Hour)}},
+			"qa2": Schedule{{User: "bob", StartAt: now.Add(time.Hour), EndAt: now.Add(2 * time.Hour)}},
+		}
+
+		expected := "qa (1 of 2 free)"
+		if actual := config.Listing()[1].Heading(reservations); actual != expected {
+			t.Error("expected", expected, "got", actual)
+		}
+
+	})
+
+}
+
+func TestHandleCommandCreateAny(t *testing.T) {
+
+	//
+	// Setup
+	//
+
+	cleanup_resources, err := useResourcesFile(`{
+		"resources": [
+			{"name": "staging"},
+			{"name": "qa1", "group": "qa"},
+			{"name": "qa2", "group": "qa"},
+			{"name": "dev1", "group": "dev"},
+			{"name": "dev2", "group": "dev"},
+			{"name": "dev3", "group": "dev"}
+		],
+		"groups": [{"name": "dev", "least_recently_used": true}]
+	}`)
+	defer cleanup_resources()
+	if err != nil {
+		t.Fatal("expected no error, got", err)
+	}
+
+	defer useTempStore()()
+
+	expectHolder := func(resource string, expected string) {
+		reservation, _ := store.Get(resource)
+		if reservation.User != expected {
+			t.Error(resource, ": expected", expected, "got", reservation.User)
+		}
+	}
+
+	//
+	// Test
+	//
+
+	t.Run("FirstFree", func(t *testing.T) {
+
+		expectMatch(t,
+			runCommand(t, handleCommandCreate, "alice", "reserve any qa for 1 hour"),
+			"\\AYou've successfully reserved \"\\*qa1\\*\" for the next \\*1 hour, 0 minutes\\*")
+
+		expectMatch(t,
+			runCommand(t, handleCommandCreate, "bob", "reserve any QA for 1 hour"),
+			"\\AYou've successfully reserved \"\\*qa2\\*\"")
+
+		expectHolder("qa1", "alice")
+		expectHolder("qa2", "bob")
+
+	})
+
+	t.Run("AllTaken", func(t *testing.T) {
+
+		expectMatch(t,
+			runCommand(t, handleCommandCreate, "carol", "reserve any qa for 1 hour"),
+			"\\AEvery resource in \"\\*qa\\*\" is taken")
+
+		// Booking ahead still finds the first one free then
+		expectMatch(t,
+			runCommand(t, handleCommandCreate, "carol", "reserve any qa tomorrow 2pm for 1 hour"),
+			"\\AYou've successfully booked \"\\*qa1\\*\"")
+
+	})
+
+	t.Run("WithOthers", func(t *testing.T) {
+
+		actual := runCommand(t, handleCommandCreate, "dave", "reserve staging, any qa for 1 hour")
+		expectMatch(t, actual, "\\ASorry, I couldn't reserve all of them")
+		expectMatch(t, actual, "• Every resource in \"\\*qa\\*\" is taken")
+
+		expectHolder("staging", "")
+
+	})
+
+	t.Run("LeastRecentlyUsed", func(t *testing.T) {
+
+		now := time.Now()
+		store.Update(func(tx *StoreTx) error {
+			tx.Record(HistoryEvent{At: now.Add(-time.Hour), Action: HISTORY_EXPIRE, Resource: "dev1"})
+			tx.Record(HistoryEvent{At: now.Add(-48 * time.Hour), Action: HISTORY_EXPIRE, Resource: "dev3"})
+			return nil
+		})
+
+		expectMatch(t,
+			runCommand(t, handleCommandCreate, "alice", "reserve any dev for 1 hour"),
+			"\"\\*dev2\\*\"")
+
+		expectMatch(t,
+			runCommand(t, handleCommandCreate, "bob", "reserve any dev for 1 hour"),
+			"\"\\*dev3\\*\"")
+
+	})
+
+	t.Run("UnknownGroup", func(t *testing.T) {
+
+		expectMatch(t,
+			runCommand(t, handleCommandCreate, "alice", "reserve any foo for 1 hour"),
+			"I don't know of a group of resources called \"\\*foo\\*\"")
+
+		expectMatch(t,
+			runCommand(t, handleCommandCreate, "alice", "reserve any foo tomorrow 2pm for 1 hour"),
+			"I don't know of a group of resources called \"\\*foo\\*\"")
+
+	})
+
+	t.Run("List", func(t *testing.T) {
+
+		actual := runCommand(t, handleCommandShow, "alice", "list")
+		expectMatch(t, actual, "→  staging \\(free\\)\n\n_qa \\(0 of 2 free\\)_\n→  qa1 ")
+		expectMatch(t, actual, "_dev \\(1 of 3 free\\)_\n→  dev1 \\(free\\)\n")
+
+		expectMatch(t,
+			runCommand(t, handleCommandHelp, "alice", "help"),
+			"or whichever is free in a group, like `reserve any qa`: \\[qa, dev\\]")
+
+	})
+
+}
+
+func TestHandleCommandCreateAnyDurationLimits(t *testing.T) {
+
+	//
+	// Setup
+	//
+
+	cleanup_resources, err := useResourcesFile(`{
+		"resources": [
+			{"name": "perf1", "group": "perf", "max_duration": "1h"},
+			{"name": "perf2", "group": "perf", "max_duration": "4h", "default_duration": "2h"}
+		]
+	}`)
+	defer cleanup_resources()
+	if err != nil {
+		t.Fatal("expected no error, got", err)
+	}
+
+	defer useTempStore()()
+
+	//
+	// Test
+	//
+
+	// perf1 has no default duration
+	expectMatch(t,
+		runCommand(t, handleCommandCreate, "alice", "reserve any perf"),
+		"\\AYou've successfully reserved \"\\*perf2\\*\" for the next \\*2 hours, 0 minutes\\*")
+
+	// perf1 can't be reserved for that long, so isn't picked
+	expectMatch(t,
+		runCommand(t, handleCommandCreate, "bob", "reserve any perf tomorrow 2pm for 3 hours"),
+		"\\AYou've successfully booked \"\\*perf2\\*\"")
+
+	// Neither of them can
+	expectMatch(t,
+		runCommand(t, handleCommandCreate, "carol", "reserve any perf for 5 hours"),
+		"\\A\"\\*perf1\\*\" can only be reserved for up to \\*1 hour\\*")
+
+	if reservation, _ := store.Get("perf1"); reservation.IsPresent() {
+		t.Error("expected", Reservation{}, "got", reservation)
+	}
+
+}
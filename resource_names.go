@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Prefixes shorter than this are never expanded to a resource name, since
+// they'd be too easy to mistype
+const min_resource_prefix_length = 3
+
+// Most resources suggested for a misspelled name
+const max_resource_suggestions = 3
+
+// Works out which resource `name` means: the one with that name or alias, or
+// else the only resource that can still be reserved whose name starts with
+// it. Returns false if there isn't exactly one.
+//
+// A name that's only missing its last letter looks more like a typo than an
+// abbreviation, so it isn't expanded. `Suggest()` offers it instead.
+func (c ResourceConfig) Resolve(name string) (Resource, bool) {
+
+	for _, resource := range c.Resources {
+		if resource.Name == name {
+			return resource, true
+		}
+		for _, alias := range resource.Aliases {
+			if alias == name {
+				return resource, true
+			}
+		}
+	}
+
+	matches := c.withPrefix(name)
+	if len(matches) == 1 && len(matches[0].Name)-len(name) > 1 {
+		return matches[0], true
+	}
+
+	return Resource{}, false
+
+}
+
+// The resources that can still be reserved whose names start with `prefix`
+func (c ResourceConfig) withPrefix(prefix string) []Resource {
+
+	matches := []Resource{}
+	if len(prefix) < min_resource_prefix_length {
+		return matches
+	}
+
+	for _, resource := range c.Resources {
+		if !resource.Retired && strings.HasPrefix(resource.Name, prefix) {
+			matches = append(matches, resource)
+		}
+	}
+
+	return matches
+
+}
+
+// Guesses which resources a misspelled `name` might have meant: those it's a
+// prefix of, or else those whose name or alias it's only a typo or two away
+// from. Closest first.
+func (c ResourceConfig) Suggest(name string) []string {
+
+	suggestions := []string{}
+
+	for _, resource := range c.withPrefix(name) {
+		suggestions = append(suggestions, resource.Name)
+	}
+	if len(suggestions) > 0 {
+		if len(suggestions) > max_resource_suggestions {
+			suggestions = suggestions[:max_resource_suggestions]
+		}
+		return suggestions
+	}
+
+	// Allow about one typo for every three letters
+	max_distance := len(name) / 3
+	if max_distance < 1 {
+		max_distance = 1
+	}
+
+	distances := map[string]int{}
+	for _, resource := range c.Resources {
+		if resource.Retired {
+			continue
+		}
+
+		for _, candidate := range append([]string{resource.Name}, resource.Aliases...) {
+			distance := editDistance(name, candidate)
+			if distance > max_distance {
+				continue
+			}
+
+			previous, seen := distances[resource.Name]
+			if !seen {
+				suggestions = append(suggestions, resource.Name)
+			}
+			if !seen || distance < previous {
+				distances[resource.Name] = distance
+			}
+		}
+	}
+
+	sort.SliceStable(suggestions, func(i, j int) bool {
+		return distances[suggestions[i]] < distances[suggestions[j]]
+	})
+	if len(suggestions) > max_resource_suggestions {
+		suggestions = suggestions[:max_resource_suggestions]
+	}
+
+	return suggestions
+
+}
+
+// Returns the name of the resource `name` means (see `Resolve()`), or `name`
+// itself if it doesn't clearly mean any
+func resolveResourceName(name string) string {
+
+	resource, ok := currentResourceConfig().Resolve(name)
+	if !ok {
+		return name
+	}
+
+	return resource.Name
+
+}
+
+// The number of single letter insertions, deletions and substitutions it
+// takes to turn `a` into `b` (their Levenshtein distance)
+func editDistance(a string, b string) int {
+
+	x := []rune(a)
+	y := []rune(b)
+
+	previous := make([]int, len(y)+1)
+	current := make([]int, len(y)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(x); i++ {
+		current[0] = i
+		for j := 1; j <= len(y); j++ {
+			cost := 1
+			if x[i-1] == y[j-1] {
+				cost = 0
+			}
+			current[j] = minInt(
+				previous[j]+1,
+				current[j-1]+1,
+				previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+
+	return previous[len(y)]
+
+}
+
+func minInt(values ...int) int {
+
+	min := values[0]
+	for _, value := range values[1:] {
+		if value < min {
+			min = value
+		}
+	}
+
+	return min
+
+}
+
+// Lists resources as e.g. "*staging*, *qa* or *production*"
+func resourceChoicesToString(names []string) string {
+
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = fmt.Sprintf("*%v*", name)
+	}
+
+	if len(quoted) == 1 {
+		return quoted[0]
+	}
+
+	return strings.Join(quoted[:len(quoted)-1], ", ") + " or " + quoted[len(quoted)-1]
+
+}
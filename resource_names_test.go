@@ -0,0 +1,138 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestResolveResource(t *testing.T) {
+
+	config := ResourceConfig{Resources: []Resource{
+		{Name: "production", Aliases: []string{"prd"}},
+		{Name: "staging", Aliases: []string{"stg"}},
+		{Name: "staging-eu"},
+		{Name: "qa"},
+		{Name: "legacy", Retired: true},
+	}}
+
+	test_cases := map[string]string{
+		"production": "production",
+		"prd":        "production",
+		"prod":       "production",
+		"stg":        "staging",
+		"staging":    "staging",
+		"staging-":   "staging-eu",
+		"productio":  "",
+		"qa":         "qa",
+		"legacy":     "legacy",
+		"sta":        "",
+		"pr":         "",
+		"leg":        "",
+		"foo":        "",
+	}
+
+	for name, expected := range test_cases {
+		resource, ok := config.Resolve(name)
+		if ok != (expected != "") || resource.Name != expected {
+			t.Error(name, ": expected", expected, "got", resource.Name)
+		}
+	}
+
+}
+
+func TestSuggestResources(t *testing.T) {
+
+	config := ResourceConfig{Resources: []Resource{
+		{Name: "production"},
+		{Name: "staging", Aliases: []string{"stg"}},
+		{Name: "staging-eu"},
+		{Name: "qa"},
+		{Name: "stage", Retired: true},
+	}}
+
+	test_cases := map[string][]string{
+		"stagin":     {"staging", "staging-eu"},
+		"sta":        {"staging", "staging-eu"},
+		"prodcution": {"production"},
+		"stgx":       {"staging"},
+		"q":          {"qa"},
+		"foo":        {},
+	}
+
+	for name, expected := range test_cases {
+		actual := config.Suggest(name)
+		if len(actual) != len(expected) {
+			t.Error(name, ": expected", expected, "got", actual)
+			continue
+		}
+		for i := range expected {
+			if actual[i] != expected[i] {
+				t.Error(name, ": expected", expected, "got", actual)
+				break
+			}
+		}
+	}
+
+}
+
+func TestEditDistance(t *testing.T) {
+
+	test_cases := map[[2]string]int{
+		{"staging", "staging"}: 0,
+		{"stagin", "staging"}:  1,
+		{"stagign", "staging"}: 2,
+		{"", "qa"}:             2,
+		{"kitten", "sitting"}:  3,
+	}
+
+	for words, expected := range test_cases {
+		if actual := editDistance(words[0], words[1]); actual != expected {
+			t.Error(words, ": expected", expected, "got", actual)
+		}
+	}
+
+}
+
+func TestHandleCommandCreateWithResourceNames(t *testing.T) {
+
+	//
+	// Setup
+	//
+
+	cleanup_resources, err := useResourcesFile(`{
+		"resources": [
+			{"name": "production"},
+			{"name": "staging", "aliases": ["stg"]}
+		]
+	}`)
+	defer cleanup_resources()
+	if err != nil {
+		t.Fatal("expected no error, got", err)
+	}
+
+	defer useTempStore()()
+
+	//
+	// Test
+	//
+
+	expectMatch(t,
+		runCommand(t, handleCommandCreate, "alice", "reserve stg for 1 hour"),
+		"successfully reserved \"\\*staging\\*\"")
+
+	expectMatch(t,
+		runCommand(t, handleCommandCreate, "alice", "reserve prod tomorrow 2pm for 1 hour"),
+		"successfully booked \"\\*production\\*\"")
+
+	expectMatch(t,
+		runCommand(t, handleCommandUpdate, "alice", "extend STG by 1 hour"),
+		"extended your reservation on \"\\*staging\\*\"")
+
+	expectMatch(t,
+		runCommand(t, handleCommandCreate, "bob", "reserve stagin for 1 hour"),
+		"I don't know what \"\\*stagin\\*\" is. Did you mean \\*staging\\*\\?")
+
+	expectMatch(t,
+		runCommand(t, handleCommandDestroy, "alice", "cancel foo"),
+		"Did you misspell it\\?\nValid resources: \\[production, staging\\]")
+
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"reflect"
+	"syscall"
+	"time"
+)
+
+// How often RESOURCES_FILE is checked for changes
+var resources_file_poll_interval = 5 * time.Second
+
+// Reloads the resource configuration whenever the process receives SIGHUP
+// or RESOURCES_FILE changes, without interrupting requests in flight
+func WatchResources() {
+
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+
+	var changes <-chan time.Time
+	if resourcesFile() != "" {
+		ticker := time.NewTicker(resources_file_poll_interval)
+		changes = ticker.C
+	}
+
+	go func() {
+		last_modified := resourcesFileModTime()
+
+		for {
+			select {
+
+			case <-hangups:
+				log.Info("Received SIGHUP, reloading resources")
+				last_modified = resourcesFileModTime()
+				reloadResources()
+
+			case <-changes:
+				modified := resourcesFileModTime()
+				if modified.Equal(last_modified) {
+					continue
+				}
+
+				log.Infof("%v has changed, reloading resources", resourcesFile())
+				last_modified = modified
+				reloadResources()
+
+			}
+		}
+	}()
+
+}
+
+// Applies changes to RESOURCES_FILE (or RESOURCES) to the catalog, and swaps
+// in the result. If the file is invalid, the current catalog is kept.
+// Reservations on resources that have been removed are left to run out as
+// orphans, and are shown with a warning by `list`.
+func reloadResources() bool {
+
+	old_resources := ListOfResources()
+
+	config, err := loadResourceConfig()
+	if err == nil {
+		err = config.Validate()
+	}
+	if err != nil {
+		log.Errorf("Could not reload resources, keeping the current ones: %v", err)
+		return false
+	}
+
+	var catalog ResourceConfig
+	err = store.Update(func(tx *StoreTx) error {
+		tx.seedCatalog()
+
+		_, err := tx.syncCatalogSource(config)
+		catalog = tx.Catalog
+
+		return err
+	})
+	if err != nil {
+		log.Errorf("Could not reload resources, keeping the current ones: %v", err)
+		return false
+	}
+
+	resource_file_config = config
+	setResourceConfig(catalog)
+
+	added, removed := diffResources(old_resources, ListOfResources())
+	log.Infof(
+		"Reloaded resources: %v (added %v, removed %v)",
+		ListOfResourcesToString(),
+		added,
+		removed)
+
+	return true
+
+}
+
+// Applies the differences between two versions of the resources file to the
+// catalog, so that changes made by admins to other resources are kept
+func syncCatalog(
+	catalog ResourceConfig, old ResourceConfig, new ResourceConfig) (ResourceConfig, error) {
+
+	var err error
+
+	for _, resource := range new.Resources {
+		previous, was_configured := old.Find(resource.Name)
+		if was_configured && reflect.DeepEqual(previous, resource) {
+			continue
+		}
+
+		current, ok := catalog.Find(resource.Name)
+		if !ok {
+			catalog, err = catalog.Add(resource)
+		} else {
+			// Changes to the file don't bring retired resources back
+			resource.Retired = current.Retired
+			catalog, err = catalog.Replace(resource)
+		}
+		if err != nil {
+			return catalog, err
+		}
+	}
+
+	if !reflect.DeepEqual(old.Groups, new.Groups) {
+		catalog.Groups = new.Groups
+	}
+
+	for _, resource := range old.Resources {
+		if _, ok := new.Find(resource.Name); ok {
+			continue
+		}
+
+		if _, ok := catalog.Find(resource.Name); ok {
+			catalog, err = catalog.Remove(resource.Name)
+			if err != nil {
+				return catalog, err
+			}
+		}
+	}
+
+	return catalog, nil
+
+}
+
+// Returns the names in `new` but not `old`, and in `old` but not `new`
+func diffResources(old []string, new []string) ([]string, []string) {
+
+	in := func(name string, names []string) bool {
+		for _, n := range names {
+			if n == name {
+				return true
+			}
+		}
+		return false
+	}
+
+	added := []string{}
+	for _, name := range new {
+		if !in(name, old) {
+			added = append(added, name)
+		}
+	}
+
+	removed := []string{}
+	for _, name := range old {
+		if !in(name, new) {
+			removed = append(removed, name)
+		}
+	}
+
+	return added, removed
+
+}
+
+// The modification time of RESOURCES_FILE, or the zero time if it can't be
+// read (in which case a reload will log why)
+func resourcesFileModTime() time.Time {
+
+	info, err := os.Stat(resourcesFile())
+	if err != nil {
+		return time.Time{}
+	}
+
+	return info.ModTime()
+
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReloadResources(t *testing.T) {
+
+	//
+	// Setup
+	//
+
+	cleanup_resources, err := useResourcesFile(
+		`{"resources": [{"name": "production"}, {"name": "staging"}]}`)
+	defer cleanup_resources()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer useTempStore()()
+
+	store.Upsert("staging", Reservation{
+		User: "alice", UserId: "UALICE", StartAt: time.Now(), EndAt: time.Now().Add(time.Hour)})
+
+	rewrite := func(body string) {
+		if err := ioutil.WriteFile(resourcesFile(), []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	//
+	// Test
+	//
+
+	t.Run("AddAndRemove", func(t *testing.T) {
+
+		rewrite(`{"resources": [{"name": "production"}, {"name": "qa"}]}`)
+
+		if !reloadResources() {
+			t.Fatal("expected reload to succeed")
+		}
+
+		if actual := ListOfResourcesToString(); actual != "[production, qa]" {
+			t.Error("expected", "[production, qa]", "got", actual)
+		}
+
+		// Reservations on removed resources are kept, and listed with a warning
+		reservations, _ := store.List()
+		if orphaned := reservations.Orphaned(); len(orphaned) != 1 || orphaned[0] != "staging" {
+			t.Error("expected", []string{"staging"}, "got", orphaned)
+		}
+
+		response, _ := handleRequest(handleCommandShow, newTestSlackRequest("bob", "list"))
+		expected := "⚠  staging (no longer available, reserved by <@UALICE>"
+		if !strings.Contains(response.Text, expected) {
+			t.Errorf("expected %q to contain %q", response.Text, expected)
+		}
+
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+
+		rewrite(`{"resources": []}`)
+
+		if reloadResources() {
+			t.Fatal("expected reload to fail")
+		}
+
+		if actual := ListOfResourcesToString(); actual != "[production, qa]" {
+			t.Error("expected", "[production, qa]", "got", actual)
+		}
+
+	})
+
+	t.Run("Restored", func(t *testing.T) {
+
+		rewrite(`{"resources": [{"name": "production"}, {"name": "staging"}]}`)
+		reloadResources()
+
+		reservations, _ := store.List()
+		if orphaned := reservations.Orphaned(); len(orphaned) != 0 {
+			t.Error("expected no orphans, got", orphaned)
+		}
+
+	})
+
+}
+
+func TestDiffResources(t *testing.T) {
+
+	added, removed := diffResources(
+		[]string{"production", "staging"},
+		[]string{"production", "qa"})
+
+	if len(added) != 1 || added[0] != "qa" {
+		t.Error("expected", []string{"qa"}, "got", added)
+	}
+	if len(removed) != 1 || removed[0] != "staging" {
+		t.Error("expected", []string{"staging"}, "got", removed)
+	}
+
+}
+
+func TestResourcesFileModTime(t *testing.T) {
+
+	old_env := os.Getenv("RESOURCES_FILE")
+	defer os.Setenv("RESOURCES_FILE", old_env)
+	os.Setenv("RESOURCES_FILE", "/does/not/exist")
+
+	if actual := resourcesFileModTime(); !actual.IsZero() {
+		t.Error("expected", time.Time{}, "got", actual)
+	}
+
+}
@@ -1,15 +1,353 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
 	"os"
 	"strings"
+	"sync"
+	"time"
 )
 
+// The resources that can be reserved. Loaded at startup from the catalog in
+// the store (see `configureResourceCatalog()`), and swapped out whenever the
+// catalog changes. Use `currentResourceConfig()` to read it.
+var resource_config ResourceConfig
+var resource_config_mutex sync.RWMutex
+
+// The resources as last read from RESOURCES_FILE or RESOURCES, which seed the
+// catalog. Kept to work out what's changed when they're reloaded.
+var resource_file_config ResourceConfig
+
+// Format of the file named by RESOURCES_FILE, e.g.
+//
+//	{
+//	  "resources": [
+//	    {
+//	      "name": "staging",
+//	      "aliases": ["stg"],
+//	      "description": "Pre-production environment",
+//	      "owner_team": "platform",
+//	      "url": "https://staging.example.com",
+//	      "max_duration": "8h",
+//	      "default_duration": "2h",
+//	      "allowed_channels": ["deploys", "C0123ABCD"]
+//	    },
+//	    {"name": "load-test", "capacity": 3},
+//	    {"name": "qa1", "group": "qa"},
+//	    {"name": "qa2", "group": "qa"}
+//	  ],
+//	  "groups": [
+//	    {"name": "qa", "least_recently_used": true}
+//	  ]
+//	}
+type ResourceConfig struct {
+	Resources []Resource      `json:"resources"`
+	Groups    []ResourceGroup `json:"groups,omitempty"`
+}
+
+// A resource and its policies. Zero values mean no limit (`MaxDuration`),
+// no default (`DefaultDuration`), and any channel (`AllowedChannels`).
+// `Retired` resources can't be reserved any more, but existing reservations
+// on them are left to run out. `Aliases` are other names people can use for
+// it in commands. Resources in the same `Group` are interchangeable, so that
+// people can ask for any of them. A resource with a `Capacity` of more than 1
+// can be reserved by that many people at once.
+type Resource struct {
+	Name            string         `json:"name"`
+	Aliases         []string       `json:"aliases,omitempty"`
+	Group           string         `json:"group,omitempty"`
+	Capacity        int            `json:"capacity,omitempty"`
+	Description     string         `json:"description,omitempty"`
+	OwnerTeam       string         `json:"owner_team,omitempty"`
+	Url             string         `json:"url,omitempty"`
+	MaxDuration     ConfigDuration `json:"max_duration,omitempty"`
+	DefaultDuration ConfigDuration `json:"default_duration,omitempty"`
+	AllowedChannels []string       `json:"allowed_channels,omitempty"`
+	Retired         bool           `json:"retired,omitempty"`
+}
+
+// A duration written in the config file as e.g. "90m" or "8h"
+type ConfigDuration time.Duration
+
+func (d *ConfigDuration) UnmarshalJSON(body []byte) error {
+
+	var text string
+	err := json.Unmarshal(body, &text)
+	if err != nil {
+		return err
+	}
+
+	duration, err := time.ParseDuration(text)
+	if err != nil {
+		return err
+	}
+
+	*d = ConfigDuration(duration)
+	return nil
+
+}
+
+func (d ConfigDuration) MarshalJSON() ([]byte, error) {
+
+	return json.Marshal(time.Duration(d).String())
+
+}
+
+// Loads the resources from RESOURCES_FILE, or the RESOURCES shorthand if
+// there's no file, and makes them available to the rest of the app until the
+// catalog is loaded from the store
+func configureResources() error {
+
+	config, err := loadResourceConfig()
+	if err != nil {
+		return err
+	}
+
+	err = config.Validate()
+	if err != nil {
+		return err
+	}
+
+	resource_file_config = config
+	setResourceConfig(config)
+	return nil
+
+}
+
+func setResourceConfig(config ResourceConfig) {
+
+	resource_config_mutex.Lock()
+	defer resource_config_mutex.Unlock()
+
+	resource_config = config
+
+}
+
+func currentResourceConfig() ResourceConfig {
+
+	resource_config_mutex.RLock()
+	defer resource_config_mutex.RUnlock()
+
+	return resource_config
+
+}
+
+func loadResourceConfig() (ResourceConfig, error) {
+
+	var config ResourceConfig
+
+	path := resourcesFile()
+	if path == "" {
+		return resourceConfigFromList(os.Getenv("RESOURCES")), nil
+	}
+
+	body, err := ioutil.ReadFile(path)
+	if err != nil {
+		return config, err
+	}
+
+	err = json.Unmarshal(body, &config)
+	if err != nil {
+		return config, errors.New(
+			fmt.Sprintf("Could not parse %v: %v", path, err))
+	}
+
+	for i := range config.Resources {
+		config.Resources[i].Name = normalizeResourceName(config.Resources[i].Name)
+		for j := range config.Resources[i].Aliases {
+			config.Resources[i].Aliases[j] = normalizeResourceName(config.Resources[i].Aliases[j])
+		}
+		config.Resources[i].Group = normalizeResourceName(config.Resources[i].Group)
+	}
+
+	for i := range config.Groups {
+		config.Groups[i].Name = normalizeResourceName(config.Groups[i].Name)
+	}
+
+	return config, nil
+
+}
+
+// Builds a config from a comma separated list of names, with no policies
+func resourceConfigFromList(list string) ResourceConfig {
+
+	config := ResourceConfig{}
+
+	for _, name := range strings.Split(list, ",") {
+		name = normalizeResourceName(name)
+		if name != "" {
+			config.Resources = append(config.Resources, Resource{Name: name})
+		}
+	}
+
+	return config
+
+}
+
+func (c ResourceConfig) Validate() error {
+
+	if len(c.Resources) == 0 {
+		return errors.New("No resources configured")
+	}
+
+	seen := map[string]bool{}
+
+	for _, resource := range c.Resources {
+		if resource.Name == "" {
+			return errors.New("Every resource needs a name")
+		}
+
+		if seen[resource.Name] {
+			return errors.New(
+				fmt.Sprintf("Resource %v is configured more than once", resource.Name))
+		}
+		seen[resource.Name] = true
+
+		if resource.MaxDuration < 0 || resource.DefaultDuration < 0 {
+			return errors.New(
+				fmt.Sprintf("Resource %v has a negative duration", resource.Name))
+		}
+
+		if resource.Capacity < 0 {
+			return errors.New(
+				fmt.Sprintf("Resource %v has a negative capacity", resource.Name))
+		}
+
+		if resource.MaxDuration > 0 && resource.DefaultDuration > resource.MaxDuration {
+			return errors.New(fmt.Sprintf(
+				"Resource %v has a default_duration longer than its max_duration",
+				resource.Name))
+		}
+	}
+
+	// An alias can only stand for one resource
+	for _, resource := range c.Resources {
+		for _, alias := range resource.Aliases {
+			if alias == "" {
+				return errors.New(
+					fmt.Sprintf("Resource %v has an empty alias", resource.Name))
+			}
+
+			if seen[alias] {
+				return errors.New(fmt.Sprintf(
+					"Alias %v of resource %v is already the name or alias of another resource",
+					alias,
+					resource.Name))
+			}
+			seen[alias] = true
+		}
+	}
+
+	return c.validateGroups()
+
+}
+
+func (c ResourceConfig) Find(name string) (Resource, bool) {
+
+	for _, resource := range c.Resources {
+		if resource.Name == name {
+			return resource, true
+		}
+	}
+
+	return Resource{}, false
+
+}
+
+// How many people can hold the resource at once
+func (r Resource) Slots() int {
+
+	if r.Capacity < 1 {
+		return 1
+	}
+
+	return r.Capacity
+
+}
+
+// Returns an error explaining why a reservation `duration` long isn't
+// allowed, if it isn't
+func (r Resource) CheckDuration(duration time.Duration) error {
+
+	if r.MaxDuration > 0 && duration > time.Duration(r.MaxDuration) {
+		return errors.New(fmt.Sprintf(
+			"\"*%v*\" can only be reserved for up to *%v* at a time",
+			r.Name,
+			formatConfigDuration(time.Duration(r.MaxDuration))))
+	}
+
+	return nil
+
+}
+
+// Whether the resource can be reserved from a channel, given its ID or name
+func (r Resource) IsAllowedInChannel(channel_id string, channel_name string) bool {
+
+	if len(r.AllowedChannels) == 0 {
+		return true
+	}
+
+	for _, allowed := range r.AllowedChannels {
+		allowed = strings.TrimPrefix(allowed, "#")
+		if allowed == channel_id || strings.EqualFold(allowed, channel_name) {
+			return true
+		}
+	}
+
+	return false
+
+}
+
+func (r Resource) AllowedChannelsToString() string {
+
+	channels := make([]string, len(r.AllowedChannels))
+	for i, channel := range r.AllowedChannels {
+		channels[i] = "#" + strings.TrimPrefix(channel, "#")
+	}
+
+	return strings.Join(channels, ", ")
+
+}
+
+// Renders e.g. "8 hours", "45 minutes" or "1 hour, 30 minutes"
+func formatConfigDuration(duration time.Duration) string {
+
+	hours := int(duration / time.Hour)
+	minutes := int((duration % time.Hour) / time.Minute)
+
+	var r Reservation
+	switch {
+	case hours == 0:
+		return r.formatDuration(float64(minutes), "minute")
+	case minutes == 0:
+		return r.formatDuration(float64(hours), "hour")
+	}
+
+	return fmt.Sprintf(
+		"%v, %v",
+		r.formatDuration(float64(hours), "hour"),
+		r.formatDuration(float64(minutes), "minute"))
+
+}
+
+func FindResource(name string) (Resource, bool) {
+
+	return currentResourceConfig().Find(name)
+
+}
+
+// Returns the resources that can be reserved, leaving out retired ones
 func ListOfResources() []string {
 
-	resources := strings.Split(os.Getenv("RESOURCES"), ",")
-	for i, r := range resources {
-		resources[i] = strings.ToLower(strings.Trim(r, " "))
+	resources := []string{}
+
+	for _, r := range currentResourceConfig().Resources {
+		if !r.Retired {
+			resources = append(resources, r.Name)
+		}
 	}
 
 	return resources
@@ -21,18 +359,23 @@ func ListOfResourcesToString() string {
 	return "[" + strings.Join(ListOfResources(), ", ") + "]"
 }
 
+// Whether the resource is in the catalog. Retired resources are still valid,
+// so that reservations on them can be cancelled.
 func IsValidResource(resource string) bool {
 
-	resources := ListOfResources()
-	present := false
+	_, present := FindResource(resource)
+	return present
 
-	for _, r := range resources {
-		if resource == r {
-			present = true
-			break
-		}
-	}
+}
 
-	return present
+func normalizeResourceName(name string) string {
+
+	return strings.ToLower(strings.Trim(name, " "))
+
+}
+
+func resourcesFile() string {
+
+	return os.Getenv("RESOURCES_FILE")
 
 }
@@ -2,16 +2,70 @@ package main
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
+// Configures resources from the RESOURCES shorthand until the returned
+// function is called
+func useResources(list string) func() {
+
+	old_env := os.Getenv("RESOURCES")
+	old_file_env := os.Getenv("RESOURCES_FILE")
+	old_config := currentResourceConfig()
+	old_file_config := resource_file_config
+
+	os.Setenv("RESOURCES", list)
+	os.Setenv("RESOURCES_FILE", "")
+	if err := configureResources(); err != nil {
+		panic(err)
+	}
+
+	return func() {
+		os.Setenv("RESOURCES", old_env)
+		os.Setenv("RESOURCES_FILE", old_file_env)
+		setResourceConfig(old_config)
+		resource_file_config = old_file_config
+	}
+
+}
+
+// Configures resources from a config file with the given contents until the
+// returned function is called
+func useResourcesFile(body string) (func(), error) {
+
+	dir, err := ioutil.TempDir("", "resources")
+	if err != nil {
+		panic(err)
+	}
+
+	path := filepath.Join(dir, "resources.json")
+	ioutil.WriteFile(path, []byte(body), 0644)
+
+	old_file_env := os.Getenv("RESOURCES_FILE")
+	old_config := currentResourceConfig()
+	old_file_config := resource_file_config
+
+	os.Setenv("RESOURCES_FILE", path)
+	err = configureResources()
+
+	return func() {
+		os.Setenv("RESOURCES_FILE", old_file_env)
+		setResourceConfig(old_config)
+		resource_file_config = old_file_config
+		os.RemoveAll(dir)
+	}, err
+
+}
+
 func TestListOfResources(t *testing.T) {
 
 	// Setup
-	old_env := os.Getenv("RESOURCES")
-	defer os.Setenv("RESOURCES", old_env)
-	os.Setenv("RESOURCES", "PRODUCTION,  sTaging")
+	defer useResources("PRODUCTION,  sTaging")()
 
 	expected := []string{"production", "staging"}
 	actual := ListOfResources()
@@ -32,9 +86,7 @@ func TestListOfResources(t *testing.T) {
 func TestListOfResourcesToString(t *testing.T) {
 
 	// Setup
-	old_env := os.Getenv("RESOURCES")
-	defer os.Setenv("RESOURCES", old_env)
-	os.Setenv("RESOURCES", "production,  staging")
+	defer useResources("production,  staging")()
 
 	expected := "[production, staging]"
 	actual := ListOfResourcesToString()
@@ -51,9 +103,7 @@ func TestListOfResourcesToString(t *testing.T) {
 func TestIsValidResource(t *testing.T) {
 
 	// Setup
-	old_env := os.Getenv("RESOURCES")
-	defer os.Setenv("RESOURCES", old_env)
-	os.Setenv("RESOURCES", "production, staging")
+	defer useResources("production, staging")()
 
 	test_cases := map[string]bool{
 		"production": true,
@@ -72,3 +122,112 @@ func TestIsValidResource(t *testing.T) {
 	}
 
 }
+
+func TestResourcesFile(t *testing.T) {
+
+	t.Run("Success", func(t *testing.T) {
+
+		cleanup, err := useResourcesFile(`{
+			"resources": [
+				{
+					"name": "Staging",
+					"aliases": ["STG"],
+					"description": "Pre-production environment",
+					"owner_team": "platform",
+					"url": "https://staging.example.com",
+					"max_duration": "8h",
+					"default_duration": "2h",
+					"allowed_channels": ["#deploys"]
+				},
+				{"name": "qa"}
+			]
+		}`)
+		defer cleanup()
+
+		if err != nil {
+			t.Fatal("expected no error, got", err)
+		}
+
+		if actual := ListOfResourcesToString(); actual != "[staging, qa]" {
+			t.Error("expected", "[staging, qa]", "got", actual)
+		}
+
+		staging, _ := FindResource("staging")
+		if time.Duration(staging.MaxDuration) != 8*time.Hour {
+			t.Error("expected", 8*time.Hour, "got", time.Duration(staging.MaxDuration))
+		}
+		if time.Duration(staging.DefaultDuration) != 2*time.Hour {
+			t.Error("expected", 2*time.Hour, "got", time.Duration(staging.DefaultDuration))
+		}
+		if staging.Url != "https://staging.example.com" {
+			t.Error("expected", "https://staging.example.com", "got", staging.Url)
+		}
+		if len(staging.Aliases) != 1 || staging.Aliases[0] != "stg" {
+			t.Error("expected", []string{"stg"}, "got", staging.Aliases)
+		}
+
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+
+		test_cases := map[string]string{
+			`{"resources": []}`:                                                              "No resources configured",
+			`{"resources": [{"name": ""}]}`:                                                  "Every resource needs a name",
+			`{"resources": [{"name": "a"}, {"name": "A"}]}`:                                  "configured more than once",
+			`{"resources": [{"name": "a", "max_duration": "soon"}]}`:                         "Could not parse",
+			`{"resources": [{"name": "a", "max_duration": "1h", "default_duration": "2h"}]}`: "longer than its max_duration",
+			`{"resources": [{"name": "a", "aliases": ["b"]}, {"name": "b"}]}`:                "already the name or alias of another resource",
+			`{"resources": [{"name": "a", "aliases": [" "]}]}`:                               "has an empty alias",
+			`{"resources": [{"name": "a", "capacity": -1}]}`:                                 "has a negative capacity",
+			`{"resources": [{"name": "a"}], "groups": [{"name": " "}]}`:                      "Every group needs a name",
+			`{"resources": [{"name": "a"}], "groups": [{"name": "qa"}, {"name": "QA"}]}`:     "Group qa is configured more than once",
+		}
+
+		for body, expected := range test_cases {
+			cleanup, err := useResourcesFile(body)
+			cleanup()
+
+			if err == nil || !strings.Contains(err.Error(), expected) {
+				t.Errorf("%v: expected error containing %q, got %v", body, expected, err)
+			}
+		}
+
+	})
+
+}
+
+func TestResourcePolicies(t *testing.T) {
+
+	resource := Resource{
+		Name:            "staging",
+		MaxDuration:     ConfigDuration(90 * time.Minute),
+		AllowedChannels: []string{"#deploys", "C0123"},
+	}
+
+	if err := resource.CheckDuration(time.Hour); err != nil {
+		t.Error("expected no error, got", err)
+	}
+
+	expected := "\"*staging*\" can only be reserved for up to *1 hour, 30 minutes* at a time"
+	if err := resource.CheckDuration(2 * time.Hour); err == nil || err.Error() != expected {
+		t.Error("expected", expected, "got", err)
+	}
+
+	channels := map[[2]string]bool{
+		{"C9999", "deploys"}: true,
+		{"C0123", "random"}:  true,
+		{"C9999", "random"}:  false,
+	}
+
+	for channel, expected := range channels {
+		if actual := resource.IsAllowedInChannel(channel[0], channel[1]); actual != expected {
+			t.Error(channel, ": expected", expected, "got", actual)
+		}
+	}
+
+	// No channels means anywhere
+	if !(Resource{Name: "qa"}).IsAllowedInChannel("C9999", "random") {
+		t.Error("expected", true, "got", false)
+	}
+
+}
@@ -14,6 +14,10 @@ func NewRouter() *mux.Router {
 
 		handler = route.HandlerFunc
 
+		// Reject any request that can't be verified as coming from Slack, or
+		// for the API, that doesn't carry the API token
+		handler = route.Verify(handler, route.Name)
+
 		// Decorate each handler with a call to Logger, which will log
 		// before/after DEBUG statements
 		handler = DecorateWithLogger(handler, route.Name)
@@ -2,11 +2,14 @@ package main
 
 import "net/http"
 
+// `Verify` decorates the handler to reject requests from anyone who
+// shouldn't be making them
 type Route struct {
 	Name        string
 	Method      string
 	Pattern     string
 	HandlerFunc http.HandlerFunc
+	Verify      func(http.Handler, string) http.Handler
 }
 
 type Routes []Route
@@ -17,5 +20,20 @@ var routes = Routes{
 		"POST",
 		"/slack/commands/reservations",
 		MainHandler,
+		DecorateWithSlackVerification,
+	},
+	Route{
+		"InteractionsHandler",
+		"POST",
+		"/slack/interactions",
+		InteractionsHandler,
+		DecorateWithSlackVerification,
+	},
+	Route{
+		"StatsHandler",
+		"GET",
+		"/api/stats",
+		StatsHandler,
+		DecorateWithApiToken,
 	},
 }
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// All reservations on a single resource, ordered by start time. No more
+// reservations overlap at any one time than the resource has slots for (see
+// `Resource.Slots()`), and a user's own reservations never overlap.
+type Schedule []Reservation
+
+// Returned when a reservation can't be made because it overlaps another
+type ConflictError struct {
+	Resource string
+	Conflict Reservation
+}
+
+func (e *ConflictError) Error() string {
+
+	return fmt.Sprintf(
+		"Conflict: %v has \"%v\" booked for %v",
+		e.Conflict.User,
+		e.Resource,
+		e.Conflict.PeriodToString())
+
+}
+
+func isConflictError(err error) bool {
+
+	_, ok := err.(*ConflictError)
+	return ok
+
+}
+
+// Returns the reservation that's in effect right now, or the zero value
+// `Reservation{}` if the resource is free
+func (s Schedule) Current() Reservation {
+
+	for _, r := range s {
+		if r.IsActive() {
+			return r
+		}
+	}
+
+	return Reservation{}
+
+}
+
+// Returns every reservation in effect right now, one for each slot in use
+func (s Schedule) Active() Schedule {
+
+	active := Schedule{}
+
+	for _, r := range s {
+		if r.IsActive() {
+			active = append(active, r)
+		}
+	}
+
+	return active
+
+}
+
+// Returns the reservation that ends soonest, or the zero value if there are
+// none
+func (s Schedule) EndingFirst() Reservation {
+
+	var first Reservation
+
+	for _, r := range s {
+		if !first.IsPresent() || r.EndAt.Before(first.EndAt) {
+			first = r
+		}
+	}
+
+	return first
+
+}
+
+// Returns reservations that haven't started yet, soonest first
+func (s Schedule) Upcoming() Schedule {
+
+	upcoming := Schedule{}
+
+	for _, r := range s {
+		if r.IsUpcoming() {
+			upcoming = append(upcoming, r)
+		}
+	}
+
+	return upcoming
+
+}
+
+// Returns a reservation that stops `reservation` being made with `slots`
+// slots, ignoring any earlier version of the same booking: the holder's own
+// overlapping reservation, or else the one that would take the last slot
+// when it begins
+func (s Schedule) FindConflict(reservation Reservation, slots int) (Reservation, bool) {
+
+	overlapping := Schedule{}
+	for _, r := range s {
+		if r.IsSameBooking(reservation) || r.IsExpired() || !r.Overlaps(reservation) {
+			continue
+		}
+
+		if r.IsHeldBy(reservation.Holder()) {
+			return r, true
+		}
+		overlapping = append(overlapping, r)
+	}
+
+	if len(overlapping) < slots {
+		return Reservation{}, false
+	}
+
+	// The number of slots in use only goes up when a reservation begins, so
+	// those are the only times that need checking
+	for _, next := range overlapping {
+		at := latestTime(next.StartAt, reservation.StartAt)
+
+		in_use := 0
+		var last Reservation
+		for _, r := range overlapping {
+			if !r.StartAt.After(at) && r.EndAt.After(at) {
+				in_use++
+				last = r
+			}
+		}
+
+		if in_use >= slots {
+			return last, true
+		}
+	}
+
+	return Reservation{}, false
+
+}
+
+func (s Schedule) indexOf(reservation Reservation) int {
+
+	for i, r := range s {
+		if r.IsSameBooking(reservation) {
+			return i
+		}
+	}
+
+	return -1
+
+}
+
+func (s Schedule) sort() {
+
+	sort.SliceStable(s, func(i, j int) bool {
+		return s[i].StartAt.Before(s[j].StartAt)
+	})
+
+}
+
+// Accepts the old file format, where each resource had a single reservation
+// rather than a list
+func (s *Schedule) UnmarshalJSON(body []byte) error {
+
+	var list []Reservation
+	err := json.Unmarshal(body, &list)
+	if err == nil {
+		*s = Schedule(list)
+		return nil
+	}
+
+	var single Reservation
+	if json.Unmarshal(body, &single) != nil {
+		// Report the error for the current format
+		return err
+	}
+
+	*s = Schedule{}
+	if single.IsPresent() {
+		*s = Schedule{single}
+	}
+
+	return nil
+
+}
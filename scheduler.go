@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// How often the scheduler looks for reservations that are about to expire
+var scheduler_interval = time.Minute
+
+// Reservations that expired longer ago than this are pruned without telling
+// the holder, so that old reservations don't trigger a flood of messages
+// the first time the scheduler runs
+var expiry_notification_window = time.Hour
+
+const default_reminder_lead_minutes = 10
+
+// A direct message to be sent to a user once a transaction has committed
+type Notification struct {
+	UserId string
+	Text   string
+}
+
+// Runs `runScheduledTasks` every `interval` in the background
+func StartScheduler(interval time.Duration) {
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		for range ticker.C {
+			runScheduledTasks()
+		}
+	}()
+
+}
+
+// Reminds holders whose reservations are about to expire, lets them know
+// when they have expired, and hands expired resources on to the next person
+// in line. Messages are only sent once the changes have been saved, so that
+// nobody is told about something that didn't happen.
+func runScheduledTasks() {
+
+	var notifications []Notification
+
+	err := store.Update(func(tx *StoreTx) error {
+
+		notifications = collectNotifications(tx, reminderLead())
+
+		return rollbackUnless(len(notifications) > 0 || len(tx.Events) > 0)
+
+	})
+
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	sendNotifications(notifications)
+
+}
+
+// Marks reservations ending within `lead` as reminded, prunes expired ones
+// and promotes waitlists, returning the messages to send
+func collectNotifications(tx *StoreTx, lead time.Duration) []Notification {
+
+	var notifications []Notification
+
+	for resource, schedule := range tx.Reservations {
+		for i, reservation := range schedule {
+			switch {
+
+			case reservation.IsExpired():
+				if time.Since(reservation.EndAt) <= expiry_notification_window {
+					notifications = append(notifications, Notification{
+						UserId: reservation.UserId,
+						Text:   expiryText(resource),
+					})
+				}
+
+			case reservation.IsActive() &&
+				!reservation.Reminded &&
+				lead > 0 &&
+				time.Until(reservation.EndAt) <= lead:
+				schedule[i].Reminded = true
+				notifications = append(notifications, Notification{
+					UserId: reservation.UserId,
+					Text:   reminderText(resource, reservation),
+				})
+
+			}
+		}
+	}
+
+	tx.PruneExpired()
+
+	notifications = append(notifications, promotionNotifications(promoteWaitlists(tx))...)
+
+	return notifications
+
+}
+
+// Drops finished reservations, so schedules don't grow forever. When the
+// scheduler is running it does this itself, once it has let their holders
+// know, so they're left for it.
+func pruneExpiredUnlessScheduled(tx *StoreTx) {
+
+	if slack_client != nil {
+		return
+	}
+
+	tx.PruneExpired()
+
+}
+
+func sendNotifications(notifications []Notification) {
+
+	if slack_client == nil {
+		return
+	}
+
+	postNotifications(slack_client, notifications)
+
+}
+
+// Sends the notifications without holding up the response to the user
+func sendNotificationsInBackground(notifications []Notification) {
+
+	if slack_client == nil || len(notifications) == 0 {
+		return
+	}
+
+	go postNotifications(slack_client, notifications)
+
+}
+
+func postNotifications(client *SlackClient, notifications []Notification) {
+
+	for _, notification := range notifications {
+		// Reservations made before user IDs were recorded can't be notified
+		if notification.UserId == "" {
+			log.Debugf("Not sending notification without a user ID: %v", notification.Text)
+			continue
+		}
+
+		err := client.PostMessage(notification.UserId, notification.Text)
+		if err != nil {
+			log.Error(err)
+		}
+	}
+
+}
+
+func reminderText(resource string, reservation Reservation) string {
+
+	return fmt.Sprintf(
+		"Your reservation of *%v* expires in %v. Need longer? "+
+			"Type `/reservations extend %v by 30 mins`",
+		resource,
+		reservation.RemainingTimeToString(),
+		resource)
+
+}
+
+func expiryText(resource string) string {
+
+	return fmt.Sprintf("Your reservation of *%v* has expired", resource)
+
+}
+
+// Lets everyone who's been handed a resource from a waitlist know it's theirs
+func promotionNotifications(promotions []Promotion) []Notification {
+
+	notifications := []Notification{}
+	for _, promotion := range promotions {
+		notifications = append(notifications, Notification{
+			UserId: promotion.Reservation.UserId,
+			Text:   promotionText(promotion),
+		})
+	}
+
+	return notifications
+
+}
+
+func promotionText(promotion Promotion) string {
+
+	return fmt.Sprintf(
+		"You're up! *%v* is now reserved for you for the next %v",
+		promotion.Resource,
+		promotion.Reservation.RemainingTimeToString())
+
+}
+
+// How long before a reservation ends to remind its holder. Zero disables
+// reminders.
+func reminderLead() time.Duration {
+
+	minutes, err := strconv.Atoi(reminderLeadMinutes())
+	if err != nil || minutes < 0 {
+		minutes = default_reminder_lead_minutes
+	}
+
+	return time.Duration(minutes) * time.Minute
+
+}
+
+func reminderLeadMinutes() string {
+
+	value := os.Getenv("REMINDER_LEAD_MINUTES")
+	if value == "" {
+		return strconv.Itoa(default_reminder_lead_minutes)
+	}
+
+	return value
+
+}
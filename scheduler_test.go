@@ -0,0 +1,118 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunScheduledTasks(t *testing.T) {
+
+	//
+	// Setup
+	//
+
+	defer useResources("production, staging, qa")()
+
+	defer useTempStore()()
+
+	api, cleanup_api := useFakeSlackApi()
+	defer cleanup_api()
+
+	now := time.Now()
+
+	// Ends within the reminder lead time
+	store.Upsert("production", Reservation{
+		User: "alice", UserId: "UALICE", StartAt: now, EndAt: now.Add(5 * time.Minute)})
+
+	// Has just expired, with someone waiting
+	store.Upsert("staging", Reservation{
+		User: "bob", UserId: "UBOB", StartAt: now.Add(-time.Hour), EndAt: now.Add(-time.Second)})
+	store.Update(func(tx *StoreTx) error {
+		tx.Waitlists.Push("staging", WaitlistEntry{
+			User: "carol", UserId: "UCAROL", Duration: time.Hour, QueuedAt: now})
+		return nil
+	})
+
+	// Plenty of time left
+	store.Upsert("qa", Reservation{
+		User: "dave", UserId: "UDAVE", StartAt: now, EndAt: now.Add(time.Hour)})
+
+	//
+	// Test
+	//
+
+	runScheduledTasks()
+
+	expected := map[string]string{
+		"UALICE": "Your reservation of *production* expires in",
+		"UBOB":   "Your reservation of *staging* has expired",
+		"UCAROL": "You're up! *staging* is now reserved for you",
+	}
+
+	if len(api.messages) != len(expected) {
+		t.Fatal("expected", len(expected), "messages, got", api.messages)
+	}
+
+	for _, message := range api.messages {
+		prefix, ok := expected[message["channel"]]
+		if !ok || !strings.HasPrefix(message["text"], prefix) {
+			t.Errorf("unexpected message %v", message)
+		}
+	}
+
+	reservation, _ := store.Get("production")
+	if !reservation.Reminded {
+		t.Error("expected", true, "got", reservation.Reminded)
+	}
+
+	reservation, _ = store.Get("staging")
+	if reservation.User != "carol" {
+		t.Error("expected", "carol", "got", reservation.User)
+	}
+
+	// Running again shouldn't repeat any messages
+	runScheduledTasks()
+
+	if len(api.messages) != len(expected) {
+		t.Error("expected", len(expected), "messages, got", api.messages)
+	}
+
+}
+
+func TestReservingLeavesOtherExpiriesToTheScheduler(t *testing.T) {
+
+	//
+	// Setup
+	//
+
+	defer useResources("production, staging")()
+
+	defer useTempStore()()
+
+	api, cleanup_api := useFakeSlackApi()
+	defer cleanup_api()
+
+	now := time.Now()
+
+	store.Upsert("staging", Reservation{
+		User: "bob", UserId: "UBOB", StartAt: now.Add(-time.Hour), EndAt: now.Add(-time.Second)})
+
+	//
+	// Test
+	//
+
+	expectMatch(t,
+		runCommand(t, handleCommandCreate, "alice", "reserve production for 1 hour"),
+		"successfully reserved")
+
+	runScheduledTasks()
+
+	messages := api.waitForMessages(1)
+	if len(messages) != 1 ||
+		messages[0]["channel"] != "UBOB" ||
+		!strings.HasPrefix(messages[0]["text"], "Your reservation of *staging* has expired") {
+		t.Error("expected an expiry message to UBOB, got", messages)
+	}
+
+}
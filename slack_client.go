@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const default_slack_api_url = "https://slack.com/api"
+
+// Client used to send notifications. Nil if no bot token is configured, in
+// which case notifications are disabled.
+var slack_client *SlackClient
+
+// A minimal client for the Slack Web API (https://api.slack.com/web).
+// `BaseUrl` can be pointed at a fake server for testing.
+type SlackClient struct {
+	BaseUrl    string
+	Token      string
+	HTTPClient *http.Client
+}
+
+// A workspace member, as returned by `users.list` and `users.info`. `Tz` is
+// the name of their time zone, e.g. "America/New_York".
+type SlackUser struct {
+	Id      string `json:"id"`
+	TeamId  string `json:"team_id"`
+	Name    string `json:"name"`
+	Deleted bool   `json:"deleted"`
+	Tz      string `json:"tz"`
+}
+
+type slackApiResponse struct {
+	Ok    bool   `json:"ok"`
+	Error string `json:"error"`
+}
+
+func NewSlackClient() *SlackClient {
+
+	if slackBotToken() == "" {
+		return nil
+	}
+
+	return &SlackClient{
+		BaseUrl:    slackApiUrl(),
+		Token:      slackBotToken(),
+		HTTPClient: &http.Client{Timeout: 10 * time.Second},
+	}
+
+}
+
+// Posts a message to a channel. Passing a user ID as the channel sends the
+// message to that user's DM with the app.
+func (c *SlackClient) PostMessage(channel string, text string) error {
+
+	return c.call("chat.postMessage", map[string]interface{}{
+		"channel": channel,
+		"text":    text,
+	}, nil)
+
+}
+
+// Lists every user in the workspace, following pagination. Requires the
+// `users:read` scope.
+func (c *SlackClient) ListUsers() ([]SlackUser, error) {
+
+	var users []SlackUser
+	cursor := ""
+
+	for {
+		var result struct {
+			Members          []SlackUser `json:"members"`
+			ResponseMetadata struct {
+				NextCursor string `json:"next_cursor"`
+			} `json:"response_metadata"`
+		}
+
+		params := url.Values{"limit": {"200"}}
+		if cursor != "" {
+			params.Set("cursor", cursor)
+		}
+
+		err := c.callForm("users.list", params, &result)
+		if err != nil {
+			return nil, err
+		}
+
+		users = append(users, result.Members...)
+
+		cursor = result.ResponseMetadata.NextCursor
+		if cursor == "" {
+			return users, nil
+		}
+	}
+
+}
+
+// Looks up a single user. Requires the `users:read` scope.
+func (c *SlackClient) UserInfo(user_id string) (SlackUser, error) {
+
+	var result struct {
+		User SlackUser `json:"user"`
+	}
+
+	err := c.callForm("users.info", url.Values{"user": {user_id}}, &result)
+	if err != nil {
+		return SlackUser{}, err
+	}
+
+	return result.User, nil
+
+}
+
+// Lists the IDs of a user group's members. Requires the `usergroups:read`
+// scope.
+func (c *SlackClient) UsergroupMembers(usergroup string) ([]string, error) {
+
+	var result struct {
+		Users []string `json:"users"`
+	}
+
+	err := c.callForm(
+		"usergroups.users.list",
+		url.Values{"usergroup": {usergroup}},
+		&result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result.Users, nil
+
+}
+
+// Calls a Web API method with a JSON body, decoding the response into
+// `result` (if not nil). Returns an error if Slack responds with `ok: false`.
+func (c *SlackClient) call(
+	method string, params interface{}, result interface{}) error {
+
+	body, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+
+	return c.do(method, "application/json; charset=utf-8", body, result)
+
+}
+
+// Like `call()`, for the (read) methods that only accept form encoded bodies
+func (c *SlackClient) callForm(
+	method string, params url.Values, result interface{}) error {
+
+	return c.do(
+		method,
+		"application/x-www-form-urlencoded",
+		[]byte(params.Encode()),
+		result)
+
+}
+
+func (c *SlackClient) do(
+	method string, content_type string, body []byte, result interface{}) error {
+
+	endpoint := strings.TrimRight(c.BaseUrl, "/") + "/" + method
+
+	request, err := http.NewRequest("POST", endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", content_type)
+	request.Header.Set("Authorization", "Bearer "+c.Token)
+
+	response, err := c.HTTPClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return errors.New(
+			fmt.Sprintf("Slack API %v returned HTTP %v", method, response.StatusCode))
+	}
+
+	var raw json.RawMessage
+	err = json.NewDecoder(response.Body).Decode(&raw)
+	if err != nil {
+		return err
+	}
+
+	var status slackApiResponse
+	err = json.Unmarshal(raw, &status)
+	if err != nil {
+		return err
+	}
+	if !status.Ok {
+		return errors.New(
+			fmt.Sprintf("Slack API %v returned error: %v", method, status.Error))
+	}
+
+	if result != nil {
+		return json.Unmarshal(raw, result)
+	}
+
+	return nil
+
+}
+
+func slackBotToken() string {
+
+	return os.Getenv("SLACK_BOT_TOKEN")
+
+}
+
+func slackApiUrl() string {
+
+	url := os.Getenv("SLACK_API_URL")
+	if url == "" {
+		return default_slack_api_url
+	}
+
+	return url
+
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// A fake Slack Web API that records every chat.postMessage call, lists
+// `users` one page at a time, looks them up one by one and lists the members
+// of `usergroups`
+type fakeSlackApi struct {
+	mutex      sync.Mutex
+	messages   []map[string]string
+	users      []SlackUser
+	usergroups map[string][]string
+}
+
+func (f *fakeSlackApi) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	if r.Header.Get("Authorization") != "Bearer xoxb-test" {
+		w.Write([]byte(`{"ok": false, "error": "invalid_auth"}`))
+		return
+	}
+
+	if r.URL.Path == "/users.list" {
+		f.listUsers(w, r)
+		return
+	}
+
+	if r.URL.Path == "/users.info" {
+		f.userInfo(w, r)
+		return
+	}
+
+	if r.URL.Path == "/usergroups.users.list" {
+		r.ParseForm()
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"ok":    true,
+			"users": f.usergroups[r.Form.Get("usergroup")],
+		})
+		return
+	}
+
+	if r.URL.Path != "/chat.postMessage" {
+		w.Write([]byte(`{"ok": false, "error": "unknown_method"}`))
+		return
+	}
+
+	var message map[string]string
+	json.NewDecoder(r.Body).Decode(&message)
+
+	f.mutex.Lock()
+	f.messages = append(f.messages, message)
+	f.mutex.Unlock()
+
+	w.Write([]byte(`{"ok": true}`))
+
+}
+
+func (f *fakeSlackApi) listUsers(w http.ResponseWriter, r *http.Request) {
+
+	r.ParseForm()
+	page, _ := strconv.Atoi(r.Form.Get("cursor"))
+
+	response := map[string]interface{}{"ok": true, "members": []SlackUser{}}
+	if page < len(f.users) {
+		response["members"] = f.users[page : page+1]
+	}
+	if page+1 < len(f.users) {
+		response["response_metadata"] = map[string]string{
+			"next_cursor": strconv.Itoa(page + 1),
+		}
+	}
+
+	json.NewEncoder(w).Encode(response)
+
+}
+
+func (f *fakeSlackApi) userInfo(w http.ResponseWriter, r *http.Request) {
+
+	r.ParseForm()
+
+	for _, user := range f.users {
+		if user.Id == r.Form.Get("user") {
+			json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "user": user})
+			return
+		}
+	}
+
+	w.Write([]byte(`{"ok": false, "error": "user_not_found"}`))
+
+}
+
+// Waits up to a second for at least `count` messages, since notifications
+// are sent in the background, and returns the ones received so far
+func (f *fakeSlackApi) waitForMessages(count int) []map[string]string {
+
+	deadline := time.Now().Add(time.Second)
+
+	for {
+		f.mutex.Lock()
+		messages := append([]map[string]string{}, f.messages...)
+		f.mutex.Unlock()
+
+		if len(messages) >= count || time.Now().After(deadline) {
+			return messages
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+}
+
+// Starts a fake Slack API and points `slack_client` at it
+func useFakeSlackApi() (*fakeSlackApi, func()) {
+
+	api := &fakeSlackApi{}
+	server := httptest.NewServer(api)
+
+	old_slack_client := slack_client
+	slack_client = &SlackClient{
+		BaseUrl:    server.URL,
+		Token:      "xoxb-test",
+		HTTPClient: server.Client(),
+	}
+
+	return api, func() {
+		slack_client = old_slack_client
+		server.Close()
+
+		// Forget time zones looked up from the fake users
+		user_time_zone_cache.Lock()
+		user_time_zone_cache.zones = map[string]cachedTimeZone{}
+		user_time_zone_cache.Unlock()
+	}
+
+}
+
+func TestSlackClientPostMessage(t *testing.T) {
+
+	api, cleanup := useFakeSlackApi()
+	defer cleanup()
+
+	t.Run("Success", func(t *testing.T) {
+
+		err := slack_client.PostMessage("U0001", "hello")
+		if err != nil {
+			t.Fatal("expected no error, got", err)
+		}
+
+		if len(api.messages) != 1 {
+			t.Fatal("expected", 1, "got", len(api.messages))
+		}
+		if api.messages[0]["channel"] != "U0001" {
+			t.Error("expected", "U0001", "got", api.messages[0]["channel"])
+		}
+		if api.messages[0]["text"] != "hello" {
+			t.Error("expected", "hello", "got", api.messages[0]["text"])
+		}
+
+	})
+
+	t.Run("SlackError", func(t *testing.T) {
+
+		client := *slack_client
+		client.Token = "xoxb-wrong"
+
+		err := client.PostMessage("U0001", "hello")
+		if err == nil || err.Error() !=
+			"Slack API chat.postMessage returned error: invalid_auth" {
+			t.Error("expected an invalid_auth error, got", err)
+		}
+
+	})
+
+	t.Run("NoToken", func(t *testing.T) {
+
+		old_env := os.Getenv("SLACK_BOT_TOKEN")
+		defer os.Setenv("SLACK_BOT_TOKEN", old_env)
+		os.Setenv("SLACK_BOT_TOKEN", "")
+
+		if client := NewSlackClient(); client != nil {
+			t.Error("expected", nil, "got", client)
+		}
+
+	})
+
+}
+
+func TestSlackClientListUsers(t *testing.T) {
+
+	api, cleanup := useFakeSlackApi()
+	defer cleanup()
+
+	api.users = []SlackUser{
+		{Id: "U1", Name: "alice"},
+		{Id: "U2", Name: "bob"},
+		{Id: "U3", Name: "carol"},
+	}
+
+	users, err := slack_client.ListUsers()
+	if err != nil {
+		t.Fatal("expected no error, got", err)
+	}
+
+	if len(users) != 3 || users[2].Name != "carol" {
+		t.Error("expected", api.users, "got", users)
+	}
+
+}
@@ -20,6 +20,13 @@ type SlackRequest struct {
 	TriggerId      string `json:"trigger_id"`
 }
 
+// The user who made the request
+func (sr SlackRequest) User() UserIdentity {
+
+	return UserIdentity{Id: sr.UserId, TeamId: sr.TeamId, Name: sr.UserName}
+
+}
+
 func (sr SlackRequest) FormattedSubcommand() string {
 
 	return strings.ToLower(strings.Trim(sr.Text, " "))
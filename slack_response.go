@@ -1,6 +1,143 @@
 package main
 
+import (
+	"fmt"
+	"time"
+)
+
+// Slack rejects messages with more blocks than this
+const max_slack_blocks = 50
+
+// A response to a slash command. `Text` is always set, since it's what Slack
+// shows in notifications and on clients that can't render `Blocks`.
+// `ReplaceOriginal` only applies to responses sent to a `response_url`.
 type SlackResponse struct {
-	Text         string `json:"text"`
-	ResponseType string `json:"response_type"`
+	Text            string  `json:"text"`
+	ResponseType    string  `json:"response_type"`
+	Blocks          []Block `json:"blocks,omitempty"`
+	ReplaceOriginal bool    `json:"replace_original,omitempty"`
+}
+
+// A Block Kit layout block (https://api.slack.com/reference/block-kit/blocks).
+// Only the fields used by the block's `Type` are set.
+type Block struct {
+	Type      string        `json:"type"`
+	BlockId   string        `json:"block_id,omitempty"`
+	Text      *TextObject   `json:"text,omitempty"`
+	Fields    []TextObject  `json:"fields,omitempty"`
+	Elements  []interface{} `json:"elements,omitempty"`
+	Accessory interface{}   `json:"accessory,omitempty"`
+}
+
+type TextObject struct {
+	Type  string `json:"type"`
+	Text  string `json:"text"`
+	Emoji bool   `json:"emoji,omitempty"`
+}
+
+// A button that sends `Value` to the interactions endpoint when clicked
+type ButtonElement struct {
+	Type     string     `json:"type"`
+	Text     TextObject `json:"text"`
+	ActionId string     `json:"action_id"`
+	Value    string     `json:"value"`
+	Style    string     `json:"style,omitempty"`
+}
+
+func MarkdownText(text string) TextObject {
+
+	return TextObject{Type: "mrkdwn", Text: text}
+
+}
+
+func PlainText(text string) TextObject {
+
+	return TextObject{Type: "plain_text", Text: text, Emoji: true}
+
+}
+
+func NewHeaderBlock(text string) Block {
+
+	header := PlainText(text)
+	return Block{Type: "header", Text: &header}
+
+}
+
+func NewSectionBlock(text string, fields ...string) Block {
+
+	section := MarkdownText(text)
+	block := Block{Type: "section", Text: &section}
+
+	for _, field := range fields {
+		block.Fields = append(block.Fields, MarkdownText(field))
+	}
+
+	return block
+
+}
+
+func NewContextBlock(texts ...string) Block {
+
+	block := Block{Type: "context"}
+
+	for _, text := range texts {
+		block.Elements = append(block.Elements, MarkdownText(text))
+	}
+
+	return block
+
+}
+
+func NewActionsBlock(buttons ...ButtonElement) Block {
+
+	block := Block{Type: "actions"}
+
+	for _, button := range buttons {
+		block.Elements = append(block.Elements, button)
+	}
+
+	return block
+
+}
+
+func NewButton(text string, action_id string, value string) ButtonElement {
+
+	return ButtonElement{
+		Type:     "button",
+		Text:     PlainText(text),
+		ActionId: action_id,
+		Value:    value,
+	}
+
+}
+
+func NewDividerBlock() Block {
+
+	return Block{Type: "divider"}
+
+}
+
+// Shows the response's text with a row of buttons underneath
+func (sr SlackResponse) WithButtons(buttons ...ButtonElement) SlackResponse {
+
+	sr.Blocks = []Block{
+		NewSectionBlock(sr.Text),
+		NewActionsBlock(buttons...),
+	}
+
+	return sr
+
+}
+
+// Formats a time so that Slack shows it in each reader's own time zone,
+// falling back to `fallback_layout` in the server's time zone
+// (https://api.slack.com/reference/surfaces/formatting#date-formatting)
+func slackDate(t time.Time, format string, fallback_layout string) string {
+
+	return fmt.Sprintf(
+		"<!date^%v^%v|%v>",
+		t.Unix(),
+		format,
+		t.Format(fallback_layout))
+
 }
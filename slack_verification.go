@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+const slack_signature_version = "v0"
+
+// Requests with a timestamp further than this from our own clock (in either
+// direction) are rejected, to prevent a captured request from being replayed
+var slack_request_max_age = 5 * time.Minute
+
+func DecorateWithSlackVerification(inner http.Handler, name string) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		body, err := ioutil.ReadAll(io.LimitReader(r.Body, 1048576 /*1MB*/))
+		if err != nil {
+			log.Error("Could not read request body")
+			buildInvalidResponse(w)
+			return
+		}
+		r.Body.Close()
+
+		if !isVerifiedSlackRequest(r, body) {
+			buildInvalidResponse(w)
+			return
+		}
+
+		// Put the body back so the inner handler can read it
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		inner.ServeHTTP(w, r)
+
+	})
+
+}
+
+// A request is verified if it carries a valid signature. If legacy token
+// verification has been opted in to, requests without a signature may
+// instead present a valid verification token.
+func isVerifiedSlackRequest(r *http.Request, body []byte) bool {
+
+	signature := r.Header.Get("X-Slack-Signature")
+	timestamp := r.Header.Get("X-Slack-Request-Timestamp")
+
+	if signature != "" && slackSigningSecret() != "" {
+		err := verifySlackSignature(signature, timestamp, body, time.Now())
+		if err != nil {
+			log.Errorf("Invalid Slack signature: %v", err)
+			return false
+		}
+
+		return true
+	}
+
+	if isLegacyTokenFallbackEnabled() {
+		qp, err := url.ParseQuery(string(body))
+		if err != nil {
+			log.Error("Could not parse query params")
+			return false
+		}
+
+		slack_request := SlackRequest{Token: requestToken(qp)}
+		if !isValidSlackVerificationToken(slack_request) {
+			log.Errorf("Invalid Slack token %v", maskToken(slack_request.Token))
+			return false
+		}
+
+		log.Warning("Accepted request using legacy verification token")
+		return true
+	}
+
+	log.Error("Request is missing a Slack signature")
+	return false
+
+}
+
+// Slash commands send the token as a form field, while interactions send it
+// inside their JSON payload
+func requestToken(qp url.Values) string {
+
+	payload := qp.Get("payload")
+	if payload == "" {
+		return qp.Get("token")
+	}
+
+	var interaction SlackInteraction
+	if json.Unmarshal([]byte(payload), &interaction) != nil {
+		return ""
+	}
+
+	return interaction.Token
+
+}
+
+func verifySlackSignature(
+	signature string, timestamp string, body []byte, now time.Time) error {
+
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.New(fmt.Sprintf("Invalid timestamp %q", timestamp))
+	}
+
+	age := now.Sub(time.Unix(ts, 0))
+	if math.Abs(float64(age)) > float64(slack_request_max_age) {
+		return errors.New(fmt.Sprintf("Stale timestamp %v", timestamp))
+	}
+
+	expected := computeSlackSignature(slackSigningSecret(), timestamp, body)
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return errors.New("Signature mismatch")
+	}
+
+	return nil
+
+}
+
+// See https://api.slack.com/authentication/verifying-requests-from-slack
+func computeSlackSignature(secret string, timestamp string, body []byte) string {
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%v:%v:", slack_signature_version, timestamp)
+	mac.Write(body)
+
+	return slack_signature_version + "=" + hex.EncodeToString(mac.Sum(nil))
+
+}
+
+func isValidSlackVerificationToken(s SlackRequest) bool {
+
+	token := os.Getenv("SLACK_VERIFICATION_TOKEN")
+	return token != "" && token == s.Token
+
+}
+
+func slackSigningSecret() string {
+
+	return os.Getenv("SLACK_SIGNING_SECRET")
+
+}
+
+func isLegacyTokenFallbackEnabled() bool {
+
+	return os.Getenv("SLACK_LEGACY_TOKEN_FALLBACK") == "true"
+
+}
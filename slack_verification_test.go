@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDecorateWithSlackVerification(t *testing.T) {
+
+	//
+	// Setup
+	//
+
+	secret := "8f742231b10e8888abcd99yyyzzz85a5"
+	token := "gIkuvaNzQIHg97ATvDxqgjtO"
+	body := "token=" + token + "&text=list"
+
+	old_secret := os.Getenv("SLACK_SIGNING_SECRET")
+	defer os.Setenv("SLACK_SIGNING_SECRET", old_secret)
+	os.Setenv("SLACK_SIGNING_SECRET", secret)
+
+	old_token := os.Getenv("SLACK_VERIFICATION_TOKEN")
+	defer os.Setenv("SLACK_VERIFICATION_TOKEN", old_token)
+	os.Setenv("SLACK_VERIFICATION_TOKEN", token)
+
+	old_fallback := os.Getenv("SLACK_LEGACY_TOKEN_FALLBACK")
+	defer os.Setenv("SLACK_LEGACY_TOKEN_FALLBACK", old_fallback)
+
+	// The inner handler echoes back the body it received
+	handler := DecorateWithSlackVerification(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			b, _ := ioutil.ReadAll(r.Body)
+			fmt.Fprint(w, "ok:"+string(b))
+		}),
+		"Test")
+
+	request := func(timestamp time.Time, signature string) string {
+		ts := strconv.FormatInt(timestamp.Unix(), 10)
+		if signature == "" {
+			signature = computeSlackSignature(secret, ts, []byte(body))
+		}
+
+		r := httptest.NewRequest("POST", "/", strings.NewReader(body))
+		r.Header.Set("X-Slack-Request-Timestamp", ts)
+		r.Header.Set("X-Slack-Signature", signature)
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Body.String()
+	}
+
+	t.Run("ValidSignature", func(t *testing.T) {
+
+		os.Setenv("SLACK_LEGACY_TOKEN_FALLBACK", "")
+
+		expected := "ok:" + body
+		if actual := request(time.Now(), ""); actual != expected {
+			t.Error("expected", expected, "got", actual)
+		}
+
+	})
+
+	t.Run("InvalidSignature", func(t *testing.T) {
+
+		os.Setenv("SLACK_LEGACY_TOKEN_FALLBACK", "")
+
+		actual := request(time.Now(), "v0=deadbeef")
+		if !strings.Contains(actual, "invalid request") {
+			t.Error("expected request to be rejected, got", actual)
+		}
+
+	})
+
+	t.Run("StaleTimestamp", func(t *testing.T) {
+
+		os.Setenv("SLACK_LEGACY_TOKEN_FALLBACK", "")
+
+		actual := request(time.Now().Add(-10*time.Minute), "")
+		if !strings.Contains(actual, "invalid request") {
+			t.Error("expected request to be rejected, got", actual)
+		}
+
+	})
+
+	t.Run("LegacyToken", func(t *testing.T) {
+
+		unsigned := func() string {
+			r := httptest.NewRequest("POST", "/", strings.NewReader(body))
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			return w.Body.String()
+		}
+
+		os.Setenv("SLACK_LEGACY_TOKEN_FALLBACK", "")
+		if actual := unsigned(); !strings.Contains(actual, "invalid request") {
+			t.Error("expected request to be rejected, got", actual)
+		}
+
+		os.Setenv("SLACK_LEGACY_TOKEN_FALLBACK", "true")
+		if actual := unsigned(); actual != "ok:"+body {
+			t.Error("expected", "ok:"+body, "got", actual)
+		}
+
+		// A bad signature is never rescued by the fallback
+		if actual := request(time.Now(), "v0=deadbeef"); actual == "ok:"+body {
+			t.Error("expected request to be rejected, got", actual)
+		}
+
+	})
+
+}
+
+func TestComputeSlackSignature(t *testing.T) {
+
+	// Example from Slack's documentation
+	secret := "8f742231b10e8888abcd99yyyzzz85a5"
+	timestamp := "1531420618"
+	body := "token=xyzz0WbapA4vBCDEFasx0q6G&team_id=T1DC2JH3J&team_domain=testteamnow&channel_id=G8PSS9T3V&channel_name=foobar&user_id=U2CERLKJA&user_name=roadrunner&command=%2Fwebhook-collect&text=&response_url=https%3A%2F%2Fhooks.slack.com%2Fcommands%2FT1DC2JH3J%2F397700885554%2F96rGlfmibIGlgcZRskXaIFfN&trigger_id=398738663015.47445629121.803a0bc887a14d10d2c447fce8b6703c"
+
+	expected := "v0=a2114d57b48eac39b9ad189dd8316235a7b4a8d21a10bd27519666489c69b503"
+	actual := computeSlackSignature(secret, timestamp, []byte(body))
+
+	if actual != expected {
+		t.Error("expected", expected, "got", actual)
+	}
+
+}
+
+func TestRequestToken(t *testing.T) {
+
+	test_cases := map[string]string{
+		"token=abc&text=list":                   "abc",
+		"payload=%7B%22token%22%3A%22def%22%7D": "def",
+		"payload=nope":                          "",
+	}
+
+	for body, expected := range test_cases {
+		qp, _ := url.ParseQuery(body)
+
+		if actual := requestToken(qp); actual != expected {
+			t.Error("expected", expected, "got", actual)
+		}
+	}
+
+}
@@ -0,0 +1,429 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// How far back stats look if no time is given
+var default_stats_window = 30 * 24 * time.Hour
+
+// How many users and hours of the day are listed as the top ones
+var max_stats_top = 3
+
+// How much a resource was used between `Since` and `Until`, worked out from
+// its history. Busy time is averaged over the resource's slots, and hours of
+// the day are in the server's time zone.
+type ResourceStats struct {
+	Resource             string      `json:"resource"`
+	Since                time.Time   `json:"since"`
+	Until                time.Time   `json:"until"`
+	BusyPercent          float64     `json:"busy_percent"`
+	Reservations         int         `json:"reservations"`
+	AverageLengthMinutes float64     `json:"average_length_minutes"`
+	Extensions           int         `json:"extensions"`
+	TopUsers             []UserStats `json:"top_users"`
+	PeakHours            []int       `json:"peak_hours"`
+	BusyMinutesByHour    [24]float64 `json:"busy_minutes_by_hour"`
+}
+
+// How long a user held a resource for
+type UserStats struct {
+	User    string  `json:"user"`
+	UserId  string  `json:"user_id,omitempty"`
+	Minutes float64 `json:"minutes"`
+}
+
+// A reservation pieced together from the history. Each entry in `holders`
+// took it over at `StartAt`, which is how reassignments are tracked.
+type statsBooking struct {
+	StartAt time.Time
+	EndAt   time.Time
+	holders []statsHolder
+}
+
+type statsHolder struct {
+	StartAt time.Time
+	User    UserIdentity
+}
+
+// Resources with several slots can have more than one reservation starting
+// at the same time, so they're told apart by who holds them too
+type statsBookingKey struct {
+	StartAt int64
+	Holder  string
+}
+
+func newStatsBookingKey(start_at time.Time, id string, name string) statsBookingKey {
+
+	if id == "" {
+		id = name
+	}
+
+	return statsBookingKey{StartAt: start_at.UnixNano(), Holder: id}
+
+}
+
+// Replays the resource's history to work out how it was used between `since`
+// and `until`. Reservations that began before `since` count for the time
+// they overlap with it, but only those that began after it count towards the
+// number of reservations and their average length. Busy time is divided
+// between the resource's `slots`.
+func computeResourceStats(
+	resource string,
+	slots int,
+	events []HistoryEvent,
+	since time.Time,
+	until time.Time) ResourceStats {
+
+	stats := ResourceStats{
+		Resource:  resource,
+		Since:     since,
+		Until:     until,
+		TopUsers:  []UserStats{},
+		PeakHours: []int{},
+	}
+
+	bookings := []*statsBooking{}
+	open := map[statsBookingKey]*statsBooking{}
+
+	for _, event := range events {
+		key := newStatsBookingKey(event.StartAt, event.HolderId, event.Holder)
+		booking, ok := open[key]
+
+		switch event.Action {
+
+		case HISTORY_RESERVE, HISTORY_PROMOTE:
+			booking = &statsBooking{
+				StartAt: event.StartAt,
+				EndAt:   event.NewEndAt,
+				holders: []statsHolder{{
+					StartAt: event.StartAt,
+					User:    UserIdentity{Id: event.HolderId, Name: event.Holder},
+				}},
+			}
+			bookings = append(bookings, booking)
+			open[key] = booking
+
+		case HISTORY_EXTEND:
+			if ok {
+				booking.EndAt = event.NewEndAt
+			}
+			if !event.At.Before(since) && event.At.Before(until) {
+				stats.Extensions++
+			}
+
+		case HISTORY_CANCEL, HISTORY_FORCE_CANCEL:
+			if ok && event.At.Before(booking.EndAt) {
+				booking.EndAt = latestTime(event.At, booking.StartAt)
+			}
+			delete(open, key)
+
+		case HISTORY_REASSIGN, HISTORY_TRANSFER:
+			if ok {
+				booking.holders = append(booking.holders, statsHolder{
+					StartAt: event.At,
+					User:    UserIdentity{Id: event.NewHolderId, Name: event.NewHolder},
+				})
+				delete(open, key)
+				open[newStatsBookingKey(event.StartAt, event.NewHolderId, event.NewHolder)] = booking
+			}
+
+		case HISTORY_EXPIRE:
+			delete(open, key)
+
+		}
+	}
+
+	var busy time.Duration
+	var total_length time.Duration
+	users := map[string]*UserStats{}
+	var busy_by_hour [24]time.Duration
+
+	for _, booking := range bookings {
+		// Cancelled before it began
+		if !booking.EndAt.After(booking.StartAt) {
+			continue
+		}
+
+		if !booking.StartAt.Before(since) && booking.StartAt.Before(until) {
+			stats.Reservations++
+			total_length += booking.EndAt.Sub(booking.StartAt)
+		}
+
+		for i, holder := range booking.holders {
+			end_at := booking.EndAt
+			if i+1 < len(booking.holders) {
+				end_at = booking.holders[i+1].StartAt
+			}
+
+			start_at := latestTime(holder.StartAt, since)
+			end_at = earliestTime(end_at, until)
+			if !end_at.After(start_at) {
+				continue
+			}
+
+			busy += end_at.Sub(start_at)
+			addBusyHours(&busy_by_hour, start_at, end_at)
+
+			key := holder.User.Id
+			if key == "" {
+				key = holder.User.Name
+			}
+			if users[key] == nil {
+				users[key] = &UserStats{User: holder.User.Name, UserId: holder.User.Id}
+			}
+			users[key].Minutes += end_at.Sub(start_at).Minutes()
+		}
+	}
+
+	if slots < 1 {
+		slots = 1
+	}
+
+	if window := until.Sub(since); window > 0 {
+		stats.BusyPercent = 100 * float64(busy) / float64(window) / float64(slots)
+	}
+	if stats.Reservations > 0 {
+		stats.AverageLengthMinutes = (total_length / time.Duration(stats.Reservations)).Minutes()
+	}
+
+	for _, user := range users {
+		stats.TopUsers = append(stats.TopUsers, *user)
+	}
+	sort.SliceStable(stats.TopUsers, func(i, j int) bool {
+		if stats.TopUsers[i].Minutes != stats.TopUsers[j].Minutes {
+			return stats.TopUsers[i].Minutes > stats.TopUsers[j].Minutes
+		}
+		return stats.TopUsers[i].User < stats.TopUsers[j].User
+	})
+	if len(stats.TopUsers) > max_stats_top {
+		stats.TopUsers = stats.TopUsers[:max_stats_top]
+	}
+
+	for hour, duration := range busy_by_hour {
+		stats.BusyMinutesByHour[hour] = duration.Minutes() / float64(slots)
+		if duration > 0 {
+			stats.PeakHours = append(stats.PeakHours, hour)
+		}
+	}
+	sort.SliceStable(stats.PeakHours, func(i, j int) bool {
+		return busy_by_hour[stats.PeakHours[i]] > busy_by_hour[stats.PeakHours[j]]
+	})
+	if len(stats.PeakHours) > max_stats_top {
+		stats.PeakHours = stats.PeakHours[:max_stats_top]
+	}
+
+	return stats
+
+}
+
+// Adds the time between `start_at` and `end_at` to the hours of the day it
+// falls in
+func addBusyHours(busy_by_hour *[24]time.Duration, start_at time.Time, end_at time.Time) {
+
+	t := start_at.Local()
+	for t.Before(end_at) {
+		next := time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		busy_by_hour[t.Hour()] += earliestTime(next, end_at).Sub(t)
+		t = next
+	}
+
+}
+
+// Works out the stats for each resource from the store's history
+func resourceStats(resources []string, since time.Time, until time.Time) ([]ResourceStats, error) {
+
+	all_stats := []ResourceStats{}
+
+	// Reservations that began before `since` still count for the time they
+	// overlap with it, so read the whole history
+	history, err := historyByResource(time.Time{})
+	if err != nil {
+		return nil, err
+	}
+
+	config := currentResourceConfig()
+
+	for _, resource := range resources {
+		// Resources no longer configured are taken to have had one slot
+		r, _ := config.Find(resource)
+		all_stats = append(all_stats, computeResourceStats(resource, r.Slots(), history[resource], since, until))
+	}
+
+	return all_stats, nil
+
+}
+
+func (s ResourceStats) ToString() string {
+
+	window := historyWindowToString(s.Until.Sub(s.Since))
+
+	if s.Reservations == 0 && s.BusyPercent == 0 {
+		return fmt.Sprintf("*%v* - not reserved at all in the last %v", s.Resource, window)
+	}
+
+	var r Reservation
+	lines := []string{
+		fmt.Sprintf("*%v* - busy *%.0f%%* of the last %v", s.Resource, s.BusyPercent, window),
+		fmt.Sprintf(
+			"• %v, averaging *%v*",
+			r.formatDuration(float64(s.Reservations), "reservation"),
+			formatConfigDuration(minutesToDuration(s.AverageLengthMinutes))),
+		"• " + r.formatDuration(float64(s.Extensions), "extension"),
+	}
+
+	users := []string{}
+	for _, user := range s.TopUsers {
+		users = append(users, fmt.Sprintf(
+			"%v (%v)",
+			UserIdentity{Id: user.UserId, Name: user.User}.Mention(),
+			formatConfigDuration(minutesToDuration(user.Minutes))))
+	}
+	lines = append(lines, "• Top users: "+strings.Join(users, ", "))
+
+	hours := []string{}
+	for _, hour := range s.PeakHours {
+		hours = append(hours, time.Date(2000, 1, 1, hour, 0, 0, 0, time.Local).Format("3pm"))
+	}
+	lines = append(lines, "• Busiest hours: "+strings.Join(hours, ", "))
+
+	return strings.Join(lines, "\n")
+
+}
+
+/*
+Run this locally with:
+
+	curl -XPOST \
+	     -H "Content-Type: application/json" \
+	     -d @example/stats \
+	     http://localhost:8080/slack/commands/reservations
+*/
+func handleCommandStats(slack_request SlackRequest, args CommandArgs) (SlackResponse, bool) {
+
+	response := SlackResponse{}
+
+	// Extract data from command
+	window := default_stats_window
+	if args["time"] != "" {
+		var err error
+		window, err = parseDurationText(args["time"])
+		if err != nil {
+			response.Text = err.Error()
+			return response, true
+		}
+	}
+
+	resources := ListOfResources()
+	if resource := args["resource"]; resource != "" {
+		if !IsValidResource(resource) {
+			response.Text = unknownResourceText(resource)
+			return response, true
+		}
+		resources = []string{resource}
+	}
+
+	until := time.Now()
+	all_stats, err := resourceStats(resources, until.Add(-window), until)
+	if err != nil {
+		log.Error(err)
+		return response, false
+	}
+
+	sections := []string{}
+	for _, stats := range all_stats {
+		sections = append(sections, stats.ToString())
+	}
+
+	response.Text = strings.Join(sections, "\n\n")
+
+	return response, true
+
+}
+
+/*
+Serves stats as JSON for dashboards. Takes optional `resource` and `days`
+query parameters, defaulting to every resource over the last 30 days.
+
+Run this locally with:
+
+	curl -H "Authorization: Bearer $STATS_API_TOKEN" \
+	     "http://localhost:8080/api/stats?resource=staging&days=7"
+*/
+func StatsHandler(w http.ResponseWriter, r *http.Request) {
+
+	err := store.Load()
+	if err != nil {
+		log.Error(err)
+		http.Error(w, "Could not load reservations", http.StatusInternalServerError)
+		return
+	}
+
+	window := default_stats_window
+	if days := r.URL.Query().Get("days"); days != "" {
+		value, err := strconv.Atoi(days)
+		if err != nil || value <= 0 {
+			http.Error(w, "days must be a positive number", http.StatusBadRequest)
+			return
+		}
+		window = time.Duration(value) * 24 * time.Hour
+	}
+
+	resources := ListOfResources()
+	if resource := r.URL.Query().Get("resource"); resource != "" {
+		if !IsValidResource(resource) {
+			http.Error(w, "Unknown resource", http.StatusNotFound)
+			return
+		}
+		resources = []string{resource}
+	}
+
+	until := time.Now()
+	all_stats, err := resourceStats(resources, until.Add(-window), until)
+	if err != nil {
+		log.Error(err)
+		http.Error(w, "Could not read history", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+
+	err = json.NewEncoder(w).Encode(map[string]interface{}{"resources": all_stats})
+	if err != nil {
+		log.Error(err)
+	}
+
+}
+
+func minutesToDuration(minutes float64) time.Duration {
+
+	return (time.Duration(minutes * float64(time.Minute))).Round(time.Minute)
+
+}
+
+func earliestTime(a time.Time, b time.Time) time.Time {
+
+	if a.Before(b) {
+		return a
+	}
+
+	return b
+
+}
+
+func latestTime(a time.Time, b time.Time) time.Time {
+
+	if a.After(b) {
+		return a
+	}
+
+	return b
+
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestComputeResourceStats(t *testing.T) {
+
+	since := time.Date(2017, 8, 14, 0, 0, 0, 0, time.Local)
+	until := since.Add(10 * time.Hour)
+	at := func(hour int, minute int) time.Time {
+		return since.Add(time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute)
+	}
+
+	events := []HistoryEvent{
+		// Began before the window, so only counts for the hour it overlaps
+		{At: at(-2, 0), Action: HISTORY_RESERVE, Resource: "staging",
+			Holder: "carol", HolderId: "UCAROL", StartAt: at(-2, 0), NewEndAt: at(1, 0)},
+		{At: at(1, 0), Action: HISTORY_EXPIRE, Resource: "staging",
+			Holder: "carol", HolderId: "UCAROL", StartAt: at(-2, 0), OldEndAt: at(1, 0)},
+
+		// 2 hours, extended by 1 and reassigned half way through
+		{At: at(2, 0), Action: HISTORY_RESERVE, Resource: "staging",
+			Holder: "alice", HolderId: "UALICE", StartAt: at(2, 0), NewEndAt: at(4, 0)},
+		{At: at(3, 0), Action: HISTORY_EXTEND, Resource: "staging",
+			Holder: "alice", HolderId: "UALICE", StartAt: at(2, 0), OldEndAt: at(4, 0), NewEndAt: at(5, 0)},
+		{At: at(3, 30), Action: HISTORY_REASSIGN, Resource: "staging",
+			Holder: "alice", HolderId: "UALICE", NewHolder: "bob", NewHolderId: "UBOB",
+			StartAt: at(2, 0), OldEndAt: at(5, 0), NewEndAt: at(5, 0)},
+
+		// Cancelled after half an hour
+		{At: at(6, 0), Action: HISTORY_PROMOTE, Resource: "staging",
+			Holder: "alice", HolderId: "UALICE", StartAt: at(6, 0), NewEndAt: at(7, 0)},
+		{At: at(6, 30), Action: HISTORY_CANCEL, Resource: "staging",
+			Holder: "alice", HolderId: "UALICE", StartAt: at(6, 0), OldEndAt: at(7, 0)},
+
+		// Cancelled before it began
+		{At: at(7, 0), Action: HISTORY_RESERVE, Resource: "staging",
+			Holder: "dave", HolderId: "UDAVE", StartAt: at(8, 0), NewEndAt: at(9, 0)},
+		{At: at(7, 30), Action: HISTORY_FORCE_CANCEL, Resource: "staging",
+			Holder: "dave", HolderId: "UDAVE", StartAt: at(8, 0), OldEndAt: at(9, 0)},
+	}
+
+	stats := computeResourceStats("staging", 1, events, since, until)
+
+	// 1 + 3 + 0.5 hours of 10
+	if stats.BusyPercent != 45 {
+		t.Error("expected", 45, "got", stats.BusyPercent)
+	}
+
+	if stats.Reservations != 2 {
+		t.Error("expected", 2, "got", stats.Reservations)
+	}
+
+	// (3 hours + 30 minutes) / 2
+	if stats.AverageLengthMinutes != 105 {
+		t.Error("expected", 105, "got", stats.AverageLengthMinutes)
+	}
+
+	if stats.Extensions != 1 {
+		t.Error("expected", 1, "got", stats.Extensions)
+	}
+
+	expected_users := []UserStats{
+		{User: "alice", UserId: "UALICE", Minutes: 120},
+		{User: "bob", UserId: "UBOB", Minutes: 90},
+		{User: "carol", UserId: "UCAROL", Minutes: 60},
+	}
+	if len(stats.TopUsers) != len(expected_users) {
+		t.Fatal("expected", expected_users, "got", stats.TopUsers)
+	}
+	for i, expected := range expected_users {
+		if stats.TopUsers[i] != expected {
+			t.Error("expected", expected, "got", stats.TopUsers[i])
+		}
+	}
+
+	// Hours 0, 2, 3 and 4 were busy the whole hour, 6 for half of it
+	if len(stats.PeakHours) != 3 || stats.PeakHours[0] != 0 || stats.PeakHours[2] != 3 {
+		t.Error("expected", []int{0, 2, 3}, "got", stats.PeakHours)
+	}
+	if stats.BusyMinutesByHour[6] != 30 {
+		t.Error("expected", 30, "got", stats.BusyMinutesByHour[6])
+	}
+
+}
+
+func TestComputeResourceStatsWithSlots(t *testing.T) {
+
+	since := time.Date(2017, 8, 14, 0, 0, 0, 0, time.Local)
+	until := since.Add(10 * time.Hour)
+	at := func(hour int, minute int) time.Time {
+		return since.Add(time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute)
+	}
+
+	// All three slots taken for the first hour, and one of them handed on
+	// half way through
+	events := []HistoryEvent{
+		{At: at(0, 0), Action: HISTORY_RESERVE, Resource: "load-test",
+			Holder: "alice", HolderId: "UALICE", StartAt: at(0, 0), NewEndAt: at(1, 0)},
+		{At: at(0, 0), Action: HISTORY_RESERVE, Resource: "load-test",
+			Holder: "bob", HolderId: "UBOB", StartAt: at(0, 0), NewEndAt: at(1, 0)},
+		{At: at(0, 0), Action: HISTORY_RESERVE, Resource: "load-test",
+			Holder: "carol", HolderId: "UCAROL", StartAt: at(0, 0), NewEndAt: at(2, 0)},
+		{At: at(0, 30), Action: HISTORY_TRANSFER, Resource: "load-test",
+			Holder: "bob", HolderId: "UBOB", NewHolder: "dave", NewHolderId: "UDAVE",
+			StartAt: at(0, 0), OldEndAt: at(1, 0), NewEndAt: at(1, 0)},
+		{At: at(1, 0), Action: HISTORY_CANCEL, Resource: "load-test",
+			Holder: "carol", HolderId: "UCAROL", StartAt: at(0, 0), OldEndAt: at(2, 0)},
+	}
+
+	stats := computeResourceStats("load-test", 3, events, since, until)
+
+	// 3 slot-hours of 30
+	if stats.BusyPercent != 10 {
+		t.Error("expected", 10, "got", stats.BusyPercent)
+	}
+
+	if stats.Reservations != 3 {
+		t.Error("expected", 3, "got", stats.Reservations)
+	}
+
+	if stats.BusyMinutesByHour[0] != 60 {
+		t.Error("expected", 60, "got", stats.BusyMinutesByHour[0])
+	}
+	if stats.BusyMinutesByHour[1] != 0 {
+		t.Error("expected", 0, "got", stats.BusyMinutesByHour[1])
+	}
+
+	expected_users := []UserStats{
+		{User: "alice", UserId: "UALICE", Minutes: 60},
+		{User: "carol", UserId: "UCAROL", Minutes: 60},
+		{User: "bob", UserId: "UBOB", Minutes: 30},
+	}
+	if len(stats.TopUsers) != len(expected_users) {
+		t.Fatal("expected", expected_users, "got", stats.TopUsers)
+	}
+	for i, expected := range expected_users {
+		if stats.TopUsers[i] != expected {
+			t.Error("expected", expected, "got", stats.TopUsers[i])
+		}
+	}
+
+}
+
+func TestHandleCommandStats(t *testing.T) {
+
+	//
+	// Setup
+	//
+
+	defer useResources("production, staging")()
+
+	defer useTempStore()()
+
+	handleRequest(handleCommandCreate, newTestSlackRequest("alice", "reserve staging for 2 hours"))
+	handleRequest(handleCommandUpdate, newTestSlackRequest("alice", "extend staging by 1 hour"))
+
+	//
+	// Test
+	//
+
+	t.Run("AllResources", func(t *testing.T) {
+
+		actual := runCommand(t, handleCommandStats, "bob", "stats")
+		expectMatch(t, actual, "\\*production\\* - not reserved at all in the last 30 days")
+		expectMatch(t, actual, "\\*staging\\* - busy \\*0%\\* of the last 30 days")
+
+	})
+
+	t.Run("Resource", func(t *testing.T) {
+
+		actual := runCommand(t, handleCommandStats, "bob", "stats staging last 2 days")
+		expectMatch(t, actual, "\\A\\*staging\\* - busy \\*0%\\* of the last 2 days\n")
+		expectMatch(t, actual, "1 reservation, averaging \\*3 hours\\*")
+		expectMatch(t, actual, "1 extension\n")
+		expectMatch(t, actual, "Top users: <@Ualice> \\(0 minutes\\)")
+
+	})
+
+	t.Run("InvalidResource", func(t *testing.T) {
+
+		expectMatch(t, runCommand(t, handleCommandStats, "bob", "stats foo"), "foo")
+
+	})
+
+}
+
+func TestStatsHandler(t *testing.T) {
+
+	//
+	// Setup
+	//
+
+	defer useResources("production, staging")()
+
+	defer useTempStore()()
+
+	old_env := os.Getenv("STATS_API_TOKEN")
+	defer os.Setenv("STATS_API_TOKEN", old_env)
+
+	handleRequest(handleCommandCreate, newTestSlackRequest("alice", "reserve staging for 2 hours"))
+
+	get := func(url string, token string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest("GET", url, nil)
+		if token != "" {
+			request.Header.Set("Authorization", "Bearer "+token)
+		}
+		recorder := httptest.NewRecorder()
+		NewRouter().ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	//
+	// Test
+	//
+
+	t.Run("Disabled", func(t *testing.T) {
+
+		os.Setenv("STATS_API_TOKEN", "")
+		if code := get("/api/stats", "").Code; code != http.StatusNotFound {
+			t.Error("expected", http.StatusNotFound, "got", code)
+		}
+
+	})
+
+	os.Setenv("STATS_API_TOKEN", "secret")
+
+	t.Run("InvalidToken", func(t *testing.T) {
+
+		if code := get("/api/stats", "wrong").Code; code != http.StatusUnauthorized {
+			t.Error("expected", http.StatusUnauthorized, "got", code)
+		}
+
+	})
+
+	t.Run("Success", func(t *testing.T) {
+
+		recorder := get("/api/stats?resource=staging&days=7", "secret")
+		if recorder.Code != http.StatusOK {
+			t.Fatal("expected", http.StatusOK, "got", recorder.Code)
+		}
+
+		var body struct {
+			Resources []ResourceStats `json:"resources"`
+		}
+		json.NewDecoder(recorder.Body).Decode(&body)
+
+		if len(body.Resources) != 1 ||
+			body.Resources[0].Resource != "staging" ||
+			body.Resources[0].Reservations != 1 ||
+			body.Resources[0].AverageLengthMinutes != 120 {
+			t.Error("expected a single reservation of staging, got", body.Resources)
+		}
+
+		if window := body.Resources[0].Until.Sub(body.Resources[0].Since); window != 7*24*time.Hour {
+			t.Error("expected", 7*24*time.Hour, "got", window)
+		}
+
+	})
+
+	t.Run("BadRequest", func(t *testing.T) {
+
+		if code := get("/api/stats?days=x", "secret").Code; code != http.StatusBadRequest {
+			t.Error("expected", http.StatusBadRequest, "got", code)
+		}
+
+		if code := get("/api/stats?resource=foo", "secret").Code; code != http.StatusNotFound {
+			t.Error("expected", http.StatusNotFound, "got", code)
+		}
+
+	})
+
+}
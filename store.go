@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	STORE_TYPE_FILE = "file"
+	STORE_TYPE_BOLT = "bolt"
+)
+
+// Returned from within `ReservationStore.Update()` to discard any changes
+// without reporting an error to the caller
+var ErrRollback = errors.New("Rollback")
+
+// The store used by all command handlers. Set at startup by
+// `configureStore()` based on the `RESERVATIONS_STORE` and
+// `RESERVATIONS_DIR` environment variables.
+var store ReservationStore
+
+type ReservationStore interface {
+
+	// Prepares the underlying storage (creating files, buckets, etc...) so
+	// that it's ready to read and write reservations. Safe to call more than
+	// once.
+	Load() error
+
+	// Returns the reservation currently in effect on the given resource, or
+	// the zero value `Reservation{}` if it's free
+	Get(resource string) (Reservation, error)
+
+	// Adds the reservation to the given resource's schedule, or replaces an
+	// earlier version of the same booking
+	Upsert(resource string, reservation Reservation) error
+
+	// Removes the booking from the given resource's schedule, if present
+	Delete(resource string, reservation Reservation) error
+
+	// Returns all reservations, keyed by resource
+	List() (Reservations, error)
+
+	// Runs `fn` against the current set of reservations while holding an
+	// exclusive lock on the store. Any changes `fn` makes to the transaction
+	// are saved when it returns without error, and discarded otherwise. If
+	// `fn` returns `ErrRollback` the changes are discarded and `Update()`
+	// returns nil.
+	Update(fn func(tx *StoreTx) error) error
+
+	// Returns the events recorded against the given resource (or every
+	// resource, if it's empty) at or after `since`, oldest first
+	History(resource string, since time.Time) ([]HistoryEvent, error)
+}
+
+// StoreTx is the working set of data handed to `ReservationStore.Update()`.
+// `CatalogSource` is the resources file the catalog was last synced with
+// (see `syncCatalogSource()`). `Events` are added to the history when the
+// transaction is saved (see `Record()`).
+type StoreTx struct {
+	Reservations  Reservations
+	Waitlists     Waitlists
+	Catalog       ResourceConfig
+	CatalogSource ResourceConfig
+	Events        []HistoryEvent
+}
+
+func configureStore() {
+
+	dir := os.Getenv("RESERVATIONS_DIR")
+	if dir != "" {
+		reservations_dir = dir
+		reservations_file = filepath.Join(reservations_dir, "reservations.json")
+		waitlists_file = filepath.Join(reservations_dir, "waitlists.json")
+		catalog_file = filepath.Join(reservations_dir, "catalog.json")
+		history_file = filepath.Join(reservations_dir, "history.jsonl")
+		reservations_db = filepath.Join(reservations_dir, "reservations.db")
+	}
+
+	store = NewReservationStore(storeType())
+
+}
+
+func NewReservationStore(store_type string) ReservationStore {
+
+	switch store_type {
+	case STORE_TYPE_BOLT:
+		return &BoltStore{Path: reservations_db}
+	default:
+		return &FileStore{}
+	}
+
+}
+
+func storeType() string {
+
+	store_type := os.Getenv("RESERVATIONS_STORE")
+	if store_type == "" {
+		return STORE_TYPE_FILE
+	}
+
+	return store_type
+
+}
+
+func isValidStoreType(store_type string) bool {
+
+	return store_type == STORE_TYPE_FILE || store_type == STORE_TYPE_BOLT
+
+}
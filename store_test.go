@@ -0,0 +1,275 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestReservationStores(t *testing.T) {
+
+	//
+	// Setup
+	//
+
+	dir, cleanup := useTempStoreDir()
+	defer cleanup()
+
+	bolt_store := &BoltStore{Path: filepath.Join(dir, "reservations.db")}
+	defer bolt_store.Close()
+
+	stores := map[string]ReservationStore{
+		"FileStore": &FileStore{},
+		"BoltStore": bolt_store,
+	}
+
+	for name, s := range stores {
+
+		t.Run(name, func(t *testing.T) {
+
+			// Each store starts from the configured resources, rather than
+			// the catalog saved by the one before
+			defer useResources("production, staging")()
+
+			err := s.Load()
+			if err != nil {
+				t.Fatal("Error while calling Load():", err)
+			}
+
+			// Calling Load() again should be harmless
+			err = s.Load()
+			if err != nil {
+				t.Fatal("Error while calling Load() twice:", err)
+			}
+
+			r1 := Reservation{
+				User: "abc", EndAt: time.Now().AddDate(0, 0, 1)}
+			r2 := Reservation{
+				User: "def", EndAt: time.Now().AddDate(0, 0, 2)}
+
+			// Upsert
+
+			if err := s.Upsert("production", r1); err != nil {
+				t.Error("Expected no error, got", err)
+			}
+			if err := s.Upsert("staging", r2); err != nil {
+				t.Error("Expected no error, got", err)
+			}
+
+			err = s.Upsert("foo", r1)
+			if err == nil ||
+				!regexp.MustCompile("Invalid Resource").MatchString(err.Error()) {
+				t.Error("expect error message /Invalid Resource/, got", err)
+			}
+
+			// Get
+
+			actual, err := s.Get("production")
+			if err != nil {
+				t.Error("Expected no error, got", err)
+			}
+			if !actual.EndAt.Equal(r1.EndAt) || actual.User != r1.User {
+				t.Error("expected", r1, "got", actual)
+			}
+
+			actual, err = s.Get("foo")
+			if err != nil {
+				t.Error("Expected no error, got", err)
+			}
+			if actual.IsPresent() {
+				t.Error("expected", Reservation{}, "got", actual)
+			}
+
+			// List
+
+			reservations, err := s.List()
+			if err != nil {
+				t.Error("Expected no error, got", err)
+			}
+			if len(reservations) != 2 {
+				t.Error("expected length", 2, "got length", len(reservations))
+			}
+			if actual := reservations.FindByResource("staging"); actual.User != r2.User {
+				t.Error("expected", r2, "got", actual)
+			}
+
+			// Delete
+
+			if err := s.Delete("production", r1); err != nil {
+				t.Error("Expected no error, got", err)
+			}
+
+			actual, err = s.Get("production")
+			if err != nil {
+				t.Error("Expected no error, got", err)
+			}
+			if actual.IsPresent() {
+				t.Error("expected", Reservation{}, "got", actual)
+			}
+
+			// Catalog
+
+			err = s.Update(func(tx *StoreTx) error {
+				tx.Catalog = ResourceConfig{Resources: []Resource{
+					{Name: "production", MaxDuration: ConfigDuration(time.Hour)},
+				}}
+				return nil
+			})
+			if err != nil {
+				t.Error("Expected no error, got", err)
+			}
+
+			s.Update(func(tx *StoreTx) error {
+				resource, _ := tx.Catalog.Find("production")
+				if time.Duration(resource.MaxDuration) != time.Hour {
+					t.Error("expected", time.Hour, "got", time.Duration(resource.MaxDuration))
+				}
+				return ErrRollback
+			})
+
+		})
+
+	}
+
+}
+
+func TestNewReservationStore(t *testing.T) {
+
+	if _, ok := NewReservationStore(STORE_TYPE_FILE).(*FileStore); !ok {
+		t.Error("expected a *FileStore for", STORE_TYPE_FILE)
+	}
+
+	if _, ok := NewReservationStore(STORE_TYPE_BOLT).(*BoltStore); !ok {
+		t.Error("expected a *BoltStore for", STORE_TYPE_BOLT)
+	}
+
+}
+
+func TestFileStoreUpdate(t *testing.T) {
+
+	//
+	// Setup
+	//
+
+	defer useResources("production, staging")()
+
+	_, cleanup := useTempStoreDir()
+	defer cleanup()
+
+	fs := &FileStore{}
+	if err := fs.Load(); err != nil {
+		t.Fatal("Error while calling Load():", err)
+	}
+
+	r1 := Reservation{User: "abc", EndAt: time.Now().AddDate(0, 0, 1)}
+
+	t.Run("Rollback", func(t *testing.T) {
+
+		err := fs.Update(func(tx *StoreTx) error {
+			tx.Reservations.Upsert("production", r1)
+			return ErrRollback
+		})
+		if err != nil {
+			t.Error("Expected no error, got", err)
+		}
+
+		actual, _ := fs.Get("production")
+		if actual.IsPresent() {
+			t.Error("expected", Reservation{}, "got", actual)
+		}
+
+	})
+
+	t.Run("WaitsForFileLock", func(t *testing.T) {
+
+		// Simulate another process holding the lock
+		unlock, err := lockReservationsFile(syscall.LOCK_EX)
+		if err != nil {
+			t.Fatal("Error while locking file:", err)
+		}
+
+		done := make(chan error)
+		go func() {
+			done <- fs.Upsert("production", r1)
+		}()
+
+		select {
+		case <-done:
+			t.Fatal("expected Upsert() to wait for the file lock")
+		case <-time.After(100 * time.Millisecond):
+		}
+
+		unlock()
+
+		if err := <-done; err != nil {
+			t.Error("Expected no error, got", err)
+		}
+
+		actual, _ := fs.Get("production")
+		if actual.User != r1.User {
+			t.Error("expected", r1, "got", actual)
+		}
+
+	})
+
+	t.Run("HistoryNotWritten", func(t *testing.T) {
+
+		// A directory can't be appended to
+		old_history_file := history_file
+		defer func() { history_file = old_history_file }()
+		history_file = t.TempDir()
+
+		r2 := Reservation{User: "def", EndAt: time.Now().AddDate(0, 0, 1)}
+		err := fs.Update(func(tx *StoreTx) error {
+			tx.Record(HistoryEvent{Action: HISTORY_RESERVE, Resource: "staging"})
+			return tx.Reservations.Upsert("staging", r2)
+		})
+		if err != nil {
+			t.Error("Expected no error, got", err)
+		}
+
+		actual, _ := fs.Get("staging")
+		if actual.User != r2.User {
+			t.Error("expected", r2, "got", actual)
+		}
+
+	})
+
+}
+
+// Points the store files at a fresh temp directory. The returned function
+// removes it and restores the previous paths.
+func useTempStoreDir() (string, func()) {
+
+	dir, err := ioutil.TempDir("", "reservations")
+	if err != nil {
+		panic(err)
+	}
+
+	old_reservations_file := reservations_file
+	old_waitlists_file := waitlists_file
+	old_catalog_file := catalog_file
+	old_history_file := history_file
+
+	// Loading a store with a catalog replaces the resources in use
+	old_resource_config := currentResourceConfig()
+
+	reservations_file = filepath.Join(dir, "reservations.json")
+	waitlists_file = filepath.Join(dir, "waitlists.json")
+	catalog_file = filepath.Join(dir, "catalog.json")
+	history_file = filepath.Join(dir, "history.jsonl")
+
+	return dir, func() {
+		reservations_file = old_reservations_file
+		waitlists_file = old_waitlists_file
+		catalog_file = old_catalog_file
+		history_file = old_history_file
+		setResourceConfig(old_resource_config)
+		os.RemoveAll(dir)
+	}
+
+}
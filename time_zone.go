@@ -0,0 +1,98 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// How long a user's time zone is remembered for, so that every command
+// doesn't have to look it up
+var user_time_zone_cache_ttl = 24 * time.Hour
+
+// How long to wait before trying again when a user's time zone couldn't be
+// looked up
+var user_time_zone_failure_ttl = 5 * time.Minute
+
+var user_time_zone_cache = struct {
+	sync.Mutex
+	zones map[string]cachedTimeZone
+}{zones: map[string]cachedTimeZone{}}
+
+type cachedTimeZone struct {
+	Location  *time.Location
+	FetchedAt time.Time
+	Failed    bool
+}
+
+func (c cachedTimeZone) IsFresh() bool {
+
+	ttl := user_time_zone_cache_ttl
+	if c.Failed {
+		ttl = user_time_zone_failure_ttl
+	}
+
+	return time.Since(c.FetchedAt) < ttl
+
+}
+
+// Returns the time zone set in the user's Slack profile, so that times they
+// type are read the way they meant them. Falls back to the server's time
+// zone if it can't be looked up.
+func userLocation(user_id string) *time.Location {
+
+	if slack_client == nil || user_id == "" {
+		return time.Local
+	}
+
+	user_time_zone_cache.Lock()
+	cached, ok := user_time_zone_cache.zones[user_id]
+	user_time_zone_cache.Unlock()
+
+	if ok && cached.IsFresh() {
+		return cached.Location
+	}
+
+	// Not holding the lock while Slack answers, so other users aren't held up
+	cached = fetchTimeZone(user_id)
+
+	user_time_zone_cache.Lock()
+	user_time_zone_cache.zones[user_id] = cached
+	user_time_zone_cache.Unlock()
+
+	return cached.Location
+
+}
+
+// Looks up the user's time zone in Slack. Failures fall back to the
+// server's time zone, and are remembered for a shorter time.
+func fetchTimeZone(user_id string) cachedTimeZone {
+
+	cached := cachedTimeZone{Location: time.Local, FetchedAt: time.Now()}
+
+	user, err := slack_client.UserInfo(user_id)
+	if err != nil {
+		log.Error(err)
+		cached.Failed = true
+		return cached
+	}
+
+	if user.Tz != "" {
+		location, err := time.LoadLocation(user.Tz)
+		if err != nil {
+			log.Warningf("Unknown time zone %q for %v: %v", user.Tz, user_id, err)
+			return cached
+		}
+		cached.Location = location
+	}
+
+	return cached
+
+}
+
+// Shows when a reservation ends. Slack shows it in the reader's own time zone,
+// and falls back to `location` for clients that can't.
+func endTimeText(end_at time.Time, location *time.Location) string {
+
+	return slackDate(end_at.In(location), "{date_short_pretty} {time}", reservation_time_layout)
+
+}
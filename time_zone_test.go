@@ -0,0 +1,57 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUserLocation(t *testing.T) {
+
+	api, cleanup := useFakeSlackApi()
+	defer cleanup()
+	defer func() { user_time_zone_cache.zones = map[string]cachedTimeZone{} }()
+
+	api.users = []SlackUser{
+		{Id: "UALICE", Name: "alice", Tz: "America/New_York"},
+		{Id: "UBOB", Name: "bob", Tz: "Nowhere/Special"},
+		{Id: "UCAROL", Name: "carol"},
+	}
+
+	test_cases := map[string]string{
+		"UALICE": "America/New_York",
+		"UBOB":   time.Local.String(),
+		"UCAROL": time.Local.String(),
+		"UDAVE":  time.Local.String(),
+	}
+
+	for user_id, expected := range test_cases {
+		if actual := userLocation(user_id).String(); actual != expected {
+			t.Error(user_id, ": expected", expected, "got", actual)
+		}
+	}
+
+	// Time zones are cached for a while
+	api.users[0].Tz = "Europe/London"
+	if actual := userLocation("UALICE").String(); actual != "America/New_York" {
+		t.Error("expected", "America/New_York", "got", actual)
+	}
+
+	user_time_zone_cache.zones["UALICE"] = cachedTimeZone{}
+	if actual := userLocation("UALICE").String(); actual != "Europe/London" {
+		t.Error("expected", "Europe/London", "got", actual)
+	}
+
+	// Failed lookups are only cached briefly
+	api.users = append(api.users, SlackUser{Id: "UDAVE", Name: "dave", Tz: "Asia/Tokyo"})
+	if actual := userLocation("UDAVE").String(); actual != time.Local.String() {
+		t.Error("expected", time.Local.String(), "got", actual)
+	}
+
+	cached := user_time_zone_cache.zones["UDAVE"]
+	cached.FetchedAt = time.Now().Add(-user_time_zone_failure_ttl)
+	user_time_zone_cache.zones["UDAVE"] = cached
+	if actual := userLocation("UDAVE").String(); actual != "Asia/Tokyo" {
+		t.Error("expected", "Asia/Tokyo", "got", actual)
+	}
+
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+)
+
+/*
+Hands the user's own reservation in effect on a resource over to someone
+else, e.g. a teammate taking over a deploy. It keeps the same end time, and
+since it happens in one go nobody else can grab the resource in between.
+
+Run this locally with:
+
+	curl -XPOST \
+	     -H "Content-Type: application/json" \
+	     -d @example/transfer \
+	     http://localhost:8080/slack/commands/reservations
+*/
+func handleCommandTransfer(slack_request SlackRequest, args CommandArgs) (SlackResponse, bool) {
+
+	response := SlackResponse{}
+
+	// Extract data from command
+	resource := args["resource"]
+	target := args["user"]
+
+	if !IsValidResource(resource) {
+		response.Text = unknownResourceText(resource)
+		return response, true
+	}
+
+	new_holder, err := resolveUser(target, slack_request.TeamId)
+	if err != nil {
+		response.Text = err.Error()
+		return response, true
+	}
+	if new_holder.Name == "" {
+		new_holder.Name = new_holder.Id
+	}
+
+	if new_holder.Is(slack_request.User()) {
+		response.Text = fmt.Sprintf("\"*%v*\" is already yours", resource)
+		return response, true
+	}
+
+	// Replace the holder and take the new one out of the waitlist in a single
+	// transaction
+	var previous Reservation
+	var reservation Reservation
+	err = store.Update(func(tx *StoreTx) error {
+
+		var ok bool
+		previous, ok = ownActiveReservation(tx, resource, slack_request)
+		if !ok {
+			response.Text = noReservationText(resource, "transfer")
+			return ErrRollback
+		}
+
+		var text string
+		var err error
+		reservation, text, err = handOver(
+			tx, resource, previous, new_holder, HISTORY_TRANSFER, slack_request)
+		if text != "" {
+			response.Text = text
+			return ErrRollback
+		}
+
+		return err
+	})
+
+	if err != nil {
+		log.Error(err)
+		return response, false
+	}
+
+	// Nothing to transfer
+	if response.Text != "" {
+		return response, true
+	}
+
+	log.Infof(
+		"%v transferred their reservation of %v to %v",
+		previous.User,
+		resource,
+		reservation.User)
+
+	sendNotificationsInBackground([]Notification{{
+		UserId: reservation.UserId,
+		Text: fmt.Sprintf(
+			"%v has handed *%v* over to you. It's yours for the next %v",
+			previous.Mention(),
+			resource,
+			reservation.RemainingTimeToString()),
+	}})
+
+	// Construct a response for the user
+	response.Text = fmt.Sprintf(
+		"You've handed \"*%v*\" over to %v. It's theirs for the next *%v*",
+		resource,
+		reservation.Mention(),
+		reservation.RemainingTimeToString())
+
+	return response, true
+
+}
+
+// Replaces the holder of `previous` with `new_holder`, keeping the same end
+// time, and takes them out of the waitlist. Returns the new reservation, or
+// else a message explaining why it couldn't be handed over.
+func handOver(
+	tx *StoreTx,
+	resource string,
+	previous Reservation,
+	new_holder UserIdentity,
+	action string,
+	slack_request SlackRequest) (Reservation, string, error) {
+
+	if tx.Reservations.FindByUser(resource, new_holder).IsActive() {
+		return Reservation{}, fmt.Sprintf(
+			"%v already has \"*%v*\"",
+			new_holder.Mention(),
+			resource), nil
+	}
+
+	err := tx.Reservations.Delete(resource, previous)
+	if err != nil {
+		return Reservation{}, "", err
+	}
+
+	// The previous holder's note and reminder were theirs, so aren't
+	// handed over
+	reservation := Reservation{
+		User:    new_holder.Name,
+		UserId:  new_holder.Id,
+		TeamId:  new_holder.TeamId,
+		StartAt: previous.StartAt,
+		EndAt:   previous.EndAt,
+	}
+
+	err = tx.Reservations.Upsert(resource, reservation)
+	if isConflictError(err) {
+		return Reservation{}, conflictText(err.(*ConflictError)), nil
+	}
+	if err != nil {
+		return Reservation{}, "", err
+	}
+
+	tx.Waitlists.Remove(resource, new_holder)
+
+	event := newHistoryEvent(action, resource, slack_request, previous)
+	event.NewHolder = reservation.User
+	event.NewHolderId = reservation.UserId
+	event.OldEndAt = previous.EndAt
+	event.NewEndAt = reservation.EndAt
+	tx.Record(event)
+
+	return reservation, "", nil
+
+}
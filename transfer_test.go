@@ -0,0 +1,111 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandleCommandTransfer(t *testing.T) {
+
+	//
+	// Setup
+	//
+
+	defer useResources("production, staging")()
+
+	defer useTempStore()()
+
+	api, cleanup_api := useFakeSlackApi()
+	defer cleanup_api()
+
+	now := time.Now()
+	end_at := now.Add(8 * time.Hour)
+	store.Upsert("staging", Reservation{
+		User: "alice", UserId: "Ualice", TeamId: "T0001", StartAt: now, EndAt: end_at,
+		Reminded: true, Note: "deploying"})
+	store.Update(func(tx *StoreTx) error {
+		tx.Waitlists.Push("staging", WaitlistEntry{
+			User: "bob", UserId: "UBOB", TeamId: "T0001", Duration: time.Hour, QueuedAt: now})
+		return nil
+	})
+
+	//
+	// Test
+	//
+
+	t.Run("NotHolder", func(t *testing.T) {
+
+		expectMatch(t,
+			runCommand(t, handleCommandTransfer, "CAROL", "transfer staging to <@UCAROL|carol>"),
+			"\"\\*staging\\*\" is already yours")
+
+		expectMatch(t,
+			runCommand(t, handleCommandTransfer, "carol", "transfer staging to <@UBOB|bob>"),
+			"You don't have any reservation on \"\\*staging\\*\" to transfer")
+
+		expectMatch(t,
+			runCommand(t, handleCommandTransfer, "alice", "transfer production to <@UBOB|bob>"),
+			"You don't have any reservation on \"\\*production\\*\" to transfer")
+
+	})
+
+	t.Run("UnknownUser", func(t *testing.T) {
+
+		expectMatch(t,
+			runCommand(t, handleCommandTransfer, "alice", "transfer staging to @nobody"),
+			"I couldn't find anyone called \\*@nobody\\*")
+
+	})
+
+	t.Run("Success", func(t *testing.T) {
+
+		expectMatch(t,
+			runCommand(t, handleCommandTransfer, "alice", "transfer staging to <@UBOB|bob>"),
+			"\\AYou've handed \"\\*staging\\*\" over to <@UBOB>. It's theirs for the next \\*.*\\*\\z")
+
+		reservation, _ := store.Get("staging")
+		if !reservation.IsHeldBy(UserIdentity{Id: "UBOB", TeamId: "T0001"}) {
+			t.Error("expected", "UBOB", "got", reservation)
+		}
+		if !reservation.EndAt.Equal(end_at) {
+			t.Error("expected", end_at, "got", reservation.EndAt)
+		}
+		if reservation.Reminded {
+			t.Error("expected", false, "got", reservation.Reminded)
+		}
+		if reservation.Note != "" {
+			t.Error("expected", "", "got", reservation.Note)
+		}
+
+		// No longer waiting for it
+		var waitlist Waitlist
+		store.Update(func(tx *StoreTx) error {
+			waitlist = tx.Waitlists["staging"]
+			return ErrRollback
+		})
+		if len(waitlist) != 0 {
+			t.Error("expected an empty waitlist, got", waitlist)
+		}
+
+		messages := api.waitForMessages(1)
+		if len(messages) != 1 ||
+			messages[0]["channel"] != "UBOB" ||
+			!strings.HasPrefix(messages[0]["text"], "<@Ualice> has handed *staging* over to you") {
+			t.Error("expected a message to bob, got", messages)
+		}
+
+		events, _ := store.History("staging", time.Time{})
+		if len(events) != 1 {
+			t.Fatal("expected", 1, "got", len(events))
+		}
+		expectMatch(t, events[0].ToString(), "<@Ualice> handed it over to <@UBOB> until ")
+
+		// It's bob's to hand on now, not alice's
+		expectMatch(t,
+			runCommand(t, handleCommandTransfer, "alice", "transfer staging to <@UCAROL|carol>"),
+			"You don't have any reservation on \"\\*staging\\*\" to transfer")
+
+	})
+
+}
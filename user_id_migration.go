@@ -0,0 +1,104 @@
+package main
+
+// Reservations and waitlist entries saved before user IDs were recorded only
+// have a user name. This looks up the IDs of those users and saves them, so
+// they keep their reservations even if they change their name.
+//
+// Runs once at startup, and only if there's a bot token to look users up
+// with. Anyone who can't be found keeps being matched by name.
+func migrateUserIds() {
+
+	if slack_client == nil {
+		return
+	}
+
+	// Avoid listing every user in the workspace when there's nothing to do
+	var pending int
+	err := store.Update(func(tx *StoreTx) error {
+		pending = upgradeUserIds(tx, map[string]SlackUser{})
+		return ErrRollback
+	})
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	if pending == 0 {
+		return
+	}
+
+	users, err := slack_client.ListUsers()
+	if err != nil {
+		log.Errorf("Could not look up user IDs: %v", err)
+		return
+	}
+
+	users_by_name := map[string]SlackUser{}
+	for _, user := range users {
+		if !user.Deleted {
+			users_by_name[user.Name] = user
+		}
+	}
+
+	var remaining int
+	err = store.Update(func(tx *StoreTx) error {
+		remaining = upgradeUserIds(tx, users_by_name)
+		return nil
+	})
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	log.Infof("Added user IDs to %v reservations and waitlist entries", pending-remaining)
+	if remaining > 0 {
+		log.Warningf(
+			"Could not find user IDs for %v reservations and waitlist entries, "+
+				"which will continue to be matched by user name",
+			remaining)
+	}
+
+}
+
+// Fills in the ID of every reservation and waitlist entry without one whose
+// user is in `users_by_name`. Returns how many are still missing an ID.
+func upgradeUserIds(tx *StoreTx, users_by_name map[string]SlackUser) int {
+
+	remaining := 0
+
+	for _, schedule := range tx.Reservations {
+		for i := range schedule {
+			if schedule[i].UserId != "" {
+				continue
+			}
+
+			user, ok := users_by_name[schedule[i].User]
+			if !ok {
+				remaining++
+				continue
+			}
+
+			schedule[i].UserId = user.Id
+			schedule[i].TeamId = user.TeamId
+		}
+	}
+
+	for _, waitlist := range tx.Waitlists {
+		for i := range waitlist {
+			if waitlist[i].UserId != "" {
+				continue
+			}
+
+			user, ok := users_by_name[waitlist[i].User]
+			if !ok {
+				remaining++
+				continue
+			}
+
+			waitlist[i].UserId = user.Id
+			waitlist[i].TeamId = user.TeamId
+		}
+	}
+
+	return remaining
+
+}
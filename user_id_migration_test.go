@@ -0,0 +1,68 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMigrateUserIds(t *testing.T) {
+
+	//
+	// Setup
+	//
+
+	defer useResources("production, staging")()
+
+	defer useTempStore()()
+
+	api, cleanup_api := useFakeSlackApi()
+	defer cleanup_api()
+
+	api.users = []SlackUser{
+		{Id: "UALICE", TeamId: "T0001", Name: "alice"},
+		{Id: "UBOB", TeamId: "T0001", Name: "bob"},
+	}
+
+	now := time.Now()
+	store.Upsert("production", Reservation{User: "alice", StartAt: now, EndAt: now.Add(time.Hour)})
+	store.Upsert("staging", Reservation{User: "dave", StartAt: now, EndAt: now.Add(time.Hour)})
+	store.Update(func(tx *StoreTx) error {
+		tx.Waitlists.Push("staging", WaitlistEntry{User: "bob", Duration: time.Hour})
+		return nil
+	})
+
+	//
+	// Test
+	//
+
+	migrateUserIds()
+
+	reservation, _ := store.Get("production")
+	if reservation.UserId != "UALICE" || reservation.TeamId != "T0001" {
+		t.Error("expected", "UALICE", "got", reservation)
+	}
+
+	// Unknown users are left alone
+	reservation, _ = store.Get("staging")
+	if reservation.UserId != "" {
+		t.Error("expected", "", "got", reservation.UserId)
+	}
+
+	store.Update(func(tx *StoreTx) error {
+		if entry := tx.Waitlists["staging"][0]; entry.UserId != "UBOB" {
+			t.Error("expected", "UBOB", "got", entry)
+		}
+		return ErrRollback
+	})
+
+	// They keep their reservation after renaming themselves
+	request := newTestSlackRequest("alice2", "extend production by 10 mins")
+	request.UserId = "UALICE"
+
+	response, _ := handleRequest(handleCommandUpdate, request)
+	if expected := "You have extended your reservation"; !strings.Contains(response.Text, expected) {
+		t.Errorf("expected %q to contain %q", response.Text, expected)
+	}
+
+}
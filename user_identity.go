@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// A user mention as Slack escapes it in command text, e.g. `<@U0123ABCD>` or
+// `<@U0123ABCD|alice>`
+var user_mention_regex = regexp.MustCompile("\\A<@([UW][A-Z0-9]+)(?:\\|([^>]*))?>\\z")
+
+// Who a reservation or waitlist entry belongs to. Users are identified by
+// their Slack user ID (within `TeamId`), since user names are deprecated by
+// Slack and can be changed. `Name` is kept for logging, and for matching
+// records saved before IDs were recorded.
+type UserIdentity struct {
+	Id     string
+	TeamId string
+	Name   string
+}
+
+// Whether both identities are the same user. Falls back to comparing names
+// if either has no ID. IDs are only compared across teams when both teams
+// are known.
+func (u UserIdentity) Is(other UserIdentity) bool {
+
+	if u.Id == "" || other.Id == "" {
+		return u.Name == other.Name
+	}
+
+	if u.TeamId != "" && other.TeamId != "" && u.TeamId != other.TeamId {
+		return false
+	}
+
+	return u.Id == other.Id
+
+}
+
+// Mentions the user so Slack renders a link to their profile. Users without
+// an ID fall back to their name.
+func (u UserIdentity) Mention() string {
+
+	if u.Id == "" {
+		return u.Name
+	}
+
+	return fmt.Sprintf("<@%v>", u.Id)
+
+}
+
+// Works out who `text` refers to. Mentions escaped by Slack carry the user's
+// ID, but if the slash command isn't set up to escape them they arrive as a
+// plain `@name`, which has to be looked up in the workspace. Users are
+// assumed to be in `team_id` unless Slack says otherwise.
+func resolveUser(text string, team_id string) (UserIdentity, error) {
+
+	if matches := user_mention_regex.FindStringSubmatch(text); matches != nil {
+		return UserIdentity{Id: matches[1], TeamId: team_id, Name: matches[2]}, nil
+	}
+
+	name := strings.TrimPrefix(text, "@")
+
+	if slack_client == nil {
+		return UserIdentity{}, errors.New(fmt.Sprintf(
+			"I can't tell who *%v* is. Ask whoever set me up to turn on "+
+				"*Escape channels, users, and links* for the slash command",
+			text))
+	}
+
+	users, err := slack_client.ListUsers()
+	if err != nil {
+		log.Error(err)
+		return UserIdentity{}, errors.New(fmt.Sprintf(
+			"I couldn't look up *%v* in Slack. Try again in a bit",
+			text))
+	}
+
+	for _, user := range users {
+		if user.Deleted || !strings.EqualFold(user.Name, name) {
+			continue
+		}
+
+		identity := UserIdentity{Id: user.Id, TeamId: user.TeamId, Name: user.Name}
+		if identity.TeamId == "" {
+			identity.TeamId = team_id
+		}
+		return identity, nil
+	}
+
+	return UserIdentity{}, errors.New(fmt.Sprintf(
+		"I couldn't find anyone called *%v*",
+		text))
+
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestUserIdentityIs(t *testing.T) {
+
+	alice := UserIdentity{Id: "U1", TeamId: "T1", Name: "alice"}
+
+	test_cases := []struct {
+		other    UserIdentity
+		expected bool
+	}{
+		{UserIdentity{Id: "U1", TeamId: "T1", Name: "alice"}, true},
+		// Renamed
+		{UserIdentity{Id: "U1", TeamId: "T1", Name: "alice2"}, true},
+		// Team unknown
+		{UserIdentity{Id: "U1", Name: "alice"}, true},
+		// Different user, same name
+		{UserIdentity{Id: "U2", TeamId: "T1", Name: "alice"}, false},
+		// Same ID in a different team
+		{UserIdentity{Id: "U1", TeamId: "T2", Name: "alice"}, false},
+		// Saved before IDs were recorded
+		{UserIdentity{Name: "alice"}, true},
+		{UserIdentity{Name: "bob"}, false},
+	}
+
+	for _, test_case := range test_cases {
+		if actual := alice.Is(test_case.other); actual != test_case.expected {
+			t.Error(test_case.other, ": expected", test_case.expected, "got", actual)
+		}
+	}
+
+}
+
+func TestUserIdentityMention(t *testing.T) {
+
+	if actual := (UserIdentity{Id: "U1", Name: "alice"}).Mention(); actual != "<@U1>" {
+		t.Error("expected", "<@U1>", "got", actual)
+	}
+
+	if actual := (UserIdentity{Name: "alice"}).Mention(); actual != "alice" {
+		t.Error("expected", "alice", "got", actual)
+	}
+
+}
+
+func TestResolveUser(t *testing.T) {
+
+	t.Run("Mention", func(t *testing.T) {
+
+		actual, err := resolveUser("<@U0123ABCD|alice>", "T1")
+		expected := UserIdentity{Id: "U0123ABCD", TeamId: "T1", Name: "alice"}
+		if err != nil || actual != expected {
+			t.Error("expected", expected, "got", actual, err)
+		}
+
+		actual, err = resolveUser("<@U0123ABCD>", "T1")
+		expected = UserIdentity{Id: "U0123ABCD", TeamId: "T1"}
+		if err != nil || actual != expected {
+			t.Error("expected", expected, "got", actual, err)
+		}
+
+	})
+
+	t.Run("NameWithoutClient", func(t *testing.T) {
+
+		old_slack_client := slack_client
+		defer func() { slack_client = old_slack_client }()
+		slack_client = nil
+
+		_, err := resolveUser("@alice", "T1")
+		if err == nil {
+			t.Error("expected an error, got", nil)
+		}
+
+	})
+
+	t.Run("Name", func(t *testing.T) {
+
+		api, cleanup := useFakeSlackApi()
+		defer cleanup()
+
+		api.users = []SlackUser{
+			{Id: "U1", Name: "alice", Deleted: true},
+			{Id: "U2", TeamId: "T2", Name: "alice"},
+			{Id: "U3", Name: "bob"},
+		}
+
+		actual, err := resolveUser("@Alice", "T1")
+		expected := UserIdentity{Id: "U2", TeamId: "T2", Name: "alice"}
+		if err != nil || actual != expected {
+			t.Error("expected", expected, "got", actual, err)
+		}
+
+		actual, err = resolveUser("bob", "T1")
+		expected = UserIdentity{Id: "U3", TeamId: "T1", Name: "bob"}
+		if err != nil || actual != expected {
+			t.Error("expected", expected, "got", actual, err)
+		}
+
+		_, err = resolveUser("@carol", "T1")
+		if err == nil {
+			t.Error("expected an error, got", nil)
+		}
+
+	})
+
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var waitlists_file = filepath.Join(reservations_dir, "waitlists.json")
+
+// A user waiting in line for a resource. `Duration` is how long the
+// reservation should last once it's their turn.
+type WaitlistEntry struct {
+	User     string        `json:"user"`
+	UserId   string        `json:"user_id,omitempty"`
+	TeamId   string        `json:"team_id,omitempty"`
+	Duration time.Duration `json:"duration"`
+	QueuedAt time.Time     `json:"queued_at"`
+}
+
+// Ordered list of users waiting for a resource, head of the line first
+type Waitlist []WaitlistEntry
+
+// Waitlists for each resource, keyed by resource
+type Waitlists map[string]Waitlist
+
+// Records a queued user being handed a reservation
+type Promotion struct {
+	Resource    string
+	Reservation Reservation
+}
+
+func NewWaitlists() (Waitlists, error) {
+
+	log.Debugf("Reading waitlists file %v", waitlists_file)
+
+	waitlists := Waitlists{}
+
+	// A missing file just means nobody has queued for anything yet
+	body, err := ioutil.ReadFile(waitlists_file)
+	if os.IsNotExist(err) {
+		return waitlists, nil
+	}
+	if err != nil {
+		log.Error("Could not read from file")
+		return waitlists, err
+	}
+
+	err = json.Unmarshal(body, &waitlists)
+	if err != nil {
+		log.Error("Could not unmarshal JSON data")
+
+		waitlists = Waitlists{}
+		if !recoverFromSnapshot(waitlists_file, &waitlists, err) {
+			return waitlists, err
+		}
+	}
+
+	return waitlists, nil
+
+}
+
+func (w Waitlists) WriteToFile() error {
+
+	log.Debugf("Writing to waitlists file %v", waitlists_file)
+
+	body, err := json.Marshal(w)
+	if err != nil {
+		log.Error("Could not marshal JSON data")
+		return err
+	}
+
+	err = writeFileAtomically(waitlists_file, body, 0644)
+	if err != nil {
+		log.Error("Could not write to file")
+		return err
+	}
+
+	return nil
+
+}
+
+func (e WaitlistEntry) Identity() UserIdentity {
+
+	return UserIdentity{Id: e.UserId, TeamId: e.TeamId, Name: e.User}
+
+}
+
+// Adds the user to the back of the line for a resource and returns their
+// (1-based) position. If they're already in line their existing position is
+// returned and nothing changes.
+func (w Waitlists) Push(resource string, entry WaitlistEntry) int {
+
+	if position := w[resource].Position(entry.Identity()); position > 0 {
+		return position
+	}
+
+	w[resource] = append(w[resource], entry)
+	return len(w[resource])
+
+}
+
+// Removes the user from the line for a resource. Returns false if they
+// weren't in it.
+func (w Waitlists) Remove(resource string, user UserIdentity) bool {
+
+	position := w[resource].Position(user)
+	if position == 0 {
+		return false
+	}
+
+	waitlist := append(Waitlist{}, w[resource][:position-1]...)
+	waitlist = append(waitlist, w[resource][position:]...)
+
+	if len(waitlist) == 0 {
+		delete(w, resource)
+	} else {
+		w[resource] = waitlist
+	}
+
+	return true
+
+}
+
+// Returns the user's 1-based position in line, or 0 if they're not in it
+func (wl Waitlist) Position(user UserIdentity) int {
+
+	for i, entry := range wl {
+		if entry.Identity().Is(user) {
+			return i + 1
+		}
+	}
+
+	return 0
+
+}
+
+// Renders the line as e.g. "1. alice, 2. bob"
+func waitlistToString(wl Waitlist) string {
+
+	users := make([]string, len(wl))
+	for i, entry := range wl {
+		users[i] = fmt.Sprintf("%v. %v", i+1, entry.Identity().Mention())
+	}
+
+	return strings.Join(users, ", ")
+
+}
+
+// If the resource has a free slot and someone is waiting for it, hands it to
+// the person at the front of the line. Their reservation starts now,
+// regardless of when the previous one ended, and is cut short if need be so
+// that it doesn't overlap any upcoming bookings.
+func promoteWaitlist(tx *StoreTx, resource string) (Promotion, bool) {
+
+	if tx.Reservations.IsFull(resource) {
+		return Promotion{}, false
+	}
+
+	waitlist := tx.Waitlists[resource]
+	if len(waitlist) == 0 {
+		return Promotion{}, false
+	}
+
+	head := waitlist[0]
+	now := time.Now()
+	reservation := Reservation{
+		User:    head.User,
+		UserId:  head.UserId,
+		TeamId:  head.TeamId,
+		StartAt: now,
+		EndAt:   now.Add(head.Duration),
+	}
+
+	// Cut the reservation short rather than run in to an upcoming booking
+	config, _ := FindResource(resource)
+	if conflict, ok := tx.Reservations[resource].FindConflict(reservation, config.Slots()); ok {
+		log.Infof(
+			"Shortening %v's reservation of %v to end when %v's begins",
+			head.User,
+			resource,
+			conflict.User)
+		reservation.EndAt = conflict.StartAt
+	}
+
+	// They've since got a slot of their own, so they're no longer waiting
+	if !reservation.EndAt.After(reservation.StartAt) {
+		tx.Waitlists.Remove(resource, head.Identity())
+		return Promotion{}, false
+	}
+
+	err := tx.Reservations.Upsert(resource, reservation)
+	if err != nil {
+		// Resource has since been removed, so there's nothing to wait for
+		log.Warningf("Dropping waitlist for %v: %v", resource, err)
+		delete(tx.Waitlists, resource)
+		return Promotion{}, false
+	}
+
+	tx.Waitlists.Remove(resource, head.Identity())
+	log.Infof("Promoted %v from the waitlist for %v", head.User, resource)
+
+	tx.Record(HistoryEvent{
+		At:       now,
+		Action:   HISTORY_PROMOTE,
+		Resource: resource,
+		Holder:   reservation.User,
+		HolderId: reservation.UserId,
+		StartAt:  reservation.StartAt,
+		NewEndAt: reservation.EndAt,
+	})
+
+	return Promotion{Resource: resource, Reservation: reservation}, true
+
+}
+
+// Runs `promoteWaitlist()` for every resource with a waitlist
+func promoteWaitlists(tx *StoreTx) []Promotion {
+
+	var promotions []Promotion
+
+	for resource := range tx.Waitlists {
+		if promotion, ok := promoteWaitlist(tx, resource); ok {
+			promotions = append(promotions, promotion)
+		}
+	}
+
+	return promotions
+
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWaitlists(t *testing.T) {
+
+	t.Run("Push", func(t *testing.T) {
+
+		waitlists := Waitlists{}
+
+		if p := waitlists.Push("staging", WaitlistEntry{User: "a"}); p != 1 {
+			t.Error("expected", 1, "got", p)
+		}
+		if p := waitlists.Push("staging", WaitlistEntry{User: "b"}); p != 2 {
+			t.Error("expected", 2, "got", p)
+		}
+
+		// Queueing twice keeps your spot
+		if p := waitlists.Push("staging", WaitlistEntry{User: "a"}); p != 1 {
+			t.Error("expected", 1, "got", p)
+		}
+		if l := len(waitlists["staging"]); l != 2 {
+			t.Error("expected length", 2, "got length", l)
+		}
+
+	})
+
+	t.Run("Remove", func(t *testing.T) {
+
+		waitlists := Waitlists{
+			"staging": Waitlist{{User: "a"}, {User: "b"}, {User: "c"}},
+		}
+
+		if !waitlists.Remove("staging", UserIdentity{Name: "b"}) {
+			t.Error("expected", "b", "to be removed")
+		}
+		if waitlists.Remove("staging", UserIdentity{Name: "b"}) {
+			t.Error("expected", "b", "to already be removed")
+		}
+
+		expected := "1. a, 2. c"
+		if actual := waitlistToString(waitlists["staging"]); actual != expected {
+			t.Error("expected", expected, "got", actual)
+		}
+
+		waitlists.Remove("staging", UserIdentity{Name: "a"})
+		waitlists.Remove("staging", UserIdentity{Name: "c"})
+		if _, ok := waitlists["staging"]; ok {
+			t.Error("expected empty waitlist to be deleted")
+		}
+
+	})
+
+}
+
+func TestNewWaitlistsRecoversFromSnapshot(t *testing.T) {
+
+	//
+	// Setup
+	//
+
+	_, cleanup := useTempStoreDir()
+	defer cleanup()
+
+	err := ioutil.WriteFile(
+		snapshotPath(waitlists_file, 1), []byte(`{"production": [{"user": "alice"}]}`), 0644)
+	if err != nil {
+		panic(err)
+	}
+
+	// Valid JSON, so "staging" is decoded before "production" fails
+	err = ioutil.WriteFile(
+		waitlists_file, []byte(`{"staging": [{"user": "mallory"}], "production": 5}`), 0644)
+	if err != nil {
+		panic(err)
+	}
+
+	//
+	// Test
+	//
+
+	actual, err := NewWaitlists()
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+
+	if len(actual) != 1 || len(actual["production"]) != 1 || actual["production"][0].User != "alice" {
+		t.Error("expected only the snapshot's waitlists, got", actual)
+	}
+
+}
+
+func TestPromoteWaitlist(t *testing.T) {
+
+	defer useResources("production, staging")()
+
+	active := Reservation{User: "a", EndAt: time.Now().Add(time.Hour)}
+	expired := Reservation{User: "a", EndAt: time.Now().Add(-time.Hour)}
+
+	newTx := func(reservation Reservation) *StoreTx {
+		return &StoreTx{
+			Reservations: Reservations{"staging": Schedule{reservation}},
+			Waitlists: Waitlists{
+				"staging": Waitlist{
+					{User: "b", Duration: 2 * time.Hour},
+					{User: "c", Duration: time.Hour},
+				},
+			},
+		}
+	}
+
+	t.Run("ResourceInUse", func(t *testing.T) {
+
+		tx := newTx(active)
+
+		if _, ok := promoteWaitlist(tx, "staging"); ok {
+			t.Error("expected no promotion")
+		}
+		if l := len(tx.Waitlists["staging"]); l != 2 {
+			t.Error("expected length", 2, "got length", l)
+		}
+
+	})
+
+	t.Run("ResourceExpired", func(t *testing.T) {
+
+		tx := newTx(expired)
+
+		promotion, ok := promoteWaitlist(tx, "staging")
+		if !ok {
+			t.Fatal("expected a promotion")
+		}
+
+		reservation := tx.Reservations.FindByResource("staging")
+		if reservation.User != "b" || promotion.Reservation.User != "b" {
+			t.Error("expected", "b", "got", reservation.User)
+		}
+		if reservation.RemainingTimeToString() != "2 hours, 0 minutes" {
+			t.Error(
+				"expected", "2 hours, 0 minutes",
+				"got", reservation.RemainingTimeToString())
+		}
+		if actual := waitlistToString(tx.Waitlists["staging"]); actual != "1. c" {
+			t.Error("expected", "1. c", "got", actual)
+		}
+
+	})
+
+	t.Run("ResourceCancelled", func(t *testing.T) {
+
+		tx := newTx(Reservation{})
+
+		if _, ok := promoteWaitlist(tx, "staging"); !ok {
+			t.Error("expected a promotion")
+		}
+
+	})
+
+}
+
+func TestHandleCommandQueue(t *testing.T) {
+
+	//
+	// Setup
+	//
+
+	defer useResources("production, staging")()
+
+	defer useTempStore()()
+
+	api, cleanup_api := useFakeSlackApi()
+	defer cleanup_api()
+
+	expectContains := func(actual string, expected string) {
+		if !strings.Contains(actual, expected) {
+			t.Errorf("expected %q to contain %q", actual, expected)
+		}
+	}
+
+	// Free resources are reserved straight away
+	expectContains(
+		runCommand(t, handleCommandQueue, "alice", "queue staging for 1 hour"),
+		"is free, so you've reserved it")
+
+	expectContains(
+		runCommand(t, handleCommandCreate, "bob", "reserve staging for 1 hour"),
+		"queue staging for 1 hour")
+
+	expectContains(
+		runCommand(t, handleCommandQueue, "bob", "queue staging for 2 hours"),
+		"You're *#1* in line")
+
+	expectContains(
+		runCommand(t, handleCommandQueue, "carol", "queue staging for 1 hour"),
+		"You're *#2* in line")
+
+	expectContains(
+		runCommand(t, handleCommandShow, "carol", "list"),
+		"waitlist: 1. <@Ubob>, 2. <@Ucarol>")
+
+	// Cancelling hands over to the next in line
+	expectContains(
+		runCommand(t, handleCommandDestroy, "alice", "cancel staging"),
+		"handed over to <@Ubob>")
+
+	reservation, _ := store.Get("staging")
+	if reservation.User != "bob" {
+		t.Error("expected", "bob", "got", reservation.User)
+	}
+
+	// Nobody can jump the line once it expires
+	reservation.EndAt = time.Now().Add(-time.Minute)
+	store.Upsert("staging", reservation)
+
+	expectContains(
+		runCommand(t, handleCommandCreate, "dave", "reserve staging for 1 hour"),
+		"<@Ucarol> has reserved")
+
+	// Leaving the line
+	runCommand(t, handleCommandQueue, "dave", "queue staging for 1 hour")
+	expectContains(
+		runCommand(t, handleCommandDestroy, "dave", "cancel staging"),
+		"You've left the waitlist")
+
+	if actual := runCommand(t, handleCommandShow, "dave", "list"); strings.Contains(actual, "waitlist") {
+		t.Error("expected no waitlist, got", actual)
+	}
+
+	// Listing hands expired reservations over too
+	runCommand(t, handleCommandQueue, "erin", "queue staging for 1 hour")
+	reservation, _ = store.Get("staging")
+	reservation.EndAt = time.Now().Add(-time.Minute)
+	store.Upsert("staging", reservation)
+
+	expectContains(
+		runCommand(t, handleCommandShow, "dave", "list"),
+		"<@Uerin>")
+
+	// Everyone handed the resource is told it's theirs
+	messages := api.waitForMessages(3)
+	if len(messages) != 3 {
+		t.Fatal("expected", 3, "messages, got", messages)
+	}
+
+	promoted := map[string]bool{"Ubob": true, "Ucarol": true, "Uerin": true}
+	for _, message := range messages {
+		if !promoted[message["channel"]] ||
+			!strings.HasPrefix(message["text"], "You're up! *staging* is now reserved for you") {
+			t.Errorf("unexpected message %v", message)
+		}
+	}
+
+}